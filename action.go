@@ -1,22 +1,67 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/igvaquero18/hermezon/scraper"
 	"github.com/labstack/echo/v4"
 )
 
+// dateLayout is the layout of the dates in actions and notifications
+const dateLayout = "2006-01-02"
+
+var (
+	amountRegexp   = regexp.MustCompile(`\d+[\.\,]?\d*`)
+	currencyRegexp = regexp.MustCompile(`^[A-Za-z]{3}$`)
+	localeRegexp   = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,4})?$`)
+)
+
 // Action is the action we will perform for tracking
 // products
 type Action struct {
+	Owner    string     `json:"owner,omitempty"`
 	From     string     `json:"from"`
 	URL      string     `json:"url"`
 	Type     ActionType `json:"type"`
 	Price    string     `json:"price,omitempty"`
 	FindText string     `json:"find_text,omitempty"`
 	Selector string     `json:"selector,omitempty"`
+	JSONPath string     `json:"json_path,omitempty"`
+	Locale   string     `json:"locale,omitempty"`
+	Channel  string     `json:"channel,omitempty"`
+	Priority int        `json:"priority,omitempty"`
+	Urgent   bool       `json:"urgent,omitempty"`
+	Digest   string     `json:"digest,omitempty"`
+	Tags     []string   `json:"tags,omitempty"`
+
+	// Variant of the product, either the child ASIN in Amazon or the value
+	// of VariantParam in the query string for other stores
+	Variant      string `json:"variant,omitempty"`
+	VariantParam string `json:"variant_param,omitempty"`
+
+	// Availability actions
+	DeliveryBefore string `json:"delivery_before,omitempty"`
+	LowStock       int    `json:"low_stock,omitempty"`
+
+	// Offer filters, for availability and price actions
+	SoldByAmazon      bool   `json:"sold_by_amazon,omitempty"`
+	FulfilledByAmazon bool   `json:"fulfilled_by_amazon,omitempty"`
+	Condition         string `json:"condition,omitempty"`
+
+	// Price actions
+	PriceMode PriceMode `json:"price_mode,omitempty"`
+	Currency  string    `json:"currency,omitempty"`
+
+	// Listing actions
+	ItemSelector string   `json:"item_selector,omitempty"`
+	Keywords     []string `json:"keywords,omitempty"`
+	MaxPrice     string   `json:"max_price,omitempty"`
 }
 
 // NewAction returns a new Action object with default values
@@ -27,6 +72,122 @@ func NewAction() *Action {
 	}
 }
 
+// meetsStockConditions returns true if an available product meets the
+// delivery date and low stock conditions of the action. Products whose
+// delivery date or remaining quantity are unknown don't meet them.
+func (a *Action) meetsStockConditions(product *scraper.Product) bool {
+	if a.DeliveryBefore != "" {
+		deadline, err := time.ParseInLocation(dateLayout, a.DeliveryBefore, time.Local)
+		if err != nil || product.DeliveryDate == nil || product.DeliveryDate.After(deadline) {
+			return false
+		}
+	}
+	if a.LowStock > 0 && (product.Quantity == 0 || product.Quantity > a.LowStock) {
+		return false
+	}
+	return true
+}
+
+// meetsOfferConditions returns true if the offer in the buy box meets the
+// seller, fulfillment and condition filters of the action. Offers whose
+// seller or condition are unknown don't meet them.
+func (a *Action) meetsOfferConditions(product *scraper.Product) bool {
+	if a.SoldByAmazon && !product.SoldByAmazon() {
+		return false
+	}
+	if a.FulfilledByAmazon && product.Fulfillment != scraper.FulfillmentAmazon {
+		return false
+	}
+	if a.Condition != "" && a.Condition != product.Condition {
+		return false
+	}
+	return true
+}
+
+// key returns the key under which the action is stored in the database
+func (a *Action) key() string {
+	if a.Variant != "" {
+		return fmt.Sprintf("%s|%s|%s", a.From, a.URL, a.Variant)
+	}
+	return fmt.Sprintf("%s|%s", a.From, a.URL)
+}
+
+// decodeAction decodes an action stored in the database. Actions used to be
+// stored as "selector|value" strings under "from|url" keys, so that format is
+// still understood.
+func decodeAction(at ActionType, key, value string) (*Action, error) {
+	action := NewAction()
+	if strings.HasPrefix(value, "{") {
+		if err := json.Unmarshal([]byte(value), action); err != nil {
+			return nil, err
+		}
+		return action, nil
+	}
+	keys := strings.SplitN(key, "|", 2)
+	values := strings.SplitN(value, "|", 2)
+	if len(keys) < 2 || len(values) < 2 {
+		return nil, fmt.Errorf("invalid keys and/or values returned from database: %s, %s", key, value)
+	}
+	action.From, action.URL = keys[0], keys[1]
+	action.Type = at
+	action.Selector = values[0]
+	switch at {
+	case priceAction:
+		action.Price = values[1]
+	default:
+		action.FindText = values[1]
+	}
+	return action, nil
+}
+
+// loadAction returns an action stored in the database, or nil if it doesn't
+// exist
+func loadAction(at ActionType, key string) (*Action, error) {
+	value, err := db.Get(key, string(at))
+	if err != nil || value == "" {
+		return nil, err
+	}
+	return decodeAction(at, key, value)
+}
+
+// deleteAction deletes an action stored in the database, together with the
+// facts of its product or, for listings, the items seen in them
+func deleteAction(at ActionType, key string) error {
+	var err error
+	if at == listingAction {
+		err = db.Delete(key, seenItemsBucket)
+	} else {
+		err = db.Delete(factsKey(string(at), key), factsBucket)
+	}
+	if err != nil {
+		return err
+	}
+	return db.Delete(key, string(at))
+}
+
+// loadActions returns all the actions of a given type stored in the
+// database, indexed by their key
+func loadActions(at ActionType) (map[string]*Action, error) {
+	results, err := db.GetAll(string(at))
+	if err != nil {
+		return nil, err
+	}
+	actions := make(map[string]*Action, len(results))
+	for k, v := range results {
+		action, err := decodeAction(at, k, v)
+		if err != nil {
+			return nil, err
+		}
+		actions[k] = action
+	}
+	return actions, nil
+}
+
+// parseAmount returns the first number found in a string like "99,95 €"
+func parseAmount(amount string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(amountRegexp.FindString(amount), ",", "."), 64)
+}
+
 // ActionType is a wrapper around the string type to define
 // what kind of actions we can perform
 type ActionType string
@@ -34,17 +195,48 @@ type ActionType string
 const (
 	priceAction        = "price"
 	availabilityAction = "availability"
+	listingAction      = "listing"
 )
 
 // IsValid checks whether an action is valid or not
 func (at ActionType) IsValid() bool {
 	switch at {
-	case priceAction, availabilityAction:
+	case priceAction, availabilityAction, listingAction:
 		return true
 	}
 	return false
 }
 
+// PriceMode defines which price of a product is compared with the target
+// price of an action
+type PriceMode string
+
+const (
+	// listPrice is the price shown by the store
+	listPrice = "list"
+	// effectivePrice is the price including shipping costs and coupons
+	effectivePrice = "effective"
+)
+
+// IsValid checks whether a price mode is valid or not
+func (pm PriceMode) IsValid() bool {
+	switch pm {
+	case "", listPrice, effectivePrice:
+		return true
+	}
+	return false
+}
+
+// comparablePrice returns the price of the product that is compared with the
+// target price of the action, in the currency of the action
+func (a *Action) comparablePrice(product *scraper.Product) (float64, error) {
+	price := product.Price
+	if a.PriceMode == effectivePrice {
+		price = product.EffectivePrice()
+	}
+	return convertPrice(price, product.Currency, a.Currency)
+}
+
 // ResponseMessage is a struct for building responses
 type ResponseMessage struct {
 	Message string `json:"message"`
@@ -57,27 +249,188 @@ func postActions(c echo.Context) error {
 	if err := c.Bind(&action); err != nil {
 		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid action: %s", err.Error())})
 	}
-	if action.Type.IsValid() {
+	if !action.Type.IsValid() {
 		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid action"})
 	}
 
-	var secondParameter string
+	if action.DeliveryBefore != "" {
+		if _, err := time.Parse(dateLayout, action.DeliveryBefore); err != nil {
+			return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid delivery date: %s", err.Error())})
+		}
+	}
 
-	switch action.Type {
-	case priceAction:
-		secondParameter = fmt.Sprintf("%s|%s", action.Selector, action.Price)
+	if action.Variant != "" {
+		scr := scraper.NewScraper(
+			scraper.SetURL(action.URL),
+			scraper.SetVariant(action.Variant),
+			scraper.SetVariantParam(action.VariantParam),
+		)
+		if _, err := scr.ProductURL(); err != nil {
+			return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid variant: %s", err.Error())})
+		}
+	}
+
+	if !action.PriceMode.IsValid() {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid price mode: %s", action.PriceMode)})
+	}
+
+	if action.Currency != "" && !currencyRegexp.MatchString(action.Currency) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid currency: %s", action.Currency)})
+	}
+
+	if _, err := messengerFor(action.Channel); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid channel: %s", err.Error())})
+	}
+	if err := checkDestination(action.Channel, action.From); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid from: %s", err.Error())})
+	}
+
+	if !isValidPriority(action.Priority) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid priority: %d", action.Priority)})
+	}
+
+	if action.Locale != "" && !localeRegexp.MatchString(action.Locale) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid locale: %s", action.Locale)})
+	}
+
+	if !isValidDigest(action.Digest) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid digest: %s", action.Digest)})
+	}
+
+	if !isValidTags(action.Tags) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid tags: %s", strings.Join(action.Tags, ","))})
+	}
+
+	switch action.Condition {
+	case "", scraper.ConditionNew, scraper.ConditionUsed, scraper.ConditionRefurbished:
 	default:
-		secondParameter = fmt.Sprintf("%s|%s", action.Selector, action.FindText)
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid condition: %s", action.Condition)})
+	}
+
+	if action.Type == priceAction && action.Selector == scraper.DefaultSelector {
+		action.Selector = scraper.DefaultPriceSelector
+	}
+	if action.Type == listingAction {
+		if action.ItemSelector == "" {
+			action.ItemSelector = scraper.DefaultItemSelector
+		}
+		if action.Selector == scraper.DefaultSelector {
+			action.Selector = scraper.DefaultItemPriceSelector
+		}
+	}
+
+	userMutex.Lock()
+	defer userMutex.Unlock()
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	action.Owner = user.ID
+	if action.Locale == "" {
+		action.Locale = user.Locale
+	}
+	existing, err := loadAction(action.Type, action.key())
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Owner != user.ID {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"the action belongs to another user"})
+	}
+	if existing == nil && user.Limits.Actions > 0 {
+		actions, err := userActions(user)
+		if err != nil {
+			return err
+		}
+		if len(actions) >= user.Limits.Actions {
+			return c.JSON(http.StatusForbidden, &ResponseMessage{fmt.Sprintf("limit of %d actions reached", user.Limits.Actions)})
+		}
+	}
+	if !user.isVerified(action.Channel, action.From) {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"invalid from: the destination is not verified"})
 	}
 
 	sugar.Debugw("adding product to database",
+		"owner", action.Owner,
 		"action", action.Type,
 		"from", action.From,
 		"url", action.URL,
 		"selector", action.Selector,
 		"find_text", action.FindText,
 		"price", action.Price,
+		"json_path", action.JSONPath,
+		"locale", action.Locale,
+		"channel", action.Channel,
+		"priority", action.Priority,
+		"urgent", action.Urgent,
+		"digest", action.Digest,
+		"tags", action.Tags,
+		"variant", action.Variant,
+		"variant_param", action.VariantParam,
+		"delivery_before", action.DeliveryBefore,
+		"low_stock", action.LowStock,
+		"sold_by_amazon", action.SoldByAmazon,
+		"fulfilled_by_amazon", action.FulfilledByAmazon,
+		"condition", action.Condition,
+		"item_selector", action.ItemSelector,
+		"keywords", action.Keywords,
+		"max_price", action.MaxPrice,
 	)
 
-	return db.Save(fmt.Sprintf("%s|%s", action.From, action.URL), secondParameter, string(action.Type))
+	value, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+
+	return db.Save(action.key(), string(value), string(action.Type))
+}
+
+// getActions returns the actions of the user making the request, optionally
+// filtered by type
+func getActions(c echo.Context) error {
+	at := ActionType(c.QueryParam("type"))
+	if at != "" && !at.IsValid() {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid type: %s", at)})
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	actions, err := userActions(user)
+	if err != nil {
+		return err
+	}
+	filtered := []*Action{}
+	for _, action := range actions {
+		if at == "" || action.Type == at {
+			filtered = append(filtered, action)
+		}
+	}
+	return c.JSON(http.StatusOK, filtered)
+}
+
+// deleteActions will allow users to stop tracking a product
+func deleteActions(c echo.Context) error {
+	action := &Action{
+		Type:    ActionType(c.QueryParam("type")),
+		From:    c.QueryParam("from"),
+		URL:     c.QueryParam("url"),
+		Variant: c.QueryParam("variant"),
+	}
+	if !action.Type.IsValid() || action.From == "" || action.URL == "" {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid query: type, from and url are required"})
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	existing, err := loadAction(action.Type, action.key())
+	if err != nil {
+		return err
+	}
+	if existing == nil || existing.Owner != user.ID {
+		return c.JSON(http.StatusNotFound, &ResponseMessage{"action not found"})
+	}
+	sugar.Debugw("removing product from database", "owner", user.ID, "action", action.Type, "key", action.key())
+	return deleteAction(action.Type, action.key())
 }
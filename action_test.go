@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActionTypeIsValid(t *testing.T) {
+	testCases := []struct {
+		name     string
+		at       ActionType
+		expected bool
+	}{
+		{name: "price", at: priceAction, expected: true},
+		{name: "availability", at: availabilityAction, expected: true},
+		{name: "listing", at: listingAction, expected: true},
+		{name: "empty", at: ""},
+		{name: "unknown", at: "stock"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, tc.at.IsValid())
+		})
+	}
+}
+
+func TestPriceModeIsValid(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pm       PriceMode
+		expected bool
+	}{
+		{name: "default", pm: "", expected: true},
+		{name: "list", pm: listPrice, expected: true},
+		{name: "effective", pm: effectivePrice, expected: true},
+		{name: "unknown", pm: "lowest"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, tc.pm.IsValid())
+		})
+	}
+}
+
+func TestPostActionsValidation(t *testing.T) {
+	setUp(t)
+	e := newServer()
+	verify(t, "alice", "alice-phone")
+	url := "https://www.amazon.es/dp/B08KKJ37F7"
+
+	testCases := []struct {
+		name     string
+		body     map[string]interface{}
+		expected int
+	}{
+		{name: "valid", body: map[string]interface{}{"type": priceAction, "price": "10"}, expected: http.StatusOK},
+		{name: "missing type", body: map[string]interface{}{}, expected: http.StatusBadRequest},
+		{name: "invalid type", body: map[string]interface{}{"type": "stock"}, expected: http.StatusBadRequest},
+		{name: "invalid delivery date", body: map[string]interface{}{"type": availabilityAction, "delivery_before": "tomorrow"}, expected: http.StatusBadRequest},
+		{name: "invalid price mode", body: map[string]interface{}{"type": priceAction, "price_mode": "lowest"}, expected: http.StatusBadRequest},
+		{name: "invalid currency", body: map[string]interface{}{"type": priceAction, "currency": "euro"}, expected: http.StatusBadRequest},
+		{name: "invalid channel", body: map[string]interface{}{"type": priceAction, "channel": "pigeon"}, expected: http.StatusBadRequest},
+		{name: "invalid priority", body: map[string]interface{}{"type": priceAction, "priority": 9}, expected: http.StatusBadRequest},
+		{name: "invalid locale", body: map[string]interface{}{"type": priceAction, "locale": "spanish"}, expected: http.StatusBadRequest},
+		{name: "invalid digest", body: map[string]interface{}{"type": priceAction, "digest": "yearly"}, expected: http.StatusBadRequest},
+		{name: "tags", body: map[string]interface{}{"type": priceAction, "tags": []string{"video_game", "+1"}}, expected: http.StatusOK},
+		{name: "invalid tags", body: map[string]interface{}{"type": priceAction, "tags": []string{"video game"}}, expected: http.StatusBadRequest},
+		{name: "too many tags", body: map[string]interface{}{"type": priceAction, "tags": []string{"a", "b", "c", "d", "e", "f"}}, expected: http.StatusBadRequest},
+		{name: "invalid condition", body: map[string]interface{}{"type": availabilityAction, "condition": "broken"}, expected: http.StatusBadRequest},
+		{name: "unverified destination", body: map[string]interface{}{"type": priceAction, "from": "bob-phone"}, expected: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			if _, ok := tc.body["from"]; !ok {
+				tc.body["from"] = "alice-phone"
+			}
+			tc.body["url"] = url
+			rec := request(e, http.MethodPost, "/v1/actions", token("alice"), tc.body)
+			assert.Equal(tt, tc.expected, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestPostActionsDefaultSelectors(t *testing.T) {
+	setUp(t)
+	e := newServer()
+	verify(t, "alice", "alice-phone")
+
+	testCases := []struct {
+		name                 string
+		body                 map[string]interface{}
+		expectedSelector     string
+		expectedItemSelector string
+	}{
+		{
+			name:             "price",
+			body:             map[string]interface{}{"type": priceAction, "url": "https://www.amazon.es/dp/B01", "price": "10"},
+			expectedSelector: scraper.DefaultPriceSelector,
+		},
+		{
+			name:             "price with selector",
+			body:             map[string]interface{}{"type": priceAction, "url": "https://www.amazon.es/dp/B02", "price": "10", "selector": "#price"},
+			expectedSelector: "#price",
+		},
+		{
+			name:             "availability",
+			body:             map[string]interface{}{"type": availabilityAction, "url": "https://www.amazon.es/dp/B03"},
+			expectedSelector: scraper.DefaultSelector,
+		},
+		{
+			name:                 "listing",
+			body:                 map[string]interface{}{"type": listingAction, "url": "https://www.amazon.es/s?k=consola"},
+			expectedSelector:     scraper.DefaultItemPriceSelector,
+			expectedItemSelector: scraper.DefaultItemSelector,
+		},
+		{
+			name:                 "listing with selectors",
+			body:                 map[string]interface{}{"type": listingAction, "url": "https://www.amazon.es/s?k=movil", "selector": ".price", "item_selector": ".item"},
+			expectedSelector:     ".price",
+			expectedItemSelector: ".item",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			tc.body["from"] = "alice-phone"
+			rec := request(e, http.MethodPost, "/v1/actions", token("alice"), tc.body)
+			assert.Equal(tt, http.StatusOK, rec.Code, rec.Body.String())
+			at := ActionType(tc.body["type"].(string))
+			action := &Action{Type: at, From: "alice-phone", URL: tc.body["url"].(string)}
+			stored, err := loadAction(at, action.key())
+			assert.NoError(tt, err)
+			if assert.NotNil(tt, stored) {
+				assert.Equal(tt, tc.expectedSelector, stored.Selector)
+				assert.Equal(tt, tc.expectedItemSelector, stored.ItemSelector)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// apiKeysBucket is the bucket where the API keys of the users are stored,
+	// under the hash of the key
+	apiKeysBucket = "api_keys"
+
+	// apiKeyHeader is the header carrying the API key of a request. API keys
+	// are also accepted as bearer tokens.
+	apiKeyHeader = "X-API-Key"
+	// apiKeyPrefix is the prefix of every API key, which tells them apart from
+	// JWT tokens
+	apiKeyPrefix = "hzn_"
+	// apiKeyContextKey is the key of the API key of a request in its context
+	apiKeyContextKey = "api_key"
+
+	// scopeRead allows API keys to make GET requests
+	scopeRead = "read"
+	// scopeWrite allows API keys to make any other request
+	scopeWrite = "write"
+)
+
+// apiKeyMutex prevents concurrent requests from overwriting the last time an
+// API key was used
+var apiKeyMutex sync.Mutex
+
+// APIKey is a key a user authenticates with instead of a JWT token. Only the
+// hash of the key is stored.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreatedAPIKey is an API key together with the key itself, which is only
+// returned when it's created
+type CreatedAPIKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+// isValidScope checks whether the scope of an API key is valid or not
+func isValidScope(scope string) bool {
+	return scope == scopeRead || scope == scopeWrite
+}
+
+// hasScope returns true if the API key has the scope
+func (k *APIKey) hasScope(scope string) bool {
+	return containsString(k.Scopes, scope)
+}
+
+// randomHex returns n random bytes encoded in hexadecimal
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// requestAPIKey returns the API key of a request, either in its header or as
+// a bearer token, or an empty string if there isn't any
+func requestAPIKey(c echo.Context) string {
+	if key := c.Request().Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	token := strings.TrimPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+// requestScope returns the scope an API key needs for a request
+func requestScope(c echo.Context) string {
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead:
+		return scopeRead
+	}
+	return scopeWrite
+}
+
+// loadAPIKeys returns the API keys stored in the database, indexed by the
+// hash of the key
+func loadAPIKeys() (map[string]*APIKey, error) {
+	results, err := db.GetAll(apiKeysBucket)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*APIKey, len(results))
+	for hash, value := range results {
+		k := &APIKey{}
+		if err = json.Unmarshal([]byte(value), k); err != nil {
+			return nil, err
+		}
+		keys[hash] = k
+	}
+	return keys, nil
+}
+
+// saveAPIKey stores an API key in the database, under the hash of the key
+func saveAPIKey(hash string, k *APIKey) error {
+	value, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	return db.Save(hash, string(value), apiKeysBucket)
+}
+
+// useAPIKey returns the API key stored for a key, recording the time it was
+// used, or nil if the key doesn't exist or was revoked
+func useAPIKey(key string) (*APIKey, error) {
+	apiKeyMutex.Lock()
+	defer apiKeyMutex.Unlock()
+
+	hash := hashSecret(key)
+	value, err := db.Get(hash, apiKeysBucket)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	k := &APIKey{}
+	if err = json.Unmarshal([]byte(value), k); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	k.LastUsedAt = &now
+	return k, saveAPIKey(hash, k)
+}
+
+// apiKeyAuth authenticates the requests carrying an API key, checking that
+// its scopes allow them. Requests without API keys are left to the JWT
+// middleware.
+func apiKeyAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := requestAPIKey(c)
+		if key == "" {
+			return next(c)
+		}
+		k, err := useAPIKey(key)
+		if err != nil {
+			return err
+		}
+		if k == nil {
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid api key")
+		}
+		if scope := requestScope(c); !k.hasScope(scope) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("the api key doesn't have the %s scope", scope))
+		}
+		c.Set(apiKeyContextKey, k)
+		return next(c)
+	}
+}
+
+// usesAPIKey returns true if a request is authenticated with an API key
+func usesAPIKey(c echo.Context) bool {
+	_, ok := c.Get(apiKeyContextKey).(*APIKey)
+	return ok
+}
+
+// postAPIKeys will allow users to create an API key. The key is only returned
+// in the response, so it must be kept by the user.
+func postAPIKeys(c echo.Context) error {
+	if usesAPIKey(c) {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"api keys can't manage api keys"})
+	}
+	k := &APIKey{}
+	if err := c.Bind(k); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid api key: %s", err.Error())})
+	}
+	if k.Name == "" || len(k.Scopes) == 0 {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid api key: name and scopes are required"})
+	}
+	for _, scope := range k.Scopes {
+		if !isValidScope(scope) {
+			return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid scope: %s", scope)})
+		}
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return err
+	}
+	key := apiKeyPrefix + secret
+	k.ID, k.UserID, k.CreatedAt, k.LastUsedAt = id, user.ID, time.Now().UTC(), nil
+
+	sugar.Infow("creating api key", "id", k.ID, "user", user.ID, "name", k.Name, "scopes", k.Scopes)
+	if err = saveAPIKey(hashSecret(key), k); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, &CreatedAPIKey{APIKey: k, Key: key})
+}
+
+// getAPIKeys returns the API keys of the user making the request
+func getAPIKeys(c echo.Context) error {
+	if usesAPIKey(c) {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"api keys can't manage api keys"})
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	keys, err := loadAPIKeys()
+	if err != nil {
+		return err
+	}
+	owned := []*APIKey{}
+	for _, k := range keys {
+		if k.UserID == user.ID {
+			owned = append(owned, k)
+		}
+	}
+	return c.JSON(http.StatusOK, owned)
+}
+
+// deleteAPIKeys will allow users to revoke one of their API keys
+func deleteAPIKeys(c echo.Context) error {
+	if usesAPIKey(c) {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"api keys can't manage api keys"})
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	keys, err := loadAPIKeys()
+	if err != nil {
+		return err
+	}
+	id := c.Param("id")
+	for hash, k := range keys {
+		if k.ID == id && k.UserID == user.ID {
+			sugar.Infow("revoking api key", "id", k.ID, "user", user.ID, "name", k.Name)
+			return db.Delete(hash, apiKeysBucket)
+		}
+	}
+	return c.JSON(http.StatusNotFound, &ResponseMessage{"api key not found"})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeys(t *testing.T) {
+	setUp(t)
+	e := newServer()
+	verify(t, "alice", "alice-phone")
+	action := map[string]interface{}{"type": availabilityAction, "from": "alice-phone", "url": "https://www.amazon.es/dp/B01"}
+
+	rec := request(e, http.MethodPost, "/v1/api_keys", token("alice"), &APIKey{Name: "reader", Scopes: []string{scopeRead}})
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	created := &CreatedAPIKey{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), created))
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		body     interface{}
+		expected int
+	}{
+		{name: "read", method: http.MethodGet, path: "/v1/actions", expected: http.StatusOK},
+		{name: "write without the write scope", method: http.MethodPost, path: "/v1/actions", body: action, expected: http.StatusForbidden},
+		{name: "managing api keys", method: http.MethodGet, path: "/v1/api_keys", expected: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			rec := request(e, tc.method, tc.path, created.Key, tc.body)
+			assert.Equal(tt, tc.expected, rec.Code, rec.Body.String())
+		})
+	}
+
+	// The key acts as its user
+	rec = request(e, http.MethodGet, "/v1/user", created.Key, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	user := &User{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), user))
+	assert.Equal(t, "alice", user.ID)
+
+	// Keys can only be revoked by their user
+	rec = request(e, http.MethodDelete, "/v1/api_keys/"+created.ID, token("bob"), nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = request(e, http.MethodDelete, "/v1/api_keys/"+created.ID, token("alice"), nil)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = request(e, http.MethodGet, "/v1/actions", created.Key, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/igvaquero18/hermezon/jwks"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// jwtContextKey is the key of the JWT token of a request in its context
+const jwtContextKey = "user"
+
+// keySet holds the keys of the identity provider the RS256 and ES256 tokens
+// are verified with. It's nil when no JWKS is configured.
+var keySet *jwks.KeySet
+
+// newKeySet returns the key set of the identity provider, loaded from its URL
+// when it's set, and from the file otherwise. A nil key set is returned when
+// none of them are configured.
+func newKeySet() *jwks.KeySet {
+	opts := []jwks.Option{
+		jwks.SetRefreshInterval(jwksRefreshInterval),
+		jwks.SetLogger(sugar),
+	}
+	switch {
+	case jwksURL != "":
+		return jwks.NewHTTPKeySet(jwksURL, opts...)
+	case jwksFilePath != "":
+		return jwks.NewFileKeySet(jwksFilePath, opts...)
+	}
+	return nil
+}
+
+// tokenKey returns the key a JWT token is verified with: the JWT secret for
+// HS256 tokens, and a key of the JWKS for RS256 and ES256 ones
+func tokenKey(t *jwt.Token) (interface{}, error) {
+	if t.Method == jwt.SigningMethodHS256 && jwtSecret != "" {
+		return []byte(jwtSecret), nil
+	}
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok && keySet != nil {
+		return keySet.Keyfunc(t)
+	}
+	return nil, fmt.Errorf("unexpected jwt signing method=%v", t.Header["alg"])
+}
+
+// isKeySetToken returns true if a verified JWT token was issued by the
+// identity provider, instead of being signed with the JWT secret
+func isKeySetToken(t *jwt.Token) bool {
+	_, hmac := t.Method.(*jwt.SigningMethodHMAC)
+	return !hmac
+}
+
+// checkKeySetClaims checks the claims of the tokens of the identity provider,
+// which must expire and have the issuer and audience when they are configured
+func checkKeySetClaims(claims jwt.MapClaims) error {
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return fmt.Errorf("the token has no expiration")
+	}
+	return jwks.CheckClaims(claims, jwtAudience, jwtIssuer)
+}
+
+// jwtAuth authenticates the requests carrying a JWT token. The tokens of the
+// identity provider must expire, and their issuer and audience are checked
+// when they are configured. Requests authenticated with an API key are
+// skipped.
+func jwtAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if usesAPIKey(c) {
+			return next(c)
+		}
+		auth := c.Request().Header.Get(echo.HeaderAuthorization)
+		if !strings.HasPrefix(auth, "Bearer ") {
+			return middleware.ErrJWTMissing
+		}
+		token, err := jwt.Parse(strings.TrimPrefix(auth, "Bearer "), tokenKey)
+		if err == nil && isKeySetToken(token) {
+			err = checkKeySetClaims(token.Claims.(jwt.MapClaims))
+		}
+		if err != nil || !token.Valid {
+			sugar.Debugw("invalid jwt", "msg", fmt.Sprint(err))
+			return &echo.HTTPError{
+				Code:     http.StatusUnauthorized,
+				Message:  "invalid or expired jwt",
+				Internal: err,
+			}
+		}
+		c.Set(jwtContextKey, token)
+		return next(c)
+	}
+}
+
+// tokenClaims returns the claims of the JWT token of a request, or nil if it
+// isn't authenticated with one
+func tokenClaims(c echo.Context) jwt.MapClaims {
+	token, ok := c.Get(jwtContextKey).(*jwt.Token)
+	if !ok {
+		return nil
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	return claims
+}
+
+// tokenUser returns the ID of the user authenticated by the JWT token of a
+// request. The users of the identity provider are prefixed by its issuer, so
+// they can't take over the ones of the tokens signed with the JWT secret.
+func tokenUser(c echo.Context) string {
+	token, ok := c.Get(jwtContextKey).(*jwt.Token)
+	if !ok {
+		return ""
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	id, _ := claims[jwtUserClaim].(string)
+	if id == "" || !isKeySetToken(token) {
+		return id
+	}
+	issuer, _ := claims["iss"].(string)
+	return fmt.Sprintf("%s|%s", issuer, id)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/igvaquero18/hermezon/jwks"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testIssuer   = "https://id.example.com/"
+	testAudience = "hermezon"
+)
+
+var idpKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+// useKeySet makes the service verify the tokens of the identity provider with
+// the public key of idpKey
+func useKeySet(t *testing.T) {
+	encode := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	body, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "idp",
+		"use": "sig",
+		"alg": "RS256",
+		"n":   encode(idpKey.N),
+		"e":   encode(big.NewInt(int64(idpKey.E))),
+	}}})
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, ioutil.WriteFile(path, body, 0600))
+	keySet = jwks.NewFileKeySet(path)
+	assert.NoError(t, keySet.Refresh())
+}
+
+// signToken returns a token with the claims, signed with the key
+func signToken(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = "idp"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func TestJWTAuth(t *testing.T) {
+	setUp(t)
+	useKeySet(t)
+	jwtAudience, jwtIssuer = testAudience, testIssuer
+	e := newServer()
+
+	exp := time.Now().Add(time.Hour).Unix()
+	publicKey, err := x509.MarshalPKIXPublicKey(&idpKey.PublicKey)
+	assert.NoError(t, err)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+
+	testCases := []struct {
+		name   string
+		secret string
+		token  string
+		user   string
+	}{
+		{
+			name:   "token of the identity provider",
+			secret: testJWTSecret,
+			token:  signToken(jwt.SigningMethodRS256, idpKey, jwt.MapClaims{"sub": "alice", "iss": testIssuer, "aud": testAudience, "exp": exp}),
+			user:   testIssuer + "|alice",
+		},
+		{
+			name:   "token signed with the jwt secret, without issuer nor audience",
+			secret: testJWTSecret,
+			token:  token("alice"),
+			user:   "alice",
+		},
+		{
+			name:   "another audience",
+			secret: testJWTSecret,
+			token:  signToken(jwt.SigningMethodRS256, idpKey, jwt.MapClaims{"sub": "alice", "iss": testIssuer, "aud": "other", "exp": exp}),
+		},
+		{
+			name:   "another issuer",
+			secret: testJWTSecret,
+			token:  signToken(jwt.SigningMethodRS256, idpKey, jwt.MapClaims{"sub": "alice", "iss": "https://evil.example.com/", "aud": testAudience, "exp": exp}),
+		},
+		{
+			name:   "token of the identity provider without expiration",
+			secret: testJWTSecret,
+			token:  signToken(jwt.SigningMethodRS256, idpKey, jwt.MapClaims{"sub": "alice", "iss": testIssuer, "aud": testAudience}),
+		},
+		{
+			name:   "expired token of the identity provider",
+			secret: testJWTSecret,
+			token:  signToken(jwt.SigningMethodRS256, idpKey, jwt.MapClaims{"sub": "alice", "iss": testIssuer, "aud": testAudience, "exp": time.Now().Add(-time.Hour).Unix()}),
+		},
+		{
+			name:   "HS256 token signed with the public key of the identity provider",
+			secret: testJWTSecret,
+			token:  signToken(jwt.SigningMethodHS256, publicPEM, jwt.MapClaims{"sub": "alice", "iss": testIssuer, "aud": testAudience, "exp": exp}),
+		},
+		{
+			name:  "HS256 token signed with the public key of the identity provider, without jwt secret",
+			token: signToken(jwt.SigningMethodHS256, publicPEM, jwt.MapClaims{"sub": "alice", "iss": testIssuer, "aud": testAudience, "exp": exp}),
+		},
+		{
+			name:   "HS256 token signed with the modulus of the identity provider",
+			secret: testJWTSecret,
+			token:  signToken(jwt.SigningMethodHS256, idpKey.N.Bytes(), jwt.MapClaims{"sub": "alice", "iss": testIssuer, "aud": testAudience, "exp": exp}),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			jwtSecret = tc.secret
+			rec := request(e, http.MethodGet, "/v1/user", tc.token, nil)
+			if tc.user == "" {
+				assert.Equal(tt, http.StatusUnauthorized, rec.Code, rec.Body.String())
+				return
+			}
+			assert.Equal(tt, http.StatusOK, rec.Code, rec.Body.String())
+			user := &User{}
+			assert.NoError(tt, json.Unmarshal(rec.Body.Bytes(), user))
+			assert.Equal(tt, tc.user, user.ID)
+		})
+	}
+}
+
+func TestJWTAuthTakeover(t *testing.T) {
+	setUp(t)
+	useKeySet(t)
+	e := newServer()
+	verify(t, "alice", "alice-phone")
+
+	// Users of the identity provider can't act as the users of the tokens
+	// signed with the jwt secret, even with the same subject
+	idpToken := signToken(jwt.SigningMethodRS256, idpKey, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+	rec := request(e, http.MethodGet, "/v1/notifications?from=alice-phone", idpToken, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+	rec = request(e, http.MethodGet, "/v1/notifications?from=alice-phone", token("alice"), nil)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestTokenKey(t *testing.T) {
+	setUp(t)
+
+	// Without a key set, only HS256 tokens signed with the jwt secret are
+	// accepted
+	_, err := jwt.Parse(signToken(jwt.SigningMethodRS256, idpKey, jwt.MapClaims{}), tokenKey)
+	assert.Error(t, err)
+	_, err = jwt.Parse(signToken(jwt.SigningMethodHS384, []byte(testJWTSecret), jwt.MapClaims{}), tokenKey)
+	assert.Error(t, err)
+	_, err = jwt.Parse(signToken(jwt.SigningMethodHS256, []byte(testJWTSecret), jwt.MapClaims{}), tokenKey)
+	assert.NoError(t, err)
+
+	// Without a jwt secret, HMAC tokens are refused whatever their key
+	useKeySet(t)
+	jwtSecret = ""
+	_, err = jwt.Parse(signToken(jwt.SigningMethodHS256, []byte(""), jwt.MapClaims{}), tokenKey)
+	assert.Error(t, err)
+	_, err = jwt.Parse(signToken(jwt.SigningMethodRS256, idpKey, jwt.MapClaims{}), tokenKey)
+	assert.NoError(t, err)
+}
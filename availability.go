@@ -1,10 +1,10 @@
 package main
 
 import (
-	"fmt"
-	"strings"
+	"errors"
 
 	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/igvaquero18/hermezon/templates"
 )
 
 type availability struct{}
@@ -13,26 +13,24 @@ type availability struct{}
 // availability in the corresponding store
 func (a availability) Run() {
 	sugar.Debug("checking all products for availability")
-	results, err := db.GetAll(availabilityAction)
+	actions, err := loadActions(availabilityAction)
 	if err != nil {
 		sugar.Fatalw("error when reading the database", "msg", err.Error())
 	}
-	for k, v := range results {
+	for k, action := range actions {
 		databaseKey := k
-		keys := strings.Split(databaseKey, "|")
-		values := strings.Split(v, "|")
-		if len(keys) < 2 || len(values) < 2 {
-			sugar.Fatalw("invalid keys and/or values returned from database.", "keys", keys, "values", values)
-		}
-		channel := keys[0]
-		url := keys[1]
-		selector := values[0]
-		findText := values[1]
+		action := action
+		channel := action.From
+		url := action.URL
+		selector := action.Selector
+		findText := action.FindText
 		sugar.Debugw("checking product availability for customer",
 			"channel", channel,
 			"url", url,
 			"selector", selector,
 			"find_text", findText,
+			"json_path", action.JSONPath,
+			"variant", action.Variant,
 		)
 
 		// Build the scraper
@@ -42,36 +40,84 @@ func (a availability) Run() {
 			scraper.SetMaxRetries(maxRetries),
 			scraper.SetRetrySeconds(retrySeconds),
 			scraper.SetSelector(selector),
+			scraper.SetJSONPath(action.JSONPath),
+			scraper.SetVariant(action.Variant),
+			scraper.SetVariantParam(action.VariantParam),
 			scraper.SetFindText(findText),
 			scraper.SetURL(url),
 		)
 
 		go func() {
-			productAvailable, err := scr.IsAvailable()
+			product, err := scr.Product()
 			if err != nil {
 				sugar.Errorw("error when checking availability", "channel", channel, "url", url, "msg", err.Error())
 				return
 			}
-			if productAvailable {
-				sugar.Debugw("Product is available!", "channel", channel, "url", url)
-				err = messagingClient.SendMessage(
-					"Product is available!",
-					fmt.Sprintf("URL: %s", url),
-					twilioPhone,
-					channel,
-				)
-				if err != nil {
-					sugar.Errorw("error when sending message", "msg", err.Error())
-					return
-				}
-				err = db.Delete(databaseKey, availabilityAction)
-				if err != nil {
-					sugar.Fatalw("error when reading the database", "msg", err.Error())
-				}
-				sugar.Debugw("deleted key from bucket", "key", databaseKey, "bucket", availabilityAction)
-				return
-			}
-			sugar.Debugw("Product is sold out...", "channel", channel, "url", url)
+			productURL, _ := scr.ProductURL()
+			checkAvailability(databaseKey, action, productURL, product)
 		}()
 	}
 }
+
+// checkAvailability saves the facts of the product of an availability
+// action and notifies it once it's available. Notified actions are deleted,
+// unless they are in digest mode.
+func checkAvailability(databaseKey string, action *Action, productURL string, product *scraper.Product) {
+	channel, url := action.From, action.URL
+	previous, err := loadFacts(factsKey(availabilityAction, databaseKey))
+	if err != nil {
+		sugar.Errorw("error when reading product facts", "key", databaseKey, "msg", err.Error())
+	}
+	if err = saveFacts(factsKey(availabilityAction, databaseKey), product); err != nil {
+		sugar.Errorw("error when saving product facts", "key", databaseKey, "msg", err.Error())
+	}
+	trackChanges(action, productURL, previous, product)
+	if !product.Available {
+		sugar.Debugw("Product is sold out...", "channel", channel, "url", url)
+		return
+	}
+	if !action.meetsStockConditions(product) {
+		sugar.Debugw("Product is available, but stock conditions are not met...",
+			"channel", channel,
+			"url", url,
+			"quantity", product.Quantity,
+			"delivery_date", product.DeliveryDate,
+		)
+		return
+	}
+	if !action.meetsOfferConditions(product) {
+		sugar.Debugw("Product is available, but the offer doesn't meet the conditions...",
+			"channel", channel,
+			"url", url,
+			"seller", product.Seller,
+			"fulfillment", product.Fulfillment,
+			"condition", product.Condition,
+		)
+		return
+	}
+	sugar.Debugw("Product is available!", "channel", channel, "url", url)
+	err = notify(templates.EventAvailability, action.Channel, channel, action.Locale, &templates.Data{
+		Product:  product,
+		URL:      productURL,
+		Tracking: action,
+		Priority: action.Priority,
+		Tags:     action.Tags,
+	})
+	if errors.Is(err, errSuppressed) {
+		sugar.Debugw("Notification suppressed. Keeping the action until it's delivered...", "channel", channel, "url", url)
+		return
+	}
+	if err != nil {
+		sugar.Errorw("error when queueing notification", "msg", err.Error())
+		return
+	}
+	if digestOf(action) != nil {
+		sugar.Debugw("Notification added to the digest. Keeping the action...", "channel", channel, "url", url)
+		return
+	}
+	err = deleteAction(availabilityAction, databaseKey)
+	if err != nil {
+		sugar.Fatalw("error when reading the database", "msg", err.Error())
+	}
+	sugar.Debugw("deleted key from bucket", "key", databaseKey, "bucket", availabilityAction)
+}
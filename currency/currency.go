@@ -0,0 +1,239 @@
+package currency
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/igvaquero18/hermezon/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultTTL is the default time rates are kept in the cache
+	DefaultTTL = 12 * time.Hour
+
+	// ratesBucket is the bucket where the cached rates are stored
+	ratesBucket = "rates"
+)
+
+// RateProvider is an interface for getting the exchange rate between two
+// currencies, identified by their ISO 4217 code
+type RateProvider interface {
+	// Rate returns how many units of the currency to are worth one unit of
+	// the currency from
+	Rate(from, to string) (float64, error)
+}
+
+// Storage is an interface for the key-value storage where rates are cached
+type Storage interface {
+	// Save saves a key-value pair to the database, at a particular bucket
+	Save(key, value, bucket string) error
+	// Get gets a value from a key
+	Get(key, bucket string) (string, error)
+}
+
+// Convert converts an amount from one currency to another
+func Convert(provider RateProvider, amount float64, from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return amount, nil
+	}
+	rate, err := provider.Rate(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return amount * rate, nil
+}
+
+// Table is a table of exchange rates relative to a base currency, in the
+// format used by most exchange rates APIs:
+//
+//	{"base": "EUR", "rates": {"GBP": 0.86, "USD": 1.21}}
+type Table struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// Rate returns the exchange rate between two currencies of the table,
+// crossing them through its base currency when needed
+func (t *Table) Rate(from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	fromRate, err := t.baseRate(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := t.baseRate(to)
+	if err != nil {
+		return 0, err
+	}
+	return toRate / fromRate, nil
+}
+
+// baseRate returns how many units of a currency are worth one unit of the
+// base currency of the table
+func (t *Table) baseRate(currency string) (float64, error) {
+	if currency == strings.ToUpper(t.Base) {
+		return 1, nil
+	}
+	rate, ok := t.Rates[currency]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("no exchange rate for %s", currency)
+	}
+	return rate, nil
+}
+
+// decodeTable decodes a table of exchange rates
+func decodeTable(r io.Reader) (*Table, error) {
+	table := &Table{}
+	if err := json.NewDecoder(r).Decode(table); err != nil {
+		return nil, errors.Wrap(err, "error when decoding exchange rates")
+	}
+	if table.Base == "" {
+		return nil, fmt.Errorf("exchange rates without base currency")
+	}
+	rates := make(map[string]float64, len(table.Rates))
+	for currency, rate := range table.Rates {
+		rates[strings.ToUpper(currency)] = rate
+	}
+	table.Rates = rates
+	return table, nil
+}
+
+// NewStaticProvider returns a RateProvider with the exchange rates of a
+// table stored in a JSON file
+func NewStaticProvider(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeTable(f)
+}
+
+// HTTPProvider is a RateProvider that fetches a table of exchange rates
+// from an HTTP endpoint on every call
+type HTTPProvider struct {
+	url    string
+	client *http.Client
+}
+
+// HTTPOption is a function to apply settings to HTTPProvider structure
+type HTTPOption func(p *HTTPProvider) HTTPOption
+
+// NewHTTPProvider returns a new HTTPProvider for the given URL, which must
+// answer with a table of exchange rates
+func NewHTTPProvider(url string, opts ...HTTPOption) *HTTPProvider {
+	p := &HTTPProvider{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// SetHTTPClient Sets the HTTP client for HTTPProvider
+func SetHTTPClient(client *http.Client) HTTPOption {
+	return func(p *HTTPProvider) HTTPOption {
+		prev := p.client
+		p.client = client
+		return SetHTTPClient(prev)
+	}
+}
+
+// Rate fetches the table of exchange rates and returns the exchange rate
+// between two currencies
+func (p *HTTPProvider) Rate(from, to string) (float64, error) {
+	resp, err := p.client.Get(p.url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return 0, fmt.Errorf("exchange rates response status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+	table, err := decodeTable(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	return table.Rate(from, to)
+}
+
+// CachedProvider is a RateProvider that caches the rates of another provider
+// in a Storage, so they survive restarts
+type CachedProvider struct {
+	provider RateProvider
+	storage  Storage
+	ttl      time.Duration
+	utils.Logger
+}
+
+// cachedRate is a rate stored in the cache
+type cachedRate struct {
+	Rate      float64   `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewCachedProvider returns a new CachedProvider which keeps the rates of
+// provider in storage for ttl. If logger is nil, a logger with basic
+// capabilities will be used instead.
+func NewCachedProvider(provider RateProvider, storage Storage, ttl time.Duration, logger utils.Logger) *CachedProvider {
+	if logger == nil {
+		logger = &utils.DefaultLogger{}
+	}
+	return &CachedProvider{
+		provider: provider,
+		storage:  storage,
+		ttl:      ttl,
+		Logger:   logger,
+	}
+}
+
+// Rate returns the cached rate between two currencies, asking the provider
+// for it when it's not cached or expired. Expired rates are still returned
+// when the provider fails.
+func (p *CachedProvider) Rate(from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	key := fmt.Sprintf("%s|%s", from, to)
+
+	var cached *cachedRate
+	if value, err := p.storage.Get(key, ratesBucket); err != nil {
+		p.Errorw("error when reading cached rate", "key", key, "msg", err.Error())
+	} else if value != "" {
+		cached = &cachedRate{}
+		if err = json.Unmarshal([]byte(value), cached); err != nil {
+			p.Errorw("invalid cached rate", "key", key, "msg", err.Error())
+			cached = nil
+		}
+	}
+	if cached != nil && time.Since(cached.UpdatedAt) < p.ttl {
+		return cached.Rate, nil
+	}
+
+	rate, err := p.provider.Rate(from, to)
+	if err != nil {
+		if cached != nil {
+			p.Errorw("error when refreshing rate, using expired one", "key", key, "msg", err.Error())
+			return cached.Rate, nil
+		}
+		return 0, err
+	}
+
+	value, err := json.Marshal(&cachedRate{Rate: rate, UpdatedAt: time.Now()})
+	if err == nil {
+		err = p.storage.Save(key, string(value), ratesBucket)
+	}
+	if err != nil {
+		p.Errorw("error when caching rate", "key", key, "msg", err.Error())
+	}
+	p.Debugw("refreshed exchange rate", "from", from, "to", to, "rate", rate)
+	return rate, nil
+}
@@ -0,0 +1,144 @@
+package currency
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/igvaquero18/hermezon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+const rates = `{"base": "EUR", "rates": {"gbp": 0.8, "USD": 1.25}}`
+
+type memoryStorage map[string]string
+
+func (m memoryStorage) Save(key, value, bucket string) error {
+	m[bucket+"/"+key] = value
+	return nil
+}
+
+func (m memoryStorage) Get(key, bucket string) (string, error) {
+	return m[bucket+"/"+key], nil
+}
+
+type countingProvider struct {
+	rate  float64
+	err   error
+	calls int
+}
+
+func (p *countingProvider) Rate(from, to string) (float64, error) {
+	p.calls++
+	return p.rate, p.err
+}
+
+func TestConvert(t *testing.T) {
+	table := &Table{Base: "EUR", Rates: map[string]float64{"GBP": 0.8, "USD": 1.25}}
+
+	testCases := []struct {
+		name, from, to string
+		amount         float64
+		expected       float64
+		err            bool
+	}{
+		{name: "same currency", from: "eur", to: "EUR", amount: 100, expected: 100},
+		{name: "from base currency", from: "EUR", to: "GBP", amount: 100, expected: 80},
+		{name: "to base currency", from: "GBP", to: "EUR", amount: 80, expected: 100},
+		{name: "cross rate", from: "GBP", to: "USD", amount: 80, expected: 125},
+		{name: "unknown currency", from: "JPY", to: "EUR", amount: 100, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			actual, err := Convert(table, tc.amount, tc.from, tc.to)
+			if tc.err {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+				assert.InDelta(tt, tc.expected, actual, 0.0001)
+			}
+		})
+	}
+}
+
+func TestNewStaticProvider(t *testing.T) {
+	f, err := ioutil.TempFile("", "rates*.json")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(rates)
+	assert.NoError(t, err)
+	f.Close()
+
+	table, err := NewStaticProvider(f.Name())
+	assert.NoError(t, err)
+	rate, err := table.Rate("usd", "gbp")
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.64, rate, 0.0001)
+
+	_, err = NewStaticProvider("non_existing_rates.json")
+	assert.Error(t, err)
+}
+
+func TestHTTPProvider(t *testing.T) {
+	testCases := []struct {
+		name       string
+		statusCode int
+		body       string
+		expected   float64
+		err        bool
+	}{
+		{name: "valid rates", statusCode: http.StatusOK, body: rates, expected: 0.8},
+		{name: "rates without base", statusCode: http.StatusOK, body: `{"rates": {"GBP": 0.8}}`, err: true},
+		{name: "invalid rates", statusCode: http.StatusOK, body: `<html></html>`, err: true},
+		{name: "unexpected status code", statusCode: http.StatusTooManyRequests, body: `{}`, err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.statusCode)
+				fmt.Fprint(w, tc.body)
+			}))
+			defer server.Close()
+
+			provider := NewHTTPProvider(server.URL, SetHTTPClient(server.Client()))
+			actual, err := provider.Rate("EUR", "GBP")
+			if tc.err {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+				assert.Equal(tt, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCachedProvider(t *testing.T) {
+	storage := memoryStorage{}
+	provider := &countingProvider{rate: 0.8}
+	cached := NewCachedProvider(provider, storage, time.Hour, &utils.DefaultLogger{})
+
+	for i := 0; i < 3; i++ {
+		rate, err := cached.Rate("eur", "gbp")
+		assert.NoError(t, err)
+		assert.Equal(t, 0.8, rate)
+	}
+	assert.Equal(t, 1, provider.calls)
+
+	// Expired rates are refreshed, and still used when refreshing fails
+	storage.Save("EUR|GBP", fmt.Sprintf(`{"rate": 0.9, "updated_at": "%s"}`, time.Now().Add(-2*time.Hour).Format(time.RFC3339)), ratesBucket)
+	provider.err = fmt.Errorf("provider down")
+	rate, err := cached.Rate("EUR", "GBP")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.9, rate)
+	assert.Equal(t, 2, provider.calls)
+
+	// Rates that were never cached can't be used when the provider fails
+	_, err = cached.Rate("EUR", "USD")
+	assert.Error(t, err)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/igvaquero18/hermezon/templates"
+)
+
+const (
+	// digestsBucket is the bucket where the changes waiting for the next
+	// digest of every user are stored, under its period and owner, or its
+	// period, channel and from for actions and groups without owner
+	digestsBucket = "digests"
+
+	dailyDigest  = "daily"
+	weeklyDigest = "weekly"
+)
+
+// digestMutex prevents changes added while a digest is being sent from
+// being lost
+var digestMutex sync.Mutex
+
+// digest holds the changes of the products tracked in digest mode by a
+// user, until they are sent to the destination of the action or group which
+// added the last one
+type digest struct {
+	Period  string             `json:"period"`
+	Owner   string             `json:"owner,omitempty"`
+	Channel string             `json:"channel"`
+	From    string             `json:"from"`
+	Locale  string             `json:"locale,omitempty"`
+	Changes []templates.Change `json:"changes"`
+	// Lowest is the lowest price seen for every URL, for telling new lows
+	Lowest map[string]float64 `json:"lowest,omitempty"`
+}
+
+// isValidDigest checks whether the digest mode of an action or group is
+// valid or not. An empty digest mode means notifications are sent right
+// away.
+func isValidDigest(period string) bool {
+	return period == "" || period == dailyDigest || period == weeklyDigest
+}
+
+// digestOf returns the digest the notifications of an action or group are
+// added to, or nil if they are sent right away
+func digestOf(tracking interface{}) *digest {
+	switch t := tracking.(type) {
+	case *Action:
+		if t.Digest != "" {
+			return &digest{Period: t.Digest, Owner: t.Owner, Channel: t.Channel, From: t.From, Locale: t.Locale}
+		}
+	case *Group:
+		if t.Digest != "" {
+			return &digest{Period: t.Digest, Owner: t.Owner, Channel: t.Channel, From: t.From, Locale: t.Locale}
+		}
+	}
+	return nil
+}
+
+// key returns the key under which the digest is stored in the database
+func (d *digest) key() string {
+	if d.Owner != "" {
+		return fmt.Sprintf("%s|%s", d.Period, d.Owner)
+	}
+	channel := d.Channel
+	if channel == "" {
+		channel = defaultChannel
+	}
+	return fmt.Sprintf("%s|%s|%s", d.Period, channel, d.From)
+}
+
+// updateDigest applies a change to the stored version of a digest
+func updateDigest(d *digest, update func(stored *digest)) error {
+	digestMutex.Lock()
+	defer digestMutex.Unlock()
+
+	stored := d
+	value, err := db.Get(d.key(), digestsBucket)
+	if err != nil {
+		return err
+	}
+	if value != "" {
+		stored = &digest{}
+		if err = json.Unmarshal([]byte(value), stored); err != nil {
+			return err
+		}
+		stored.Channel, stored.From, stored.Locale = d.Channel, d.From, d.Locale
+	}
+	update(stored)
+	return saveDigest(stored)
+}
+
+// saveDigest stores a digest in the database
+func saveDigest(d *digest) error {
+	value, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return db.Save(d.key(), string(value), digestsBucket)
+}
+
+// add adds a change to a digest, unless the same change is already there
+func (d *digest) add(change templates.Change) {
+	for _, c := range d.Changes {
+		if c.Kind == change.Kind && c.URL == change.URL && c.NewPrice == change.NewPrice {
+			return
+		}
+	}
+	d.Changes = append(d.Changes, change)
+}
+
+// addToDigest adds a notification to the digest of the action or group that
+// triggered it, instead of sending it
+func addToDigest(d *digest, n *notification.Notification) error {
+	title := n.Title
+	if n.Product != nil && n.Product.Title != "" {
+		title = n.Product.Title
+	}
+	sugar.Debugw("adding notification to digest", "event", n.Event, "period", d.Period, "from", d.From)
+	return updateDigest(d, func(stored *digest) {
+		stored.add(templates.Change{
+			Kind:     n.Event,
+			Title:    title,
+			URL:      n.URL,
+			OldPrice: n.OldPrice,
+			NewPrice: n.NewPrice,
+			Currency: n.Currency,
+			At:       n.Timestamp,
+		})
+	})
+}
+
+// trackChanges adds the changes of price and availability of a product since
+// its previous check to the digest of the action or group tracking it, if
+// any. Prices are compared in the price mode and currency of the tracking.
+func trackChanges(tracking interface{}, url string, previous, product *scraper.Product) {
+	d := digestOf(tracking)
+	if d == nil || previous == nil {
+		return
+	}
+	var comparablePrice func(product *scraper.Product) (float64, error)
+	var currency string
+	switch t := tracking.(type) {
+	case *Action:
+		comparablePrice, currency = t.comparablePrice, t.Currency
+	case *Group:
+		comparablePrice, currency = t.comparablePrice, t.Currency
+	}
+	now := time.Now().UTC()
+	changes := []templates.Change{}
+	if previous.Available && !product.Available {
+		changes = append(changes, templates.Change{Kind: templates.ChangeSoldOut, Title: product.Title, URL: url, At: now})
+	}
+	if !previous.Available && product.Available {
+		changes = append(changes, templates.Change{Kind: templates.EventAvailability, Title: product.Title, URL: url, At: now})
+	}
+
+	var oldPrice, newPrice float64
+	if previous.Price > 0 && product.Price > 0 {
+		oldPrice, _ = comparablePrice(previous)
+		newPrice, _ = comparablePrice(product)
+	}
+	if currency == "" {
+		currency = product.Currency
+	}
+	if oldPrice > 0 && newPrice > 0 && oldPrice != newPrice {
+		changes = append(changes, templates.Change{
+			Kind:     templates.ChangePrice,
+			Title:    product.Title,
+			URL:      url,
+			OldPrice: oldPrice,
+			NewPrice: newPrice,
+			Currency: currency,
+			At:       now,
+		})
+	}
+
+	err := updateDigest(d, func(stored *digest) {
+		for _, change := range changes {
+			stored.add(change)
+		}
+		if newPrice <= 0 {
+			return
+		}
+		if stored.Lowest == nil {
+			stored.Lowest = map[string]float64{}
+		}
+		lowest, seen := stored.Lowest[url]
+		if seen && newPrice < lowest {
+			stored.add(templates.Change{Kind: templates.ChangeNewLow, Title: product.Title, URL: url, NewPrice: newPrice, Currency: currency, At: now})
+		}
+		if !seen || newPrice < lowest {
+			stored.Lowest[url] = newPrice
+		}
+	})
+	if err != nil {
+		sugar.Errorw("error when adding changes to digest", "url", url, "msg", err.Error())
+	}
+}
+
+type digester struct {
+	period string
+}
+
+// Run sends the digests of a period with pending changes, through the
+// channel of every customer
+func (dg digester) Run() {
+	sugar.Debugw("sending digests", "period", dg.period)
+	results, err := db.GetAll(digestsBucket)
+	if err != nil {
+		sugar.Errorw("error when reading the digests", "msg", err.Error())
+		return
+	}
+	for key := range results {
+		if err = sendDigest(key, dg.period); err != nil {
+			sugar.Errorw("error when queueing digest", "key", key, "msg", err.Error())
+		}
+	}
+}
+
+// sendDigest notifies the changes of a digest of the given period, emptying
+// it once the notification is queued. Digests of other periods or without
+// changes are skipped, and suppressed ones keep their changes for the next
+// period.
+func sendDigest(key, period string) error {
+	digestMutex.Lock()
+	defer digestMutex.Unlock()
+
+	value, err := db.Get(key, digestsBucket)
+	if err != nil || value == "" {
+		return err
+	}
+	d := &digest{}
+	if err = json.Unmarshal([]byte(value), d); err != nil {
+		return err
+	}
+	if d.Period != period || len(d.Changes) == 0 {
+		return nil
+	}
+	err = notify(templates.EventDigest, d.Channel, d.From, d.Locale, &templates.Data{
+		Period:   d.Period,
+		Changes:  d.Changes,
+		Priority: notification.PriorityLow,
+	})
+	if errors.Is(err, errSuppressed) {
+		sugar.Infow("digest suppressed. Keeping its changes...", "period", d.Period, "from", d.From, "changes", len(d.Changes))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sugar.Debugw("digest queued", "period", d.Period, "from", d.From, "changes", len(d.Changes))
+	d.Changes = nil
+	return saveDigest(d)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/igvaquero18/hermezon/templates"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadDigest returns a digest stored in the database
+func loadDigest(t *testing.T, key string) *digest {
+	value, err := db.Get(key, digestsBucket)
+	assert.NoError(t, err)
+	d := &digest{}
+	assert.NoError(t, json.Unmarshal([]byte(value), d))
+	return d
+}
+
+func TestDigest(t *testing.T) {
+	fake := setUp(t)
+	action := &Action{Type: availabilityAction, From: "alice", Channel: testChannel, URL: "https://www.amazon.es/dp/B01", Digest: dailyDigest}
+	available := func(title string) *templates.Data {
+		return &templates.Data{
+			Product:  &scraper.Product{Title: title, Available: true},
+			URL:      "https://www.amazon.es/dp/" + title,
+			Tracking: action,
+		}
+	}
+	key := digestOf(action).key()
+
+	// Notifications are added to the digest instead of being sent, once
+	assert.NoError(t, notify(templates.EventAvailability, action.Channel, action.From, "", available("Kindle")))
+	assert.NoError(t, notify(templates.EventAvailability, action.Channel, action.From, "", available("Kindle")))
+	assert.NoError(t, notify(templates.EventAvailability, action.Channel, action.From, "", available("Echo")))
+	assert.Len(t, loadDigest(t, key).Changes, 2)
+	assert.Empty(t, fake.messages())
+
+	// Digests of other periods aren't sent
+	assert.NoError(t, sendDigest(key, weeklyDigest))
+	assert.Len(t, loadDigest(t, key).Changes, 2)
+
+	assert.NoError(t, sendDigest(key, dailyDigest))
+	assert.Empty(t, loadDigest(t, key).Changes)
+	messages := fake.messages()
+	if assert.Len(t, messages, 1) {
+		assert.True(t, strings.Contains(messages[0], "Kindle is available"), messages[0])
+		assert.True(t, strings.Contains(messages[0], "Echo is available"), messages[0])
+	}
+
+	// Suppressed digests keep their changes for the next period
+	assert.NoError(t, notify(templates.EventAvailability, action.Channel, action.From, "", available("Kindle")))
+	assert.NoError(t, notify(templates.EventAvailability, action.Channel, action.From, "", available("Echo")))
+	assert.NoError(t, sendDigest(key, dailyDigest))
+	assert.Len(t, loadDigest(t, key).Changes, 2)
+	assert.Len(t, fake.messages(), 1)
+
+	dedupWindow = 0
+	assert.NoError(t, sendDigest(key, dailyDigest))
+	assert.Empty(t, loadDigest(t, key).Changes)
+	assert.Len(t, fake.messages(), 2)
+}
+
+func TestDigestPerOwner(t *testing.T) {
+	testCases := []struct {
+		name     string
+		tracking interface{}
+		expected string
+	}{
+		{name: "action", tracking: &Action{Owner: "alice", From: "alice-phone", Channel: smsChannel, Digest: dailyDigest}, expected: "daily|alice"},
+		{name: "action to another destination", tracking: &Action{Owner: "alice", From: "alice@example.com", Channel: emailChannel, Digest: dailyDigest}, expected: "daily|alice"},
+		{name: "group", tracking: &Group{Owner: "alice", From: "alice-topic", Channel: ntfyChannel, Digest: weeklyDigest}, expected: "weekly|alice"},
+		{name: "action without owner", tracking: &Action{From: "alice-phone", Channel: smsChannel, Digest: dailyDigest}, expected: "daily|sms|alice-phone"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, digestOf(tc.tracking).key())
+		})
+	}
+}
+
+func TestDigestModeActionsKept(t *testing.T) {
+	fake := setUp(t)
+	price := &Action{Owner: "alice", Type: priceAction, From: "alice-phone", Channel: testChannel, URL: "https://www.amazon.es/dp/B01", Price: "500", Digest: dailyDigest}
+	available := &Action{Owner: "alice", Type: availabilityAction, From: "alice-mail", Channel: testChannel, URL: "https://www.amazon.es/dp/B02", Digest: dailyDigest}
+	saveAction(t, price)
+	saveAction(t, available)
+
+	checkPrice(price.key(), price, 500, price.URL, &scraper.Product{Title: "PlayStation 5", Available: true, Price: 479})
+	checkAvailability(available.key(), available, available.URL, &scraper.Product{Title: "Xbox Series X", Available: true})
+	assert.Empty(t, fake.messages())
+	for _, action := range []*Action{price, available} {
+		stored, err := loadAction(action.Type, action.key())
+		assert.NoError(t, err)
+		assert.NotNil(t, stored, action.Type)
+	}
+
+	// Both actions of the user add their notifications to the same digest,
+	// sent to the destination of the last one
+	d := loadDigest(t, "daily|alice")
+	assert.Len(t, d.Changes, 2)
+	assert.Equal(t, "alice-mail", d.From)
+}
+
+func TestTrackChangesGroup(t *testing.T) {
+	setUp(t)
+	group := &Group{Owner: "alice", Name: "ps5", From: "alice-phone", Channel: testChannel, PriceMode: effectivePrice, Digest: weeklyDigest}
+	url := "https://www.amazon.es/dp/B01"
+	previous := &scraper.Product{Title: "PlayStation 5", Available: true, Price: 499.99, Currency: "EUR"}
+	product := &scraper.Product{Title: "PlayStation 5", Available: true, Price: 499.99, Currency: "EUR", Shipping: 5}
+
+	trackChanges(group, url, previous, product)
+	trackChanges(group, url, product, &scraper.Product{Title: "PlayStation 5", Price: 449.99, Currency: "EUR"})
+	changes := loadDigest(t, "weekly|alice").Changes
+	if assert.Len(t, changes, 4) {
+		assert.Equal(t, templates.ChangePrice, changes[0].Kind)
+		assert.Equal(t, 499.99, changes[0].OldPrice)
+		assert.Equal(t, 504.99, changes[0].NewPrice)
+		assert.Equal(t, templates.ChangeSoldOut, changes[1].Kind)
+		assert.Equal(t, templates.ChangePrice, changes[2].Kind)
+		assert.Equal(t, templates.ChangeNewLow, changes[3].Kind)
+		assert.Equal(t, 449.99, changes[3].NewPrice)
+	}
+}
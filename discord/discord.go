@@ -0,0 +1,148 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/utils"
+)
+
+// color is the color of the embeds, Amazon orange
+const color = 0xFF9900
+
+// Client is a struct that implicitly implements the Messenger interface
+// for posting messages to Discord webhooks, whose URL is the destination
+type Client struct {
+	client *http.Client
+	utils.Logger
+}
+
+// Option is a function to apply settings to Client structure
+type Option func(c *Client) Option
+
+// NewClient returns a new Client
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		client: &http.Client{Timeout: 10 * time.Second},
+		Logger: &utils.DefaultLogger{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetHTTPClient Sets the HTTP client for Client
+func SetHTTPClient(client *http.Client) Option {
+	return func(c *Client) Option {
+		prev := c.client
+		c.client = client
+		return SetHTTPClient(prev)
+	}
+}
+
+// SetLogger Sets the Logger for Client
+func SetLogger(logger utils.Logger) Option {
+	return func(c *Client) Option {
+		prev := c.Logger
+		c.Logger = logger
+		return SetLogger(prev)
+	}
+}
+
+// message is the payload of a webhook
+type message struct {
+	Embeds []embed `json:"embeds"`
+}
+
+// embed is a rich content of a message
+type embed struct {
+	Title       string  `json:"title"`
+	Description string  `json:"description,omitempty"`
+	URL         string  `json:"url,omitempty"`
+	Color       int     `json:"color"`
+	Timestamp   string  `json:"timestamp,omitempty"`
+	Image       *image  `json:"image,omitempty"`
+	Fields      []field `json:"fields,omitempty"`
+}
+
+// image is the image of an embed
+type image struct {
+	URL string `json:"url"`
+}
+
+// field is a field of an embed
+type field struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// Send posts a notification to the webhook at its recipient, as an embed
+// with its title, price, image and links, linking to the product
+func (c *Client) Send(n *notification.Notification) error {
+	c.Debugw("sending message to Discord", "event", n.Event)
+	payload, err := json.Marshal(newMessage(n))
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Post(n.Recipient, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Discord response status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// newMessage builds the message of a notification. Embeds link to a single
+// URL, so the rest of the links are listed in a field.
+func newMessage(n *notification.Notification) *message {
+	e := embed{
+		Title:       truncate(n.Title, 256),
+		Description: truncate(n.Message, 4096),
+		URL:         n.URL,
+		Color:       color,
+	}
+	if !n.Timestamp.IsZero() {
+		e.Timestamp = n.Timestamp.UTC().Format(time.RFC3339)
+	}
+	if n.Image != "" {
+		e.Image = &image{URL: n.Image}
+	}
+	if n.NewPrice > 0 {
+		price := fmt.Sprintf("**%s**", n.Price())
+		if n.OldPrice > n.NewPrice {
+			price = fmt.Sprintf("~~%.2f~~ %s", n.OldPrice, price)
+		}
+		e.Fields = append(e.Fields, field{Name: "💰", Value: price, Inline: true})
+	}
+	links := []string{}
+	for _, link := range n.Links {
+		if link.URL != n.URL {
+			links = append(links, fmt.Sprintf("[%s](%s)", link.Label, link.URL))
+		}
+	}
+	if len(links) > 0 {
+		e.Fields = append(e.Fields, field{Name: "🔗", Value: truncate(strings.Join(links, "\n"), 1024)})
+	}
+	return &message{Embeds: []embed{e}}
+}
+
+// truncate truncates a string to a maximum number of runes
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
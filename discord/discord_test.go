@@ -0,0 +1,96 @@
+package discord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSend(t *testing.T) {
+	testCases := []struct {
+		name     string
+		n        *notification.Notification
+		status   int
+		expected string
+		err      bool
+	}{
+		{
+			name: "price drop with image",
+			n: &notification.Notification{
+				Event:     "price",
+				Title:     "Product is below desired price!",
+				Message:   "PlayStation 5",
+				Product:   &scraper.Product{Title: "PlayStation 5"},
+				URL:       "https://www.amazon.es/dp/B08KKJ37F7",
+				Image:     "https://m.media-amazon.com/images/I/ps5.jpg",
+				OldPrice:  499.99,
+				NewPrice:  449.99,
+				Currency:  "EUR",
+				Timestamp: time.Date(2021, time.February, 8, 10, 0, 0, 0, time.UTC),
+				Links:     []notification.Link{{Label: "PlayStation 5", URL: "https://www.amazon.es/dp/B08KKJ37F7"}},
+			},
+			status: http.StatusNoContent,
+			expected: `{"embeds":[{"title":"Product is below desired price!","description":"PlayStation 5",` +
+				`"url":"https://www.amazon.es/dp/B08KKJ37F7","color":16750848,"timestamp":"2021-02-08T10:00:00Z",` +
+				`"image":{"url":"https://m.media-amazon.com/images/I/ps5.jpg"},` +
+				`"fields":[{"name":"💰","value":"~~499.99~~ **449.99 EUR**","inline":true}]}]}`,
+		},
+		{
+			name:     "plain message",
+			n:        &notification.Notification{Title: "Title", Message: "Body"},
+			status:   http.StatusNoContent,
+			expected: `{"embeds":[{"title":"Title","description":"Body","color":16750848}]}`,
+		},
+		{
+			name: "listing with links",
+			n: &notification.Notification{
+				Event:   "listing",
+				Title:   "New products found!",
+				Message: "Listing: https://www.amazon.es/s?k=ps5",
+				URL:     "https://www.amazon.es/s?k=ps5",
+				Links: []notification.Link{
+					{Label: "Listing", URL: "https://www.amazon.es/s?k=ps5"},
+					{Label: "PlayStation 5", URL: "https://www.amazon.es/dp/B08KKJ37F7"},
+					{Label: "Xbox Series X", URL: "https://www.amazon.es/dp/B08H93ZRK9"},
+				},
+			},
+			status: http.StatusNoContent,
+			expected: `{"embeds":[{"title":"New products found!","description":"Listing: https://www.amazon.es/s?k=ps5",` +
+				`"url":"https://www.amazon.es/s?k=ps5","color":16750848,` +
+				`"fields":[{"name":"🔗","value":"[PlayStation 5](https://www.amazon.es/dp/B08KKJ37F7)\n[Xbox Series X](https://www.amazon.es/dp/B08H93ZRK9)","inline":false}]}]}`,
+		},
+		{
+			name:   "invalid webhook",
+			n:      &notification.Notification{Title: "Title", Message: "Body"},
+			status: http.StatusUnauthorized,
+			err:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			var received json.RawMessage
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(tt, "application/json", r.Header.Get("Content-Type"))
+				assert.NoError(tt, json.NewDecoder(r.Body).Decode(&received))
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+
+			tc.n.Recipient = ts.URL
+			err := NewClient().Send(tc.n)
+			if tc.err {
+				assert.Error(tt, err)
+				return
+			}
+			assert.NoError(tt, err)
+			assert.JSONEq(tt, tc.expected, string(received))
+		})
+	}
+}
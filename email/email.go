@@ -0,0 +1,282 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/utils"
+)
+
+const (
+	// DefaultPort is the default port of the SMTP server, used for
+	// submission with STARTTLS
+	DefaultPort = 587
+
+	// TLSNone sends messages without encryption
+	TLSNone = "none"
+	// TLSStartTLS upgrades the connection with the STARTTLS command
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects to the SMTP server through TLS, usually on port 465
+	TLSImplicit = "tls"
+)
+
+// Client is a struct that implicitly implements the Messenger interface
+// for sending messages by email through an SMTP server
+type Client struct {
+	host      string
+	port      int
+	sender    string
+	username  string
+	password  string
+	tlsMode   string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	utils.Logger
+}
+
+// Option is a function to apply settings to Client structure
+type Option func(c *Client) Option
+
+// NewClient returns a new Client which sends messages from the sender
+// address through the SMTP server at host
+func NewClient(host, sender string, opts ...Option) *Client {
+	c := &Client{
+		host:    host,
+		port:    DefaultPort,
+		sender:  sender,
+		tlsMode: TLSStartTLS,
+		timeout: 30 * time.Second,
+		Logger:  &utils.DefaultLogger{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// IsValidTLSMode checks whether a TLS mode is valid or not
+func IsValidTLSMode(mode string) bool {
+	switch mode {
+	case TLSNone, TLSStartTLS, TLSImplicit:
+		return true
+	}
+	return false
+}
+
+// IsValidAddress checks whether an email address is valid or not. Only bare
+// addresses are valid, without a display name or angle brackets, so they
+// can't inject headers in the messages sent to them.
+func IsValidAddress(address string) bool {
+	if strings.ContainsAny(address, "\r\n") {
+		return false
+	}
+	addr, err := mail.ParseAddress(address)
+	return err == nil && addr.Name == "" && addr.Address == address
+}
+
+// SetPort Sets the port of the SMTP server
+func SetPort(port int) Option {
+	return func(c *Client) Option {
+		prev := c.port
+		c.port = port
+		return SetPort(prev)
+	}
+}
+
+// SetAuth Sets the credentials for authenticating with the SMTP server. No
+// authentication is done when the username is empty.
+func SetAuth(username, password string) Option {
+	return func(c *Client) Option {
+		prevUsername, prevPassword := c.username, c.password
+		c.username, c.password = username, password
+		return SetAuth(prevUsername, prevPassword)
+	}
+}
+
+// SetTLSMode Sets how the connection to the SMTP server is encrypted: none,
+// starttls or tls
+func SetTLSMode(mode string) Option {
+	return func(c *Client) Option {
+		prev := c.tlsMode
+		c.tlsMode = mode
+		return SetTLSMode(prev)
+	}
+}
+
+// SetTLSConfig Sets the TLS configuration for the connection to the SMTP
+// server. By default, the certificate of the server is verified against its
+// host name.
+func SetTLSConfig(config *tls.Config) Option {
+	return func(c *Client) Option {
+		prev := c.tlsConfig
+		c.tlsConfig = config
+		return SetTLSConfig(prev)
+	}
+}
+
+// SetLogger Sets the Logger for Client
+func SetLogger(logger utils.Logger) Option {
+	return func(c *Client) Option {
+		prev := c.Logger
+		c.Logger = logger
+		return SetLogger(prev)
+	}
+}
+
+// Send sends a notification by email to the address of its recipient, with
+// its title as subject, from the sender address of the Client
+func (c *Client) Send(n *notification.Notification) error {
+	dest := n.Recipient
+	c.Debugw("sending email message through SMTP server", "host", c.host, "port", c.port, "to", dest)
+	msg, err := c.message(n)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if c.tlsMode == TLSStartTLS {
+		if err = client.StartTLS(c.config()); err != nil {
+			return err
+		}
+	}
+	if c.username != "" {
+		if err = client.Auth(smtp.PlainAuth("", c.username, c.password, c.host)); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(c.sender); err != nil {
+		return err
+	}
+	if err = client.Rcpt(dest); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial connects to the SMTP server, through TLS when its mode is implicit
+func (c *Client) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(c.host, strconv.Itoa(c.port))
+	dialer := &net.Dialer{Timeout: c.timeout}
+	var conn net.Conn
+	var err error
+	if c.tlsMode == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, c.config())
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// config returns the TLS configuration for the connection to the SMTP server
+func (c *Client) config() *tls.Config {
+	if c.tlsConfig != nil {
+		return c.tlsConfig
+	}
+	return &tls.Config{ServerName: c.host}
+}
+
+// message builds a multipart/alternative message with a plain text and an
+// HTML version of a notification
+func (c *Client) message(n *notification.Notification) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	headers := []string{
+		fmt.Sprintf("From: %s", c.sender),
+		fmt.Sprintf("To: %s", n.Recipient),
+		fmt.Sprintf("Subject: %s", mime.QEncoding.Encode("utf-8", n.Title)),
+		fmt.Sprintf("Date: %s", time.Now().Format(time.RFC1123Z)),
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q", w.Boundary()),
+	}
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	parts := []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", n.Message},
+		{"text/html; charset=utf-8", htmlBody(n)},
+	}
+	for _, part := range parts {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err = qw.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err = qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// htmlBody returns the HTML version of a notification, where every line of
+// the message is a paragraph and URLs are links, followed by the image of the
+// product and the links of the notification
+func htmlBody(n *notification.Notification) string {
+	lines := []string{fmt.Sprintf("<h2>%s</h2>", html.EscapeString(n.Title))}
+	for _, line := range strings.Split(n.Message, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		words := strings.Fields(line)
+		for i, word := range words {
+			escaped := html.EscapeString(word)
+			if strings.HasPrefix(word, "http://") || strings.HasPrefix(word, "https://") {
+				escaped = fmt.Sprintf(`<a href="%s">%s</a>`, escaped, escaped)
+			}
+			words[i] = escaped
+		}
+		lines = append(lines, fmt.Sprintf("<p>%s</p>", strings.Join(words, " ")))
+	}
+	if n.Image != "" {
+		lines = append(lines, fmt.Sprintf(`<p><img src="%s" alt="%s" width="300"></p>`, html.EscapeString(n.Image), html.EscapeString(n.Title)))
+	}
+	for _, link := range n.Links {
+		lines = append(lines, fmt.Sprintf(`<p><a href="%s"><strong>%s</strong></a></p>`, html.EscapeString(link.URL), html.EscapeString(link.Label)))
+	}
+	return fmt.Sprintf("<html><body>\n%s\n</body></html>", strings.Join(lines, "\n"))
+}
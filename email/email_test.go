@@ -0,0 +1,263 @@
+package email
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/stretchr/testify/assert"
+)
+
+// session is what the SMTP stand-in received from a client
+type session struct {
+	auth, from, to, data string
+	tls                  bool
+}
+
+// smtpServer is a minimal SMTP server that accepts a single session
+type smtpServer struct {
+	listener net.Listener
+	tlsCfg   *tls.Config
+	sessions chan *session
+}
+
+func newSMTPServer(t *testing.T, tlsCfg *tls.Config, implicit bool) *smtpServer {
+	var l net.Listener
+	var err error
+	if implicit {
+		l, err = tls.Listen("tcp", "127.0.0.1:0", tlsCfg)
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: l, tlsCfg: tlsCfg, sessions: make(chan *session, 1)}
+	go s.serve(implicit)
+	return s
+}
+
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve(implicit bool) {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	sess := &session{tls: implicit}
+	defer func() { s.sessions <- sess }()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			exts := []string{"250-localhost", "250-AUTH PLAIN"}
+			if s.tlsCfg != nil && !sess.tls {
+				exts = append(exts, "250-STARTTLS")
+			}
+			for _, ext := range exts {
+				tp.PrintfLine("%s", ext)
+			}
+			tp.PrintfLine("250 8BITMIME")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsCfg)
+			if err = tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			sess.tls = true
+		case "AUTH":
+			fields := strings.Fields(line)
+			decoded, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			sess.auth = string(decoded)
+			tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			sess.from = line
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			if strings.Contains(line, "unknown") {
+				tp.PrintfLine("550 no such user")
+				continue
+			}
+			sess.to = line
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			sess.data = string(data)
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	defer ts.Close()
+	serverTLS := &tls.Config{Certificates: ts.TLS.Certificates}
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	clientTLS := &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+
+	testCases := []struct {
+		name, tlsMode, username, to string
+		implicit                    bool
+		auth                        string
+		err                         bool
+	}{
+		{
+			name:    "without encryption nor authentication",
+			tlsMode: TLSNone,
+			to:      "customer@example.com",
+		},
+		{
+			name:     "with authentication",
+			tlsMode:  TLSNone,
+			username: "hermezon",
+			to:       "customer@example.com",
+			auth:     "\x00hermezon\x00password",
+		},
+		{
+			name:     "with starttls",
+			tlsMode:  TLSStartTLS,
+			username: "hermezon",
+			to:       "customer@example.com",
+			auth:     "\x00hermezon\x00password",
+		},
+		{
+			name:     "with implicit tls",
+			tlsMode:  TLSImplicit,
+			implicit: true,
+			to:       "customer@example.com",
+		},
+		{
+			name:    "rejected recipient",
+			tlsMode: TLSNone,
+			to:      "unknown@example.com",
+			err:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			srv := newSMTPServer(tt, serverTLS, tc.implicit)
+			defer srv.listener.Close()
+
+			c := NewClient("127.0.0.1", "hermezon@example.com",
+				SetPort(srv.port()),
+				SetAuth(tc.username, "password"),
+				SetTLSMode(tc.tlsMode),
+				SetTLSConfig(clientTLS),
+			)
+			err := c.Send(&notification.Notification{
+				Recipient: tc.to,
+				Title:     "¡Disponible!",
+				Message:   "PlayStation 5\nURL: https://www.amazon.es/dp/B08KKJ37F7",
+				Image:     "https://m.media-amazon.com/images/I/ps5.jpg",
+				Links:     []notification.Link{{Label: "PlayStation 5", URL: "https://www.amazon.es/dp/B08KKJ37F7"}},
+			})
+			sess := <-srv.sessions
+			if tc.err {
+				assert.Error(tt, err)
+				return
+			}
+			assert.NoError(tt, err)
+			assert.Equal(tt, tc.tlsMode != TLSNone, sess.tls)
+			assert.Equal(tt, tc.auth, sess.auth)
+			assert.Equal(tt, "MAIL FROM:<hermezon@example.com> BODY=8BITMIME", sess.from)
+			assert.Equal(tt, "RCPT TO:<"+tc.to+">", sess.to)
+
+			msg, err := mail.ReadMessage(strings.NewReader(sess.data))
+			if !assert.NoError(tt, err) {
+				return
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			assert.NoError(tt, err)
+			assert.Equal(tt, "¡Disponible!", subject)
+			assert.Equal(tt, tc.to, msg.Header.Get("To"))
+
+			mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+			assert.NoError(tt, err)
+			assert.Equal(tt, "multipart/alternative", mediaType)
+			r := multipart.NewReader(msg.Body, params["boundary"])
+			parts := map[string]string{}
+			for {
+				part, err := r.NextPart()
+				if err != nil {
+					break
+				}
+				content, _ := ioutil.ReadAll(part)
+				parts[strings.SplitN(part.Header.Get("Content-Type"), ";", 2)[0]] = string(content)
+			}
+			assert.Equal(tt, "PlayStation 5\nURL: https://www.amazon.es/dp/B08KKJ37F7", parts["text/plain"])
+			assert.Contains(tt, parts["text/html"], "<h2>¡Disponible!</h2>")
+			assert.Contains(tt, parts["text/html"], `<p>URL: <a href="https://www.amazon.es/dp/B08KKJ37F7">https://www.amazon.es/dp/B08KKJ37F7</a></p>`)
+			assert.Contains(tt, parts["text/html"], `<img src="https://m.media-amazon.com/images/I/ps5.jpg"`)
+			assert.Contains(tt, parts["text/html"], `<p><a href="https://www.amazon.es/dp/B08KKJ37F7"><strong>PlayStation 5</strong></a></p>`)
+		})
+	}
+}
+
+func TestIsValidTLSMode(t *testing.T) {
+	for mode, valid := range map[string]bool{
+		TLSNone:     true,
+		TLSStartTLS: true,
+		TLSImplicit: true,
+		"ssl":       false,
+		"":          false,
+	} {
+		t.Run(strconv.Quote(mode), func(tt *testing.T) {
+			assert.Equal(tt, valid, IsValidTLSMode(mode))
+		})
+	}
+}
+
+func TestIsValidAddress(t *testing.T) {
+	for address, valid := range map[string]bool{
+		"alice@example.com":                  true,
+		"alice+hermezon@mail.example.com":    true,
+		"":                                   false,
+		"alice":                              false,
+		"alice@":                             false,
+		"Alice <alice@example.com>":          false,
+		"<alice@example.com>":                false,
+		"alice@example.com, bob@example.com": false,
+		"alice@example.com\r\nBcc: bob@example.com": false,
+		"alice@example.com\n":                       false,
+		" alice@example.com":                        false,
+	} {
+		t.Run(strconv.Quote(address), func(tt *testing.T) {
+			assert.Equal(tt, valid, IsValidAddress(address))
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/igvaquero18/hermezon/scraper"
+)
+
+const (
+	// factsBucket is the bucket where the last facts scraped for every product
+	// are stored, under the type and key of the action tracking it, or the
+	// key of the group and the URL of the product
+	factsBucket = "facts"
+
+	// groupFacts is the kind of the facts of the products of groups
+	groupFacts = "group"
+)
+
+// factsKey returns the key under which the facts of a product are stored.
+// Every type of action keeps its own facts, as they are checked on their
+// own, and the products of groups are keyed by their URL too.
+func factsKey(kind, key string) string {
+	return fmt.Sprintf("%s|%s", kind, key)
+}
+
+// saveFacts stores the facts scraped for the product of an action
+func saveFacts(key string, product *scraper.Product) error {
+	value, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+	return db.Save(key, string(value), factsBucket)
+}
+
+// loadFacts returns the last facts scraped for the product of an action,
+// or nil if the product hasn't been scraped yet
+func loadFacts(key string) (*scraper.Product, error) {
+	value, err := db.Get(key, factsBucket)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	product := &scraper.Product{}
+	if err = json.Unmarshal([]byte(value), product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+type factsPruner struct{}
+
+// Run deletes the facts of the actions and groups which no longer exist
+func (p factsPruner) Run() {
+	if err := pruneFacts(); err != nil {
+		sugar.Errorw("error when pruning product facts", "msg", err.Error())
+	}
+}
+
+// pruneFacts deletes the facts whose action or group no longer exists, like
+// the ones saved by a check running while it was deleted, or the ones stored
+// before they were kept per type of action
+func pruneFacts() error {
+	results, err := db.GetAll(factsBucket)
+	if err != nil {
+		return err
+	}
+	live := map[string]bool{}
+	for _, at := range []ActionType{priceAction, availabilityAction} {
+		actions, err := loadActions(at)
+		if err != nil {
+			return err
+		}
+		for key := range actions {
+			live[factsKey(string(at), key)] = true
+		}
+	}
+	groups, err := loadGroups()
+	if err != nil {
+		return err
+	}
+	prefixes := make([]string, 0, len(groups))
+	for key := range groups {
+		prefixes = append(prefixes, factsKey(groupFacts, key)+"|")
+	}
+
+	pruned := 0
+	for key := range results {
+		if live[key] || hasAnyPrefix(key, prefixes) {
+			continue
+		}
+		if err = db.Delete(key, factsBucket); err != nil {
+			return err
+		}
+		pruned++
+	}
+	sugar.Debugw("pruned product facts", "pruned", pruned, "kept", len(results)-pruned)
+	return nil
+}
+
+// hasAnyPrefix returns true if s starts with any of the prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/stretchr/testify/assert"
+)
+
+// saveAction stores an action in the database
+func saveAction(t *testing.T, action *Action) {
+	value, err := json.Marshal(action)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Save(action.key(), string(value), string(action.Type)))
+}
+
+func TestFactsPerActionType(t *testing.T) {
+	setUp(t)
+	price := &Action{Type: priceAction, From: "alice", URL: "https://www.amazon.es/dp/B01", Price: "10"}
+	availability := &Action{Type: availabilityAction, From: "alice", URL: "https://www.amazon.es/dp/B01"}
+	saveAction(t, price)
+	saveAction(t, availability)
+
+	// Actions of different types on the same product keep their own facts
+	assert.NoError(t, saveFacts(factsKey(priceAction, price.key()), &scraper.Product{Price: 9}))
+	assert.NoError(t, saveFacts(factsKey(availabilityAction, availability.key()), &scraper.Product{Price: 11}))
+	facts, err := loadFacts(factsKey(priceAction, price.key()))
+	assert.NoError(t, err)
+	assert.Equal(t, 9.0, facts.Price)
+
+	assert.NoError(t, deleteAction(priceAction, price.key()))
+	stored, err := loadAction(priceAction, price.key())
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+	facts, err = loadFacts(factsKey(priceAction, price.key()))
+	assert.NoError(t, err)
+	assert.Nil(t, facts)
+	facts, err = loadFacts(factsKey(availabilityAction, availability.key()))
+	assert.NoError(t, err)
+	assert.Equal(t, 11.0, facts.Price)
+}
+
+func TestPruneFacts(t *testing.T) {
+	setUp(t)
+	action := &Action{Type: availabilityAction, From: "alice", URL: "https://www.amazon.es/dp/B01"}
+	saveAction(t, action)
+	group := &Group{From: "alice", Name: "kindle", URLs: []string{"https://www.amazon.es/dp/B02"}}
+	assert.NoError(t, saveGroup(group))
+
+	for _, key := range []string{
+		factsKey(availabilityAction, action.key()),
+		factsKey(groupFacts, group.key()+"|https://www.amazon.es/dp/B02"),
+		factsKey(priceAction, action.key()),
+		factsKey(groupFacts, "alice|echo|https://www.amazon.es/dp/B03"),
+		action.key(),
+	} {
+		assert.NoError(t, saveFacts(key, &scraper.Product{Title: "Kindle"}))
+	}
+
+	assert.NoError(t, pruneFacts())
+	results, err := db.GetAll(factsBucket)
+	assert.NoError(t, err)
+	keys := []string{}
+	for key := range results {
+		keys = append(keys, key)
+	}
+	assert.ElementsMatch(t, []string{
+		factsKey(availabilityAction, action.key()),
+		factsKey(groupFacts, group.key()+"|https://www.amazon.es/dp/B02"),
+	}, keys)
+}
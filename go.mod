@@ -5,6 +5,7 @@ go 1.15
 require (
 	github.com/PuerkitoBio/goquery v1.6.0
 	github.com/bamzi/jobrunner v1.0.0
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/golang/mock v1.4.4
 	github.com/igvaquero18/telegram-notifier v0.0.0-20200709053438-7033b25bd928
 	github.com/labstack/echo-contrib v0.9.0
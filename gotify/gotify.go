@@ -0,0 +1,136 @@
+package gotify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/utils"
+)
+
+// tokenRegexp matches the tokens of the applications
+var tokenRegexp = regexp.MustCompile(`^[-_.A-Za-z0-9]{1,64}$`)
+
+// Client is a struct that implicitly implements the Messenger interface
+// for pushing messages to a Gotify server, whose destinations are
+// application tokens
+type Client struct {
+	server string
+	client *http.Client
+	utils.Logger
+}
+
+// Option is a function to apply settings to Client structure
+type Option func(c *Client) Option
+
+// NewClient returns a new Client for the Gotify server at the given URL
+func NewClient(server string, opts ...Option) *Client {
+	c := &Client{
+		server: strings.TrimSuffix(server, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+		Logger: &utils.DefaultLogger{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetHTTPClient Sets the HTTP client for Client
+func SetHTTPClient(client *http.Client) Option {
+	return func(c *Client) Option {
+		prev := c.client
+		c.client = client
+		return SetHTTPClient(prev)
+	}
+}
+
+// SetLogger Sets the Logger for Client
+func SetLogger(logger utils.Logger) Option {
+	return func(c *Client) Option {
+		prev := c.Logger
+		c.Logger = logger
+		return SetLogger(prev)
+	}
+}
+
+// message is a message of the Gotify API
+type message struct {
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+// Send pushes a notification to the application whose token is its
+// recipient. Clicking the notification opens the product, and its image is
+// shown.
+func (c *Client) Send(n *notification.Notification) error {
+	msg := &message{
+		Title:    n.Title,
+		Message:  n.Message,
+		Priority: priority(n),
+	}
+	extras := map[string]interface{}{}
+	if n.URL != "" {
+		extras["click"] = map[string]string{"url": n.URL}
+	}
+	if n.Image != "" {
+		extras["bigImageUrl"] = n.Image
+	}
+	if len(extras) > 0 {
+		msg.Extras = map[string]interface{}{"client::notification": extras}
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/message", c.server), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", n.Recipient)
+
+	c.Debugw("pushing message to Gotify", "event", n.Event)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Gotify response status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// IsValidServer checks whether the URL of a Gotify server is valid or not
+func IsValidServer(server string) bool {
+	u, err := url.Parse(server)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// IsValidToken checks whether the token of a Gotify application is valid or
+// not
+func IsValidToken(token string) bool {
+	return tokenRegexp.MatchString(token)
+}
+
+// priority returns the priority of a notification in the Gotify scale, from
+// 0 to 10, where 4-7 raise a sound and 8-10 a popup in Android
+func priority(n *notification.Notification) int {
+	p := n.Priority
+	if p < notification.PriorityMin || p > notification.PriorityMax {
+		p = notification.PriorityDefault
+	}
+	return p*2 - 1
+}
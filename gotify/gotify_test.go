@@ -0,0 +1,83 @@
+package gotify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSend(t *testing.T) {
+	testCases := []struct {
+		name     string
+		n        *notification.Notification
+		status   int
+		expected string
+		err      bool
+	}{
+		{
+			name: "price drop with image",
+			n: &notification.Notification{
+				Event:    "price",
+				Title:    "Product is below desired price!",
+				Message:  "PlayStation 5",
+				URL:      "https://www.amazon.es/dp/B08KKJ37F7",
+				Image:    "https://m.media-amazon.com/images/I/ps5.jpg",
+				Priority: notification.PriorityMax,
+			},
+			status: http.StatusOK,
+			expected: `{"title":"Product is below desired price!","message":"PlayStation 5","priority":9,` +
+				`"extras":{"client::notification":{"click":{"url":"https://www.amazon.es/dp/B08KKJ37F7"},"bigImageUrl":"https://m.media-amazon.com/images/I/ps5.jpg"}}}`,
+		},
+		{
+			name:     "plain message",
+			n:        &notification.Notification{Title: "Title", Message: "Body"},
+			status:   http.StatusOK,
+			expected: `{"title":"Title","message":"Body","priority":5}`,
+		},
+		{
+			name:   "invalid token",
+			n:      &notification.Notification{Title: "Title", Message: "Body"},
+			status: http.StatusUnauthorized,
+			err:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			var received json.RawMessage
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(tt, "/message", r.URL.Path)
+				assert.Equal(tt, "app-token", r.Header.Get("X-Gotify-Key"))
+				assert.NoError(tt, json.NewDecoder(r.Body).Decode(&received))
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+
+			tc.n.Recipient = "app-token"
+			err := NewClient(ts.URL + "/").Send(tc.n)
+			if tc.err {
+				assert.Error(tt, err)
+				return
+			}
+			assert.NoError(tt, err)
+			assert.JSONEq(tt, tc.expected, string(received))
+		})
+	}
+}
+
+func TestIsValidServer(t *testing.T) {
+	assert.True(t, IsValidServer("https://gotify.example.com"))
+	assert.False(t, IsValidServer("gotify.example.com"))
+	assert.False(t, IsValidServer(""))
+}
+
+func TestIsValidToken(t *testing.T) {
+	assert.True(t, IsValidToken("AbC.dEf-123_x"))
+	assert.False(t, IsValidToken(""))
+	assert.False(t, IsValidToken("token\r\nX-Other: header"))
+	assert.False(t, IsValidToken("https://gotify.example.com"))
+}
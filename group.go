@@ -0,0 +1,493 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/igvaquero18/hermezon/templates"
+	"github.com/labstack/echo/v4"
+)
+
+// groupsBucket is the bucket where the product groups are stored
+const groupsBucket = "groups"
+
+// Group links the URLs of the same product in several stores, so all of them
+// are compared on every check and the cheapest available offer is notified.
+// Besides its URLs, the price and availability actions of the same owner
+// whose product has the GTIN of the group are part of it.
+type Group struct {
+	Owner     string    `json:"owner,omitempty"`
+	Name      string    `json:"name"`
+	From      string    `json:"from"`
+	URLs      []string  `json:"urls"`
+	GTIN      string    `json:"gtin,omitempty"`
+	Price     string    `json:"price,omitempty"`
+	PriceMode PriceMode `json:"price_mode,omitempty"`
+	Currency  string    `json:"currency,omitempty"`
+	Locale    string    `json:"locale,omitempty"`
+	Channel   string    `json:"channel,omitempty"`
+	Priority  int       `json:"priority,omitempty"`
+	Urgent    bool      `json:"urgent,omitempty"`
+	Digest    string    `json:"digest,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Cheapest  *Offer    `json:"cheapest,omitempty"`
+}
+
+// Offer is the offer of the product of a group in one of its stores
+type Offer struct {
+	URL   string  `json:"url"`
+	Price float64 `json:"price"`
+
+	product *scraper.Product
+}
+
+// key returns the key under which the group is stored in the database
+func (g *Group) key() string {
+	return fmt.Sprintf("%s|%s", g.From, g.Name)
+}
+
+// urls returns the URLs of the products of the group, including the ones of
+// the actions of the same owner whose product has the GTIN of the group.
+// Groups stored before they had owners only include the actions sent to
+// their destination.
+// Actions are visited in the order of their keys, so the offer chosen between
+// equally cheap ones doesn't change from one check to the next.
+func (g *Group) urls() ([]string, error) {
+	urls := append([]string{}, g.URLs...)
+	if g.GTIN == "" {
+		return urls, nil
+	}
+	for _, at := range []ActionType{priceAction, availabilityAction} {
+		actions, err := loadActions(at)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(actions))
+		for key := range actions {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			action := actions[key]
+			if action.Owner != g.Owner || (g.Owner == "" && action.From != g.From) {
+				continue
+			}
+			facts, err := loadFacts(factsKey(string(at), key))
+			if err != nil {
+				return nil, err
+			}
+			if facts == nil || facts.GTIN != g.GTIN {
+				continue
+			}
+			url, err := scraper.NewScraper(
+				scraper.SetURL(action.URL),
+				scraper.SetVariant(action.Variant),
+				scraper.SetVariantParam(action.VariantParam),
+			).ProductURL()
+			if err == nil && !containsString(urls, url) {
+				urls = append(urls, url)
+			}
+		}
+	}
+	return urls, nil
+}
+
+// comparablePrice returns the price of a product of the group that is
+// compared with the rest of its offers, in the currency of the group
+func (g *Group) comparablePrice(product *scraper.Product) (float64, error) {
+	price := product.Price
+	if g.PriceMode == effectivePrice {
+		price = product.EffectivePrice()
+	}
+	return convertPrice(price, product.Currency, g.Currency)
+}
+
+// containsString returns true if the slice contains the string
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// loadGroups returns all the product groups stored in the database, indexed
+// by their key
+func loadGroups() (map[string]*Group, error) {
+	results, err := db.GetAll(groupsBucket)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string]*Group, len(results))
+	for k, v := range results {
+		group := &Group{}
+		if err = json.Unmarshal([]byte(v), group); err != nil {
+			return nil, err
+		}
+		groups[k] = group
+	}
+	return groups, nil
+}
+
+// loadGroup returns a product group stored in the database, or nil if it
+// doesn't exist
+func loadGroup(key string) (*Group, error) {
+	value, err := db.Get(key, groupsBucket)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	group := &Group{}
+	if err = json.Unmarshal([]byte(value), group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// saveGroup stores a product group in the database
+func saveGroup(group *Group) error {
+	value, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	return db.Save(group.key(), string(value), groupsBucket)
+}
+
+// updateGroup applies the results of a check to a product group. The group
+// is loaded again, so the changes posted while it was checked are kept, and
+// it isn't saved if it was deleted meanwhile.
+func updateGroup(key string, update func(*Group)) error {
+	userMutex.Lock()
+	defer userMutex.Unlock()
+
+	group, err := loadGroup(key)
+	if err != nil || group == nil {
+		return err
+	}
+	update(group)
+	value, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	return db.Save(key, string(value), groupsBucket)
+}
+
+// deleteGroup deletes a product group stored in the database, together with
+// the facts of its products
+func deleteGroup(key string) error {
+	results, err := db.GetAll(factsBucket)
+	if err != nil {
+		return err
+	}
+	prefix := factsKey(groupFacts, key) + "|"
+	for k := range results {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if err = db.Delete(k, factsBucket); err != nil {
+			return err
+		}
+	}
+	return db.Delete(key, groupsBucket)
+}
+
+// postGroups will allow us to post a new group of products for comparing
+// their prices in several stores
+func postGroups(c echo.Context) error {
+	group := &Group{}
+	if err := c.Bind(group); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid group: %s", err.Error())})
+	}
+	if group.Name == "" || group.From == "" || (len(group.URLs) == 0 && group.GTIN == "") {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid group: name, from and either urls or gtin are required"})
+	}
+	if group.Price != "" {
+		if _, err := parseAmount(group.Price); err != nil {
+			return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid price: %s", group.Price)})
+		}
+	}
+	if group.Currency != "" && !currencyRegexp.MatchString(group.Currency) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid currency: %s", group.Currency)})
+	}
+	if _, err := messengerFor(group.Channel); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid channel: %s", err.Error())})
+	}
+	if err := checkDestination(group.Channel, group.From); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid from: %s", err.Error())})
+	}
+	if !isValidPriority(group.Priority) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid priority: %d", group.Priority)})
+	}
+	if group.Locale != "" && !localeRegexp.MatchString(group.Locale) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid locale: %s", group.Locale)})
+	}
+	if !group.PriceMode.IsValid() {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid price mode: %s", group.PriceMode)})
+	}
+	if !isValidDigest(group.Digest) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid digest: %s", group.Digest)})
+	}
+	if !isValidTags(group.Tags) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid tags: %s", strings.Join(group.Tags, ","))})
+	}
+	group.Cheapest = nil
+
+	userMutex.Lock()
+	defer userMutex.Unlock()
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	group.Owner = user.ID
+	if group.Locale == "" {
+		group.Locale = user.Locale
+	}
+	existing, err := loadGroup(group.key())
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Owner != user.ID {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"the group belongs to another user"})
+	}
+	if existing == nil && user.Limits.Groups > 0 {
+		groups, err := userGroups(user)
+		if err != nil {
+			return err
+		}
+		if len(groups) >= user.Limits.Groups {
+			return c.JSON(http.StatusForbidden, &ResponseMessage{fmt.Sprintf("limit of %d groups reached", user.Limits.Groups)})
+		}
+	}
+	if !user.isVerified(group.Channel, group.From) {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"invalid from: the destination is not verified"})
+	}
+
+	sugar.Debugw("adding product group to database",
+		"owner", group.Owner,
+		"name", group.Name,
+		"from", group.From,
+		"urls", group.URLs,
+		"gtin", group.GTIN,
+		"price", group.Price,
+		"price_mode", group.PriceMode,
+		"currency", group.Currency,
+		"locale", group.Locale,
+		"channel", group.Channel,
+		"priority", group.Priority,
+		"urgent", group.Urgent,
+		"digest", group.Digest,
+		"tags", group.Tags,
+	)
+
+	return saveGroup(group)
+}
+
+// getGroups returns the product groups of the user making the request
+func getGroups(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	groups, err := userGroups(user)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, groups)
+}
+
+// deleteGroups will allow users to stop comparing the prices of a group
+func deleteGroups(c echo.Context) error {
+	group := &Group{From: c.QueryParam("from"), Name: c.QueryParam("name")}
+	if group.From == "" || group.Name == "" {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid query: from and name are required"})
+	}
+
+	userMutex.Lock()
+	defer userMutex.Unlock()
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	existing, err := loadGroup(group.key())
+	if err != nil {
+		return err
+	}
+	if existing == nil || existing.Owner != user.ID {
+		return c.JSON(http.StatusNotFound, &ResponseMessage{"group not found"})
+	}
+	sugar.Debugw("removing product group from database", "owner", user.ID, "key", group.key())
+	return deleteGroup(group.key())
+}
+
+type comparison struct{}
+
+// Run checks all the product groups in the database, looking for the
+// cheapest available offer of each one of them.
+func (cmp comparison) Run() {
+	sugar.Debug("comparing prices of all product groups")
+	groups, err := loadGroups()
+	if err != nil {
+		sugar.Fatalw("error when reading the database", "msg", err.Error())
+	}
+	for k, group := range groups {
+		databaseKey := k
+		group := group
+		go func() {
+			if err := compareGroup(databaseKey, group); err != nil {
+				sugar.Errorw("error when comparing product group", "key", databaseKey, "msg", err.Error())
+			}
+		}()
+	}
+}
+
+// compareGroup checks every product of a group and notifies the cheapest
+// available offer when it changes. Groups with a target price are only
+// notified once the cheapest offer is below it, and then deleted unless they
+// are in digest mode. Only the GTIN learned from the products and the
+// cheapest offer are saved, as the rest of the group belongs to its owner.
+func compareGroup(databaseKey string, group *Group) error {
+	var targetPrice float64
+	if group.Price != "" {
+		price, err := parseAmount(group.Price)
+		if err != nil {
+			return err
+		}
+		targetPrice = price
+	}
+
+	urls, err := group.urls()
+	if err != nil {
+		return err
+	}
+	gtin := group.GTIN
+	update := func(cheapest *Offer) error {
+		return updateGroup(databaseKey, func(g *Group) {
+			if g.GTIN == "" {
+				g.GTIN = gtin
+			}
+			if cheapest != nil {
+				g.Cheapest = cheapest
+			}
+		})
+	}
+
+	offers := []Offer{}
+	for _, url := range urls {
+		product, err := scraper.NewScraper(
+			scraper.SetExpectedStatusCode(expectedStatusCode),
+			scraper.SetLogger(sugar),
+			scraper.SetMaxRetries(maxRetries),
+			scraper.SetRetrySeconds(retrySeconds),
+			scraper.SetURL(url),
+		).Product()
+		if err != nil {
+			sugar.Errorw("error when checking product of group", "group", group.Name, "url", url, "msg", err.Error())
+			continue
+		}
+		key := factsKey(groupFacts, fmt.Sprintf("%s|%s", databaseKey, url))
+		previous, err := loadFacts(key)
+		if err != nil {
+			sugar.Errorw("error when reading product facts", "group", group.Name, "url", url, "msg", err.Error())
+		}
+		if err = saveFacts(key, product); err != nil {
+			sugar.Errorw("error when saving product facts", "group", group.Name, "url", url, "msg", err.Error())
+		}
+		if gtin == "" && product.GTIN != "" {
+			gtin = product.GTIN
+		}
+		if product.GTIN != "" && product.GTIN != gtin {
+			sugar.Infow("product doesn't match the gtin of the group", "group", group.Name, "url", url, "gtin", product.GTIN)
+			continue
+		}
+		trackChanges(group, url, previous, product)
+		price, err := group.comparablePrice(product)
+		if err != nil {
+			sugar.Errorw("error when checking product of group", "group", group.Name, "url", url, "msg", err.Error())
+			continue
+		}
+		if !product.Available || price == 0 {
+			sugar.Debugw("Product of group is not available...", "group", group.Name, "url", url)
+			continue
+		}
+		offers = append(offers, Offer{URL: url, Price: price, product: product})
+	}
+
+	if len(offers) == 0 {
+		sugar.Debugw("No available offers for group...", "group", group.Name)
+		return update(nil)
+	}
+
+	cheapest := offers[0]
+	for _, offer := range offers[1:] {
+		if offer.Price < cheapest.Price {
+			cheapest = offer
+		}
+	}
+
+	if targetPrice > 0 && cheapest.Price >= targetPrice {
+		sugar.Debugw("Cheapest offer of group is not below...", "group", group.Name, "price", cheapest.Price, "desired_price", group.Price)
+		return update(&cheapest)
+	}
+	if targetPrice == 0 && group.Cheapest != nil && group.Cheapest.URL == cheapest.URL && group.Cheapest.Price == cheapest.Price {
+		sugar.Debugw("Cheapest offer of group didn't change...", "group", group.Name, "url", cheapest.URL, "price", cheapest.Price)
+		return update(nil)
+	}
+
+	sugar.Debugw("Cheapest offer of group found!", "group", group.Name, "url", cheapest.URL, "price", cheapest.Price)
+	data := &templates.Data{
+		Name:          group.Name,
+		Product:       cheapest.product,
+		URL:           cheapest.URL,
+		Store:         storeName(cheapest.URL),
+		ComparedPrice: cheapest.Price,
+		Currency:      group.Currency,
+		Offers:        make([]templates.Offer, 0, len(offers)),
+		Tracking:      group,
+		Priority:      group.Priority,
+		Tags:          group.Tags,
+	}
+	if group.Cheapest != nil {
+		data.OldPrice = group.Cheapest.Price
+	}
+	for _, offer := range offers {
+		data.Offers = append(data.Offers, templates.Offer{Store: storeName(offer.URL), Price: offer.Price})
+	}
+	err = notify(templates.EventComparison, group.Channel, group.From, group.Locale, data)
+	if errors.Is(err, errSuppressed) {
+		// The cheapest offer is kept as it was, so it's notified again
+		sugar.Debugw("Notification suppressed. The cheapest offer will be notified again...", "group", group.Name)
+		return update(nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	if targetPrice > 0 && digestOf(group) == nil {
+		userMutex.Lock()
+		defer userMutex.Unlock()
+		if err = deleteGroup(databaseKey); err != nil {
+			return err
+		}
+		sugar.Debugw("deleted key from bucket", "key", databaseKey, "bucket", groupsBucket)
+		return nil
+	}
+	return update(&cheapest)
+}
+
+// storeName returns the name of the store of a URL, which is its host
+// without the www prefix
+func storeName(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+	return strings.TrimPrefix(u.Host, "www.")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/stretchr/testify/assert"
+)
+
+// productServer serves the page of an available product at a price
+func productServer(t *testing.T, price string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<span id="productTitle">Kindle</span>
+			<div id="availability"><span>En stock.</span></div>
+			<span id="priceblock_ourprice">%s €</span>`, price)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCompareGroupKeepsChanges(t *testing.T) {
+	fake := setUp(t)
+	srv := productServer(t, "89,99")
+	group := &Group{Owner: "alice", Name: "kindle", From: "alice-phone", Channel: testChannel, URLs: []string{srv.URL}}
+	assert.NoError(t, saveGroup(group))
+	checked, err := loadGroup(group.key())
+	assert.NoError(t, err)
+
+	// The owner changes the group while it's checked
+	group.Priority = 2
+	group.URLs = append(group.URLs, "https://www.amazon.es/dp/B01")
+	assert.NoError(t, saveGroup(group))
+
+	assert.NoError(t, compareGroup(group.key(), checked))
+	assert.Len(t, fake.messages(), 1)
+	stored, err := loadGroup(group.key())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stored.Priority)
+	assert.Len(t, stored.URLs, 2)
+	if assert.NotNil(t, stored.Cheapest) {
+		assert.Equal(t, srv.URL, stored.Cheapest.URL)
+		assert.Equal(t, 89.99, stored.Cheapest.Price)
+	}
+}
+
+func TestCompareGroupDeleted(t *testing.T) {
+	setUp(t)
+	srv := productServer(t, "89,99")
+	group := &Group{Owner: "alice", Name: "kindle", From: "alice-phone", Channel: testChannel, URLs: []string{srv.URL}}
+	assert.NoError(t, saveGroup(group))
+
+	// The owner deletes the group while it's checked
+	assert.NoError(t, deleteGroup(group.key()))
+	assert.NoError(t, compareGroup(group.key(), group))
+	stored, err := loadGroup(group.key())
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+}
+
+func TestGroupURLs(t *testing.T) {
+	setUp(t)
+	group := &Group{Owner: "alice", Name: "kindle", From: "alice-phone", GTIN: "0840080500100", URLs: []string{"https://www.amazon.es/dp/B01"}}
+	actions := []*Action{
+		{Owner: "alice", Type: priceAction, From: "alice-mail", URL: "https://www.amazon.es/dp/B02", Price: "90"},
+		{Owner: "alice", Type: availabilityAction, From: "alice-phone", URL: "https://www.amazon.es/dp/B03"},
+		{Owner: "bob", Type: priceAction, From: "alice-phone", URL: "https://www.amazon.es/dp/B04", Price: "90"},
+		{Owner: "alice", Type: priceAction, From: "alice-phone", URL: "https://www.amazon.es/dp/B05", Price: "90"},
+	}
+	gtins := []string{group.GTIN, group.GTIN, group.GTIN, "0840080500101"}
+	for i, action := range actions {
+		saveAction(t, action)
+		assert.NoError(t, saveFacts(factsKey(string(action.Type), action.key()), &scraper.Product{GTIN: gtins[i]}))
+	}
+
+	urls, err := group.urls()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"https://www.amazon.es/dp/B01",
+		"https://www.amazon.es/dp/B02",
+		"https://www.amazon.es/dp/B03",
+	}, urls)
+}
+
+func TestDeleteGroupsFacts(t *testing.T) {
+	setUp(t)
+	e := newServer()
+	verify(t, "alice", "alice-phone")
+	body := map[string]interface{}{"name": "kindle", "from": "alice-phone", "urls": []string{"https://www.amazon.es/dp/B01"}}
+	rec := request(e, http.MethodPost, "/v1/groups", token("alice"), body)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	group := &Group{From: "alice-phone", Name: "kindle"}
+	other := &Group{From: "alice-phone", Name: "kindle paperwhite"}
+	assert.NoError(t, saveFacts(factsKey(groupFacts, group.key()+"|https://www.amazon.es/dp/B01"), &scraper.Product{Title: "Kindle"}))
+	assert.NoError(t, saveFacts(factsKey(groupFacts, other.key()+"|https://www.amazon.es/dp/B02"), &scraper.Product{Title: "Kindle Paperwhite"}))
+
+	rec = request(e, http.MethodDelete, "/v1/groups?from=alice-phone&name=kindle", token("alice"), nil)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	stored, err := loadGroup(group.key())
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+	results, err := db.GetAll(factsBucket)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Contains(t, results, factsKey(groupFacts, other.key()+"|https://www.amazon.es/dp/B02"))
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/igvaquero18/hermezon/twilio"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// notificationsBucket is the bucket where the history of the
+	// notifications is stored, under the ID of their outbox entry
+	notificationsBucket = "notifications"
+
+	// defaultHistoryLimit is the number of notifications returned by default
+	// when browsing the history
+	defaultHistoryLimit = 50
+	// maxHistoryLimit is the maximum number of notifications returned when
+	// browsing the history
+	maxHistoryLimit = 500
+	// defaultHistoryRetention is the default time notifications are kept in
+	// the history since they were last updated
+	defaultHistoryRetention = 30 * 24 * time.Hour
+)
+
+// Statuses of the notifications. Besides ours, Twilio reports the delivery
+// status of SMS and WhatsApp messages.
+const (
+	statusQueued      = "queued"
+	statusSent        = "sent"
+	statusDelivered   = "delivered"
+	statusUndelivered = "undelivered"
+	statusFailed      = "failed"
+	statusRead        = "read"
+)
+
+// statusRanks orders the statuses, so that callbacks arriving out of order
+// don't take a notification back to a previous status
+var statusRanks = map[string]int{
+	statusQueued:      0,
+	"accepted":        0,
+	"sending":         1,
+	statusSent:        2,
+	statusDelivered:   3,
+	statusUndelivered: 3,
+	statusFailed:      3,
+	statusRead:        4,
+}
+
+// historyMutex prevents concurrent updates of a notification from
+// overwriting each other
+var historyMutex sync.Mutex
+
+// StatusChange is a change in the status of a notification
+type StatusChange struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+// HistoryEntry is a notification sent to a customer, as stored in the
+// history
+type HistoryEntry struct {
+	ID         string         `json:"id"`
+	From       string         `json:"from"`
+	Channel    string         `json:"channel"`
+	Event      string         `json:"event"`
+	Title      string         `json:"title"`
+	Message    string         `json:"message"`
+	URL        string         `json:"url,omitempty"`
+	Status     string         `json:"status"`
+	Statuses   []StatusChange `json:"statuses"`
+	MessageSID string         `json:"message_sid,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Attempts   int            `json:"attempts"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// setStatus changes the status of the notification, unless it's already in
+// a later one
+func (n *HistoryEntry) setStatus(status string, at time.Time) {
+	if status == "" || status == n.Status {
+		return
+	}
+	n.Statuses = append(n.Statuses, StatusChange{Status: status, At: at})
+	n.UpdatedAt = at
+	if n.Status == "" || statusRanks[status] >= statusRanks[n.Status] {
+		n.Status = status
+	}
+}
+
+// saveNotification stores a notification in the history
+func saveNotification(n *HistoryEntry) error {
+	value, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return db.Save(n.ID, string(value), notificationsBucket)
+}
+
+// recordNotification adds the notification of an outbox entry to the
+// history, as queued
+func recordNotification(entry *outboxEntry) error {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	n := &HistoryEntry{
+		ID:        entry.ID,
+		From:      entry.Dest,
+		Channel:   entry.Channel,
+		Event:     entry.Notification.Event,
+		Title:     entry.Notification.Title,
+		Message:   entry.Notification.Message,
+		URL:       entry.Notification.URL,
+		CreatedAt: entry.CreatedAt,
+	}
+	n.setStatus(statusQueued, entry.CreatedAt)
+	return saveNotification(n)
+}
+
+// updateNotification applies a change to a notification of the history. It
+// returns an error if the notification doesn't exist.
+func updateNotification(id string, update func(n *HistoryEntry)) error {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	value, err := db.Get(id, notificationsBucket)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		return fmt.Errorf("notification %s not found", id)
+	}
+	n := &HistoryEntry{}
+	if err = json.Unmarshal([]byte(value), n); err != nil {
+		return err
+	}
+	update(n)
+	return saveNotification(n)
+}
+
+// recordAttempt updates the history with the result of an attempt to deliver
+// an outbox entry. Notifications without attempts left are marked as failed.
+func recordAttempt(entry *outboxEntry, err error) {
+	now := time.Now().UTC()
+	updateErr := updateNotification(entry.ID, func(n *HistoryEntry) {
+		n.Attempts = entry.Attempts
+		n.UpdatedAt = now
+		switch {
+		case err == nil:
+			n.Error = ""
+			n.setStatus(statusSent, now)
+		case entry.Attempts >= outboxMaxAttempts:
+			n.Error = err.Error()
+			n.setStatus(statusFailed, now)
+		default:
+			n.Error = err.Error()
+		}
+	})
+	if updateErr != nil {
+		sugar.Errorw("error when updating notification history", "id", entry.ID, "msg", updateErr.Error())
+	}
+}
+
+type historyPruner struct{}
+
+// Run deletes the notifications of the history which haven't been updated
+// during the retention period
+func (p historyPruner) Run() {
+	if err := pruneHistory(time.Now().UTC().Add(-historyRetention)); err != nil {
+		sugar.Errorw("error when pruning notification history", "msg", err.Error())
+	}
+}
+
+// pruneHistory deletes the notifications of the history last updated before
+// a time. Nothing is deleted when the retention is 0, which keeps the
+// history forever.
+func pruneHistory(before time.Time) error {
+	if historyRetention <= 0 {
+		return nil
+	}
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	results, err := db.GetAll(notificationsBucket)
+	if err != nil {
+		return err
+	}
+	pruned := 0
+	for id, value := range results {
+		n := &HistoryEntry{}
+		if err = json.Unmarshal([]byte(value), n); err == nil && !n.UpdatedAt.Before(before) {
+			continue
+		}
+		if err = db.Delete(id, notificationsBucket); err != nil {
+			return err
+		}
+		pruned++
+	}
+	sugar.Debugw("pruned notification history", "pruned", pruned, "kept", len(results)-pruned)
+	return nil
+}
+
+// twilioStatusCallback returns the URL Twilio reports the delivery status of
+// the messages to, if the service is publicly reachable
+func twilioStatusCallback() string {
+	if publicURL == "" {
+		return ""
+	}
+	return publicURL + "/twilio/status"
+}
+
+// postTwilioStatus receives the delivery status of SMS and WhatsApp messages
+// from Twilio
+func postTwilioStatus(c echo.Context) error {
+	valid, err := twilio.CheckSignature(twilioToken, publicURL, c.Request())
+	if err != nil || !valid {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"invalid twilio signature"})
+	}
+
+	id, status := c.QueryParam("id"), c.FormValue("MessageStatus")
+	if id == "" || status == "" {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid status: id and MessageStatus are required"})
+	}
+	sugar.Debugw("received twilio status", "id", id, "status", status, "sid", c.FormValue("MessageSid"))
+	err = updateNotification(id, func(n *HistoryEntry) {
+		if sid := c.FormValue("MessageSid"); sid != "" {
+			n.MessageSID = sid
+		}
+		if code := c.FormValue("ErrorCode"); code != "" {
+			n.Error = fmt.Sprintf("twilio error code %s", code)
+		}
+		n.setStatus(status, time.Now().UTC())
+	})
+	if err != nil {
+		sugar.Errorw("error when recording twilio status", "id", id, "status", status, "msg", err.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getNotifications returns the history of the notifications sent to a
+// customer through a channel, newest first
+func getNotifications(c echo.Context) error {
+	from, channel := c.QueryParam("from"), c.QueryParam("channel")
+	if from == "" {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid query: from is required"})
+	}
+	if channel == "" {
+		channel = defaultChannel
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.isVerified(channel, from) {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"invalid from: the destination doesn't belong to the user"})
+	}
+	status := c.QueryParam("status")
+	limit := defaultHistoryLimit
+	if l := c.QueryParam("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid limit: %s", l)})
+		}
+	}
+
+	results, err := db.GetAll(notificationsBucket)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(results))
+	for id := range results {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	notifications := []*HistoryEntry{}
+	for _, id := range ids {
+		n := &HistoryEntry{}
+		if err = json.Unmarshal([]byte(results[id]), n); err != nil {
+			sugar.Errorw("invalid notification in history", "id", id, "msg", err.Error())
+			continue
+		}
+		if n.From != from || n.Channel != channel || (status != "" && n.Status != status) {
+			continue
+		}
+		notifications = append(notifications, n)
+		if len(notifications) == limit {
+			break
+		}
+	}
+	return c.JSON(http.StatusOK, notifications)
+}
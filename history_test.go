@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sfreiberg/gotwilio"
+	"github.com/stretchr/testify/assert"
+)
+
+// saveHistory adds a notification to the history
+func saveHistory(t *testing.T, id, from, channel, status string, updatedAt time.Time) {
+	n := &HistoryEntry{ID: id, From: from, Channel: channel, Status: status, CreatedAt: updatedAt, UpdatedAt: updatedAt}
+	if err := saveNotification(n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadHistory returns a notification of the history
+func loadHistory(t *testing.T, id string) *HistoryEntry {
+	value, err := db.Get(id, notificationsBucket)
+	if err != nil || value == "" {
+		t.Fatalf("notification %s not found: %v", id, err)
+	}
+	n := &HistoryEntry{}
+	if err = json.Unmarshal([]byte(value), n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSetStatus(t *testing.T) {
+	testCases := []struct {
+		name     string
+		statuses []string
+		expected string
+	}{
+		{name: "in order", statuses: []string{statusQueued, statusSent, statusDelivered, statusRead}, expected: statusRead},
+		{name: "sent after delivered", statuses: []string{statusQueued, statusDelivered, statusSent}, expected: statusDelivered},
+		{name: "sending after sent", statuses: []string{statusQueued, statusSent, "sending"}, expected: statusSent},
+		{name: "undelivered after sent", statuses: []string{statusQueued, statusSent, statusUndelivered}, expected: statusUndelivered},
+		{name: "unknown status", statuses: []string{statusSent, "scheduled"}, expected: statusSent},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			n := &HistoryEntry{}
+			for _, status := range tc.statuses {
+				n.setStatus(status, time.Now().UTC())
+			}
+			assert.Equal(tt, tc.expected, n.Status)
+			assert.Len(tt, n.Statuses, len(tc.statuses))
+		})
+	}
+}
+
+func TestGetNotifications(t *testing.T) {
+	setUp(t)
+	e := newServer()
+	verify(t, "alice", "alice-phone")
+	verify(t, "bob", "bob-phone")
+	now := time.Now().UTC()
+	saveHistory(t, "01", "alice-phone", testChannel, statusDelivered, now)
+	saveHistory(t, "02", "alice-phone", testChannel, statusFailed, now)
+	saveHistory(t, "03", "alice-phone", testChannel, statusDelivered, now)
+	saveHistory(t, "04", "alice-phone", smsChannel, statusDelivered, now)
+	saveHistory(t, "05", "bob-phone", testChannel, statusDelivered, now)
+
+	testCases := []struct {
+		name     string
+		query    string
+		status   int
+		expected []string
+	}{
+		{name: "newest first", query: "from=alice-phone", status: http.StatusOK, expected: []string{"03", "02", "01"}},
+		{name: "by status", query: "from=alice-phone&status=delivered", status: http.StatusOK, expected: []string{"03", "01"}},
+		{name: "with limit", query: "from=alice-phone&limit=2", status: http.StatusOK, expected: []string{"03", "02"}},
+		{name: "without notifications", query: "from=alice-phone&status=read", status: http.StatusOK, expected: []string{}},
+		{name: "missing from", query: "", status: http.StatusBadRequest},
+		{name: "invalid limit", query: "from=alice-phone&limit=ten", status: http.StatusBadRequest},
+		{name: "limit too low", query: "from=alice-phone&limit=0", status: http.StatusBadRequest},
+		{name: "limit too high", query: "from=alice-phone&limit=501", status: http.StatusBadRequest},
+		{name: "destination of another user", query: "from=bob-phone", status: http.StatusForbidden},
+		{name: "unverified channel", query: "from=alice-phone&channel=sms", status: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			rec := request(e, http.MethodGet, "/v1/notifications?"+tc.query, token("alice"), nil)
+			assert.Equal(tt, tc.status, rec.Code, rec.Body.String())
+			if tc.expected == nil {
+				return
+			}
+			notifications := []*HistoryEntry{}
+			assert.NoError(tt, json.Unmarshal(rec.Body.Bytes(), &notifications))
+			ids := []string{}
+			for _, n := range notifications {
+				ids = append(ids, n.ID)
+			}
+			assert.Equal(tt, tc.expected, ids)
+		})
+	}
+}
+
+func TestPostTwilioStatus(t *testing.T) {
+	setUp(t)
+	prevToken, prevURL := twilioToken, publicURL
+	twilioToken, publicURL = "token", "https://hermezon.example.com"
+	t.Cleanup(func() { twilioToken, publicURL = prevToken, prevURL })
+	e := newServer()
+	saveHistory(t, "01", "+34698765432", smsChannel, statusSent, time.Now().UTC())
+
+	// status posts the status of a notification, signed by Twilio unless the
+	// signature is given
+	status := func(id string, form url.Values, signature string) *httptest.ResponseRecorder {
+		path := "/twilio/status?id=" + id
+		if signature == "" {
+			signed, err := gotwilio.NewTwilioClient("", twilioToken).GenerateSignature(publicURL+path, form)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signature = string(signed)
+		}
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.Header.Set("X-Twilio-Signature", signature)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	testCases := []struct {
+		name      string
+		id        string
+		form      url.Values
+		signature string
+		code      int
+		expected  string
+	}{
+		{name: "invalid signature", id: "01", form: url.Values{"MessageStatus": {statusDelivered}}, signature: "invalid", code: http.StatusForbidden, expected: statusSent},
+		{name: "delivered", id: "01", form: url.Values{"MessageStatus": {statusDelivered}, "MessageSid": {"SM123"}}, code: http.StatusNoContent, expected: statusDelivered},
+		{name: "sent after delivered", id: "01", form: url.Values{"MessageStatus": {statusSent}}, code: http.StatusNoContent, expected: statusDelivered},
+		{name: "read", id: "01", form: url.Values{"MessageStatus": {statusRead}}, code: http.StatusNoContent, expected: statusRead},
+		{name: "missing status", id: "01", form: url.Values{"MessageSid": {"SM123"}}, code: http.StatusBadRequest, expected: statusRead},
+		{name: "unknown notification", id: "02", form: url.Values{"MessageStatus": {statusDelivered}}, code: http.StatusNoContent},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			rec := status(tc.id, tc.form, tc.signature)
+			assert.Equal(tt, tc.code, rec.Code, rec.Body.String())
+			if tc.expected != "" {
+				assert.Equal(tt, tc.expected, loadHistory(tt, tc.id).Status)
+			}
+		})
+	}
+	n := loadHistory(t, "01")
+	assert.Equal(t, "SM123", n.MessageSID)
+	assert.Len(t, n.Statuses, 3)
+
+	rec := status("01", url.Values{"MessageStatus": {statusFailed}, "ErrorCode": {"30003"}}, "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "twilio error code 30003", loadHistory(t, "01").Error)
+}
+
+func TestPruneHistory(t *testing.T) {
+	setUp(t)
+	now := time.Now().UTC()
+	saveHistory(t, "01", "alice-phone", testChannel, statusDelivered, now.Add(-historyRetention-time.Hour))
+	saveHistory(t, "02", "alice-phone", testChannel, statusDelivered, now.Add(-time.Hour))
+	assert.NoError(t, db.Save("03", "invalid", notificationsBucket))
+
+	historyRetention = 0
+	assert.NoError(t, pruneHistory(now))
+	results, err := db.GetAll(notificationsBucket)
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+
+	historyRetention = defaultHistoryRetention
+	assert.NoError(t, pruneHistory(now.Add(-historyRetention)))
+	results, err = db.GetAll(notificationsBucket)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Contains(t, results, "02")
+}
@@ -0,0 +1,393 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/igvaquero18/hermezon/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRefreshInterval is the default time keys are used for before
+	// loading the key set again
+	DefaultRefreshInterval = time.Hour
+	// DefaultMinRefreshInterval is the default minimum time between loads of
+	// the key set triggered by tokens signed with unknown keys
+	DefaultMinRefreshInterval = time.Minute
+)
+
+// KeySet is a JSON Web Key Set (RFC 7517) whose RSA and ECDSA public keys
+// verify the tokens of an identity provider. Keys are loaded again every
+// refresh interval, and when a token is signed with an unknown key, so
+// rotated keys are picked up.
+type KeySet struct {
+	fetch              func() ([]byte, error)
+	keys               map[string]*key
+	loading            *load
+	refreshedAt        time.Time
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	client             *http.Client
+	mutex              sync.Mutex
+	utils.Logger
+}
+
+// load is a load of the key set in progress, whose result is shared by the
+// callers waiting for it
+type load struct {
+	done chan struct{}
+	err  error
+}
+
+// key is a public key of the key set, with the algorithm it must be used
+// with, if any
+type key struct {
+	alg    string
+	public interface{}
+}
+
+// jsonKey is a key of a JSON Web Key Set
+type jsonKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Option is a function to apply settings to KeySet structure
+type Option func(k *KeySet) Option
+
+// NewFileKeySet returns a new KeySet loaded from a JSON file
+func NewFileKeySet(path string, opts ...Option) *KeySet {
+	k := newKeySet(opts...)
+	k.fetch = func() ([]byte, error) {
+		return ioutil.ReadFile(path)
+	}
+	return k
+}
+
+// NewHTTPKeySet returns a new KeySet loaded from a URL, like the jwks_uri of
+// an OpenID Connect provider
+func NewHTTPKeySet(url string, opts ...Option) *KeySet {
+	k := newKeySet(opts...)
+	k.fetch = func() ([]byte, error) {
+		resp, err := k.client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("jwks response status code: %d, body: %s", resp.StatusCode, string(body))
+		}
+		return body, nil
+	}
+	return k
+}
+
+// newKeySet returns a KeySet with the default settings and the options
+func newKeySet(opts ...Option) *KeySet {
+	k := &KeySet{
+		refreshInterval:    DefaultRefreshInterval,
+		minRefreshInterval: DefaultMinRefreshInterval,
+		client:             &http.Client{Timeout: 10 * time.Second},
+		Logger:             &utils.DefaultLogger{},
+	}
+	for _, opt := range opts {
+		opt(k)
+	}
+	return k
+}
+
+// SetRefreshInterval Sets the time keys are used for before loading the key
+// set again
+func SetRefreshInterval(interval time.Duration) Option {
+	return func(k *KeySet) Option {
+		prev := k.refreshInterval
+		k.refreshInterval = interval
+		return SetRefreshInterval(prev)
+	}
+}
+
+// SetMinRefreshInterval Sets the minimum time between loads of the key set
+// triggered by unknown keys
+func SetMinRefreshInterval(interval time.Duration) Option {
+	return func(k *KeySet) Option {
+		prev := k.minRefreshInterval
+		k.minRefreshInterval = interval
+		return SetMinRefreshInterval(prev)
+	}
+}
+
+// SetHTTPClient Sets the HTTP client for KeySet
+func SetHTTPClient(client *http.Client) Option {
+	return func(k *KeySet) Option {
+		prev := k.client
+		k.client = client
+		return SetHTTPClient(prev)
+	}
+}
+
+// SetLogger Sets the logger for KeySet
+func SetLogger(logger utils.Logger) Option {
+	return func(k *KeySet) Option {
+		prev := k.Logger
+		k.Logger = logger
+		return SetLogger(prev)
+	}
+}
+
+// Refresh loads the key set again
+func (k *KeySet) Refresh() error {
+	return k.refresh()
+}
+
+// refresh loads the key set, keeping the previous keys if it fails. The key
+// set is fetched without holding the lock, so the known keys can be used
+// meanwhile, and only once at a time: concurrent callers wait for the load
+// in progress and get its result.
+func (k *KeySet) refresh() error {
+	k.mutex.Lock()
+	if l := k.loading; l != nil {
+		k.mutex.Unlock()
+		<-l.done
+		return l.err
+	}
+	l := &load{done: make(chan struct{})}
+	k.loading = l
+	k.refreshedAt = time.Now()
+	k.mutex.Unlock()
+
+	var keys map[string]*key
+	body, err := k.fetch()
+	if err != nil {
+		err = errors.Wrap(err, "error when loading jwks")
+	} else {
+		keys, err = parseKeys(body)
+	}
+
+	k.mutex.Lock()
+	if err == nil {
+		k.Debugw("jwks loaded", "keys", len(keys))
+		k.keys = keys
+	}
+	k.loading = nil
+	k.mutex.Unlock()
+	l.err = err
+	close(l.done)
+	return err
+}
+
+// parseKeys parses the RSA and ECDSA signing keys of a JSON Web Key Set,
+// indexed by their key ID. Other keys are skipped.
+func parseKeys(body []byte) (map[string]*key, error) {
+	set := struct {
+		Keys []jsonKey `json:"keys"`
+	}{}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, errors.Wrap(err, "error when decoding jwks")
+	}
+	keys := make(map[string]*key, len(set.Keys))
+	for _, jk := range set.Keys {
+		if jk.Use != "" && jk.Use != "sig" {
+			continue
+		}
+		var public interface{}
+		var err error
+		switch jk.Kty {
+		case "RSA":
+			public, err = jk.rsa()
+		case "EC":
+			public, err = jk.ecdsa()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %s", jk.Kid)
+		}
+		keys[jk.Kid] = &key{alg: jk.Alg, public: public}
+	}
+	return keys, nil
+}
+
+// rsa returns the RSA public key of a JSON Web Key
+func (jk *jsonKey) rsa() (*rsa.PublicKey, error) {
+	n, err := decodeInt(jk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeInt(jk.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid rsa exponent")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+// ecdsa returns the ECDSA public key of a JSON Web Key
+func (jk *jsonKey) ecdsa() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch jk.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", jk.Crv)
+	}
+	x, err := decodeInt(jk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeInt(jk.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("the point is not on the curve %s", jk.Crv)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// decodeInt decodes a base64url encoded big-endian integer
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// lookup returns the key with the given ID. Tokens without key ID can be
+// verified with the only key of a set. It must be called with the lock held.
+func (k *KeySet) lookup(kid string) (*key, bool) {
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// key returns the key with the given ID, loading the key set again when the
+// keys are stale or the key is unknown
+func (k *KeySet) key(kid string) (*key, error) {
+	k.mutex.Lock()
+	stale := k.keys == nil || time.Since(k.refreshedAt) >= k.refreshInterval
+	k.mutex.Unlock()
+	if stale {
+		if err := k.refresh(); err != nil {
+			k.mutex.Lock()
+			loaded := k.keys != nil
+			k.mutex.Unlock()
+			if !loaded {
+				return nil, err
+			}
+			k.Errorw("error when refreshing jwks. Keeping the previous keys...", "msg", err.Error())
+		}
+	}
+
+	k.mutex.Lock()
+	key, ok := k.lookup(kid)
+	retry := !ok && time.Since(k.refreshedAt) >= k.minRefreshInterval
+	k.mutex.Unlock()
+	if retry {
+		k.Debugw("unknown key id. Refreshing jwks...", "kid", kid)
+		if err := k.refresh(); err != nil {
+			k.Errorw("error when refreshing jwks. Keeping the previous keys...", "msg", err.Error())
+		}
+		k.mutex.Lock()
+		key, ok = k.lookup(kid)
+		k.mutex.Unlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown jwt key id=%s", kid)
+	}
+	return key, nil
+}
+
+// Keyfunc returns the key a token is verified with, checking that its
+// signing method matches the type and algorithm of the key. It's meant to be
+// used as the jwt.Keyfunc of jwt.Parse.
+func (k *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, err := k.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.alg != "" && key.alg != t.Method.Alg() {
+		return nil, fmt.Errorf("unexpected jwt signing method=%v for key id=%s", t.Header["alg"], kid)
+	}
+	switch key.public.(type) {
+	case *rsa.PublicKey:
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); ok {
+			return key.public, nil
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := t.Method.(*jwt.SigningMethodECDSA); ok {
+			return key.public, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected jwt signing method=%v for key id=%s", t.Header["alg"], kid)
+}
+
+// CheckClaims checks the issuer and audience of the claims of a token. Empty
+// issuers and audiences aren't checked.
+func CheckClaims(claims jwt.MapClaims, audience, issuer string) error {
+	if issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != issuer {
+			return fmt.Errorf("unexpected jwt issuer=%v", claims["iss"])
+		}
+	}
+	if audience == "" {
+		return nil
+	}
+	switch aud := claims["aud"].(type) {
+	case string:
+		if aud == audience {
+			return nil
+		}
+	case []interface{}:
+		for _, a := range aud {
+			if s, _ := a.(string); s == audience {
+				return nil
+			}
+		}
+	case []string:
+		for _, s := range aud {
+			if s == audience {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unexpected jwt audience=%v", claims["aud"])
+}
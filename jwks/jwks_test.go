@@ -0,0 +1,290 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	rsaKey, _   = rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _    = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+// encodeInt encodes a big-endian integer in base64url
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+// rsaJWK returns the JSON Web Key of an RSA public key
+func rsaJWK(kid, alg string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": alg,
+		"n":   encodeInt(key.N),
+		"e":   encodeInt(big.NewInt(int64(key.E))),
+	}
+}
+
+// ecJWK returns the JSON Web Key of an ECDSA public key
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   encodeInt(key.X),
+		"y":   encodeInt(key.Y),
+	}
+}
+
+// jwks returns a JSON Web Key Set with the keys
+func jwks(keys ...map[string]string) string {
+	body, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	return string(body)
+}
+
+// sign returns a token signed with the key
+func sign(method jwt.SigningMethod, kid string, key interface{}) string {
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// server is a stand-in for the JWKS endpoint of an identity provider, whose
+// keys can be rotated
+type server struct {
+	mutex sync.Mutex
+	body  string
+	calls int
+}
+
+func (s *server) rotate(body string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.body = body
+}
+
+func (s *server) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.calls
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls++
+	fmt.Fprint(w, s.body)
+}
+
+func TestKeyfunc(t *testing.T) {
+	enc := rsaJWK("enc", "", &otherKey.PublicKey)
+	enc["use"] = "enc"
+	stand := &server{body: jwks(
+		rsaJWK("rsa", "RS256", &rsaKey.PublicKey),
+		ecJWK("ec", &ecKey.PublicKey),
+		map[string]string{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		enc,
+	)}
+	srv := httptest.NewServer(stand)
+	defer srv.Close()
+
+	testCases := []struct {
+		name  string
+		token string
+		err   bool
+	}{
+		{name: "RS256 token", token: sign(jwt.SigningMethodRS256, "rsa", rsaKey)},
+		{name: "ES256 token", token: sign(jwt.SigningMethodES256, "ec", ecKey)},
+		{name: "token signed with another key", token: sign(jwt.SigningMethodRS256, "rsa", otherKey), err: true},
+		{name: "unknown key id", token: sign(jwt.SigningMethodRS256, "unknown", rsaKey), err: true},
+		{name: "encryption key", token: sign(jwt.SigningMethodRS256, "enc", otherKey), err: true},
+		{name: "symmetric key", token: sign(jwt.SigningMethodHS256, "hmac", []byte("secret")), err: true},
+		{name: "algorithm of another key", token: sign(jwt.SigningMethodRS384, "rsa", rsaKey), err: true},
+		{name: "ES256 header with rsa key", token: sign(jwt.SigningMethodES256, "rsa", ecKey), err: true},
+		{name: "without key id", token: sign(jwt.SigningMethodRS256, "", rsaKey), err: true},
+	}
+
+	keySet := NewHTTPKeySet(srv.URL, SetHTTPClient(srv.Client()))
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			token, err := jwt.Parse(tc.token, keySet.Keyfunc)
+			if tc.err {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+				assert.True(tt, token.Valid)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	stand := &server{body: jwks(rsaJWK("2021-01", "RS256", &rsaKey.PublicKey))}
+	srv := httptest.NewServer(stand)
+	defer srv.Close()
+
+	keySet := NewHTTPKeySet(srv.URL, SetHTTPClient(srv.Client()), SetMinRefreshInterval(0))
+	_, err := jwt.Parse(sign(jwt.SigningMethodRS256, "2021-01", rsaKey), keySet.Keyfunc)
+	assert.NoError(t, err)
+	_, err = jwt.Parse(sign(jwt.SigningMethodRS256, "2021-02", otherKey), keySet.Keyfunc)
+	assert.Error(t, err)
+
+	stand.rotate(jwks(rsaJWK("2021-02", "RS256", &otherKey.PublicKey)))
+	_, err = jwt.Parse(sign(jwt.SigningMethodRS256, "2021-02", otherKey), keySet.Keyfunc)
+	assert.NoError(t, err)
+	_, err = jwt.Parse(sign(jwt.SigningMethodRS256, "2021-01", rsaKey), keySet.Keyfunc)
+	assert.Error(t, err)
+
+	// Unknown keys don't load the key set again before the minimum interval
+	SetMinRefreshInterval(time.Hour)(keySet)
+	calls := stand.count()
+	_, err = jwt.Parse(sign(jwt.SigningMethodRS256, "2021-03", rsaKey), keySet.Keyfunc)
+	assert.Error(t, err)
+	assert.Equal(t, calls, stand.count())
+
+	// Stale keys are kept when the key set can't be loaded again
+	SetRefreshInterval(0)(keySet)
+	stand.rotate(`<html></html>`)
+	_, err = jwt.Parse(sign(jwt.SigningMethodRS256, "2021-02", otherKey), keySet.Keyfunc)
+	assert.NoError(t, err)
+}
+
+// blockingFetch returns a fetch of the key set which blocks until it's
+// released, signaling every call
+func blockingFetch(body string, calls chan<- struct{}, release <-chan struct{}) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		calls <- struct{}{}
+		<-release
+		return []byte(body), nil
+	}
+}
+
+func TestConcurrentLoads(t *testing.T) {
+	calls, release := make(chan struct{}, 10), make(chan struct{})
+	keySet := newKeySet()
+	keySet.fetch = blockingFetch(jwks(rsaJWK("rsa", "RS256", &rsaKey.PublicKey)), calls, release)
+
+	// Tokens verified while the key set is loaded wait for that load
+	errs := make(chan error, 5)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := jwt.Parse(sign(jwt.SigningMethodRS256, "rsa", rsaKey), keySet.Keyfunc)
+			errs <- err
+		}()
+	}
+	<-calls
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+	assert.Len(t, calls, 0)
+}
+
+func TestKeysDuringRefresh(t *testing.T) {
+	calls, release := make(chan struct{}, 10), make(chan struct{})
+	keySet := newKeySet()
+	keySet.fetch = func() ([]byte, error) {
+		return []byte(jwks(rsaJWK("rsa", "RS256", &rsaKey.PublicKey))), nil
+	}
+	assert.NoError(t, keySet.Refresh())
+
+	keySet.fetch = blockingFetch(jwks(rsaJWK("other", "RS256", &otherKey.PublicKey)), calls, release)
+	refreshed := make(chan error)
+	go func() { refreshed <- keySet.Refresh() }()
+	<-calls
+
+	// The known keys verify tokens while the key set is being loaded
+	parsed := make(chan error)
+	go func() {
+		_, err := jwt.Parse(sign(jwt.SigningMethodRS256, "rsa", rsaKey), keySet.Keyfunc)
+		parsed <- err
+	}()
+	select {
+	case err := <-parsed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("token not verified while the key set was being loaded")
+	}
+
+	close(release)
+	assert.NoError(t, <-refreshed)
+	_, err := jwt.Parse(sign(jwt.SigningMethodRS256, "other", otherKey), keySet.Keyfunc)
+	assert.NoError(t, err)
+}
+
+func TestNewFileKeySet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jwks.json")
+
+	keySet := NewFileKeySet(path)
+	assert.Error(t, keySet.Refresh())
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(jwks(ecJWK("ec", &ecKey.PublicKey))), 0600))
+	assert.NoError(t, keySet.Refresh())
+	_, err = jwt.Parse(sign(jwt.SigningMethodES256, "ec", ecKey), keySet.Keyfunc)
+	assert.NoError(t, err)
+	_, err = jwt.Parse(sign(jwt.SigningMethodES256, "", ecKey), keySet.Keyfunc)
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"keys": [{"kty": "EC", "kid": "ec", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`), 0600))
+	assert.Error(t, keySet.Refresh())
+}
+
+func TestCheckClaims(t *testing.T) {
+	testCases := []struct {
+		name     string
+		claims   jwt.MapClaims
+		audience string
+		issuer   string
+		err      bool
+	}{
+		{name: "nothing to check", claims: jwt.MapClaims{}},
+		{name: "matching issuer", claims: jwt.MapClaims{"iss": "https://id.example.com"}, issuer: "https://id.example.com"},
+		{name: "another issuer", claims: jwt.MapClaims{"iss": "https://evil.example.com"}, issuer: "https://id.example.com", err: true},
+		{name: "missing issuer", claims: jwt.MapClaims{}, issuer: "https://id.example.com", err: true},
+		{name: "matching audience", claims: jwt.MapClaims{"aud": "hermezon"}, audience: "hermezon"},
+		{name: "audience in list", claims: jwt.MapClaims{"aud": []interface{}{"other", "hermezon"}}, audience: "hermezon"},
+		{name: "another audience", claims: jwt.MapClaims{"aud": "other"}, audience: "hermezon", err: true},
+		{name: "missing audience", claims: jwt.MapClaims{}, audience: "hermezon", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			err := CheckClaims(tc.claims, tc.audience, tc.issuer)
+			if tc.err {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/igvaquero18/hermezon/templates"
+)
+
+const (
+	// seenItemsBucket is the bucket where the URLs of the items already seen
+	// in every listing are stored, with the last time they were seen, under
+	// the key of the listing action
+	seenItemsBucket = "listing_seen"
+
+	// seenItemsTTL is the time the items of a listing are remembered for
+	// since they were last seen in it. Items which show up again later are
+	// notified as new.
+	seenItemsTTL = 30 * 24 * time.Hour
+	// maxSeenItems is the number of items remembered for every listing. The
+	// ones seen longer ago are forgotten first.
+	maxSeenItems = 1000
+)
+
+type listing struct{}
+
+// Run checks all the listings in the database, looking for new
+// products that match the filters of each listing.
+func (l listing) Run() {
+	sugar.Debug("checking all listings for new products")
+	actions, err := loadActions(listingAction)
+	if err != nil {
+		sugar.Fatalw("error when reading the database", "msg", err.Error())
+	}
+	for k, action := range actions {
+		databaseKey := k
+		action := action
+		channel := action.From
+		url := action.URL
+
+		var maxPrice float64
+		if action.MaxPrice != "" {
+			maxPrice, err = parseAmount(action.MaxPrice)
+			if err != nil {
+				sugar.Errorw("invalid max price retrieved from database", "key", databaseKey, "msg", err.Error())
+				continue
+			}
+		}
+
+		sugar.Debugw("checking listing for customer",
+			"channel", channel,
+			"url", url,
+			"item_selector", action.ItemSelector,
+			"selector", action.Selector,
+			"keywords", action.Keywords,
+			"max_price", action.MaxPrice,
+		)
+
+		// Build the scraper
+		scr := scraper.NewScraper(
+			scraper.SetExpectedStatusCode(expectedStatusCode),
+			scraper.SetLogger(sugar),
+			scraper.SetMaxRetries(maxRetries),
+			scraper.SetRetrySeconds(retrySeconds),
+			scraper.SetSelector(action.Selector),
+			scraper.SetItemSelector(action.ItemSelector),
+			scraper.SetURL(url),
+		)
+
+		go func() {
+			items, err := scr.Listing()
+			if err != nil {
+				sugar.Errorw("error when checking listing", "channel", channel, "url", url, "msg", err.Error())
+				return
+			}
+			checkListing(databaseKey, action, maxPrice, items)
+		}()
+	}
+}
+
+// checkListing notifies the items of a listing which weren't seen before and
+// match its filters, remembering all of them
+func checkListing(databaseKey string, action *Action, maxPrice float64, items []scraper.Item) {
+	channel, url := action.From, action.URL
+	seen, found, err := loadSeenItems(databaseKey)
+	if err != nil {
+		sugar.Errorw("error when reading seen items", "key", databaseKey, "msg", err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	newItems := []scraper.Item{}
+	for _, item := range items {
+		_, known := seen[item.URL]
+		seen[item.URL] = now
+		if !known && matchesListingFilters(item, action.Keywords, maxPrice) {
+			newItems = append(newItems, item)
+		}
+	}
+
+	// The first time a listing is checked every item is new, so we
+	// just remember them instead of flooding the customer
+	if found && len(newItems) > 0 {
+		sugar.Debugw("New products found!", "channel", channel, "url", url, "items", len(newItems))
+		err = notify(templates.EventListing, action.Channel, channel, action.Locale, &templates.Data{
+			URL:      url,
+			Items:    newItems,
+			Tracking: action,
+			Priority: action.Priority,
+			Tags:     action.Tags,
+		})
+		if errors.Is(err, errSuppressed) {
+			sugar.Debugw("Notification suppressed. The new products will be notified again...", "channel", channel, "url", url)
+			return
+		}
+		if err != nil {
+			sugar.Errorw("error when queueing notification", "msg", err.Error())
+			return
+		}
+	}
+
+	if err = saveSeenItems(databaseKey, seen, now); err != nil {
+		sugar.Errorw("error when saving seen items", "key", databaseKey, "msg", err.Error())
+	}
+}
+
+// matchesListingFilters returns true if the title of the item contains all
+// the keywords and its price, when known, isn't above maxPrice. A maxPrice
+// of 0 means no limit.
+func matchesListingFilters(item scraper.Item, keywords []string, maxPrice float64) bool {
+	title := strings.ToLower(item.Title)
+	for _, keyword := range keywords {
+		if !strings.Contains(title, strings.ToLower(strings.TrimSpace(keyword))) {
+			return false
+		}
+	}
+	return maxPrice == 0 || item.Price == 0 || item.Price <= maxPrice
+}
+
+// loadSeenItems returns the item URLs already seen for a listing, with the
+// last time they were seen, and whether the listing had been checked before.
+// Items used to be stored as a list of URLs, so that format is still
+// understood, as if they were just seen.
+func loadSeenItems(key string) (map[string]time.Time, bool, error) {
+	seen := map[string]time.Time{}
+	value, err := db.Get(key, seenItemsBucket)
+	if err != nil || value == "" {
+		return seen, false, err
+	}
+	if strings.HasPrefix(value, "[") {
+		urls := []string{}
+		if err = json.Unmarshal([]byte(value), &urls); err != nil {
+			return nil, false, err
+		}
+		now := time.Now().UTC()
+		for _, url := range urls {
+			seen[url] = now
+		}
+		return seen, true, nil
+	}
+	if err = json.Unmarshal([]byte(value), &seen); err != nil {
+		return nil, false, err
+	}
+	return seen, true, nil
+}
+
+// saveSeenItems stores the item URLs already seen for a listing, forgetting
+// the ones not seen for seenItemsTTL and, over maxSeenItems, the ones seen
+// longer ago
+func saveSeenItems(key string, seen map[string]time.Time, now time.Time) error {
+	urls := make([]string, 0, len(seen))
+	for url, at := range seen {
+		if now.Sub(at) < seenItemsTTL {
+			urls = append(urls, url)
+		}
+	}
+	if len(urls) > maxSeenItems {
+		sort.Slice(urls, func(i, j int) bool {
+			if !seen[urls[i]].Equal(seen[urls[j]]) {
+				return seen[urls[i]].After(seen[urls[j]])
+			}
+			return urls[i] < urls[j]
+		})
+		urls = urls[:maxSeenItems]
+	}
+	kept := make(map[string]time.Time, len(urls))
+	for _, url := range urls {
+		kept[url] = seen[url]
+	}
+	value, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	return db.Save(key, string(value), seenItemsBucket)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchesListingFilters(t *testing.T) {
+	testCases := []struct {
+		name     string
+		item     scraper.Item
+		keywords []string
+		maxPrice float64
+		expected bool
+	}{
+		{name: "no filters", item: scraper.Item{Title: "Sony PlayStation 5", Price: 499.99}, expected: true},
+		{name: "all keywords in any case", item: scraper.Item{Title: "Sony PlayStation 5"}, keywords: []string{"playstation", " SONY "}, expected: true},
+		{name: "missing keyword", item: scraper.Item{Title: "Sony PlayStation 5"}, keywords: []string{"playstation", "digital"}},
+		{name: "below max price", item: scraper.Item{Title: "Xbox Series X", Price: 449.99}, maxPrice: 450, expected: true},
+		{name: "at max price", item: scraper.Item{Title: "Xbox Series X", Price: 450}, maxPrice: 450, expected: true},
+		{name: "above max price", item: scraper.Item{Title: "Xbox Series X", Price: 499.99}, maxPrice: 450},
+		{name: "unknown price", item: scraper.Item{Title: "Xbox Series X"}, maxPrice: 450, expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, matchesListingFilters(tc.item, tc.keywords, tc.maxPrice))
+		})
+	}
+}
+
+func TestCheckListing(t *testing.T) {
+	fake := setUp(t)
+	action := &Action{Type: listingAction, From: "alice", Channel: testChannel, URL: "https://www.amazon.es/s?k=consola", Keywords: []string{"playstation"}, Tags: []string{"video_game"}}
+	key := action.key()
+	ps5 := scraper.Item{URL: "https://www.amazon.es/dp/B08KKJ37F7", Title: "Sony PlayStation 5", Price: 499.99}
+	digital := scraper.Item{URL: "https://www.amazon.es/dp/B08KJF2D25", Title: "Sony PlayStation 5 Digital Edition", Price: 399.99}
+	xbox := scraper.Item{URL: "https://www.amazon.es/dp/B08H93ZRK9", Title: "Xbox Series X", Price: 499.99}
+
+	// The items of the first check are only remembered
+	checkListing(key, action, 0, []scraper.Item{ps5, xbox})
+	assert.Empty(t, fake.messages())
+
+	checkListing(key, action, 0, []scraper.Item{ps5, digital, xbox})
+	messages := fake.messages()
+	if assert.Len(t, messages, 1) {
+		assert.Contains(t, messages[0], digital.Title)
+		assert.NotContains(t, messages[0], xbox.Title)
+		assert.Equal(t, action.Tags, fake.sent[0].Tags)
+	}
+
+	// Items which don't match the filters are remembered too
+	checkListing(key, action, 0, []scraper.Item{ps5, digital, xbox, {URL: "https://www.amazon.es/dp/B08FC6MR62", Title: "Nintendo Switch"}})
+	assert.Len(t, fake.messages(), 1)
+	seen, found, err := loadSeenItems(key)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Len(t, seen, 4)
+}
+
+func TestCheckListingSuppressed(t *testing.T) {
+	fake := setUp(t)
+	recipientRateLimit = 1
+	action := &Action{Type: listingAction, From: "alice", Channel: testChannel, URL: "https://www.amazon.es/s?k=consola"}
+	key := action.key()
+	checkListing(key, action, 0, []scraper.Item{{URL: "https://www.amazon.es/dp/1", Title: "First"}})
+	checkListing(key, action, 0, []scraper.Item{{URL: "https://www.amazon.es/dp/2", Title: "Second"}})
+	assert.Len(t, fake.messages(), 1)
+
+	// Items of suppressed notifications stay new until they are notified
+	checkListing(key, action, 0, []scraper.Item{{URL: "https://www.amazon.es/dp/3", Title: "Third"}})
+	assert.Len(t, fake.messages(), 1)
+	recipientRateLimit = 0
+	checkListing(key, action, 0, []scraper.Item{{URL: "https://www.amazon.es/dp/3", Title: "Third"}})
+	messages := fake.messages()
+	if assert.Len(t, messages, 2) {
+		assert.Contains(t, messages[1], "Third")
+	}
+}
+
+func TestSeenItems(t *testing.T) {
+	setUp(t)
+	now := time.Now().UTC()
+
+	// Listings checked before the last time items were seen was stored
+	assert.NoError(t, db.Save("legacy", `["https://www.amazon.es/dp/1","https://www.amazon.es/dp/2"]`, seenItemsBucket))
+	seen, found, err := loadSeenItems("legacy")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Len(t, seen, 2)
+	assert.WithinDuration(t, now, seen["https://www.amazon.es/dp/1"], time.Minute)
+
+	_, found, err = loadSeenItems("unknown")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	seen = map[string]time.Time{
+		"https://www.amazon.es/dp/expired": now.Add(-seenItemsTTL),
+		"https://www.amazon.es/dp/recent":  now.Add(-time.Hour),
+	}
+	for i := 0; i < maxSeenItems; i++ {
+		seen[fmt.Sprintf("https://www.amazon.es/dp/%d", i)] = now.Add(-time.Duration(i) * time.Minute)
+	}
+	assert.NoError(t, saveSeenItems("busy", seen, now))
+	value, err := db.Get("busy", seenItemsBucket)
+	assert.NoError(t, err)
+	kept := map[string]time.Time{}
+	assert.NoError(t, json.Unmarshal([]byte(value), &kept))
+	assert.Len(t, kept, maxSeenItems)
+	assert.NotContains(t, kept, "https://www.amazon.es/dp/expired")
+	assert.Contains(t, kept, "https://www.amazon.es/dp/recent")
+	assert.Contains(t, kept, "https://www.amazon.es/dp/0")
+	oldest := fmt.Sprintf("https://www.amazon.es/dp/%d", maxSeenItems-1)
+	assert.NotContains(t, kept, oldest)
+	assert.True(t, strings.HasPrefix(value, "{"))
+}
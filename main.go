@@ -6,12 +6,24 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/bamzi/jobrunner"
 	"github.com/igvaquero18/hermezon/boltdb"
+	"github.com/igvaquero18/hermezon/currency"
+	"github.com/igvaquero18/hermezon/discord"
+	"github.com/igvaquero18/hermezon/email"
+	"github.com/igvaquero18/hermezon/gotify"
+	"github.com/igvaquero18/hermezon/jwks"
+	"github.com/igvaquero18/hermezon/ntfy"
 	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/igvaquero18/hermezon/slack"
 	"github.com/igvaquero18/hermezon/telegram"
+	"github.com/igvaquero18/hermezon/templates"
 	"github.com/igvaquero18/hermezon/twilio"
+	"github.com/igvaquero18/hermezon/utils"
+	"github.com/igvaquero18/hermezon/webhook"
 	"github.com/labstack/echo-contrib/prometheus"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -29,10 +41,50 @@ const (
 	portEnv                 = "HERMEZON_LISTEN_PORT"
 	priceScheduleEnv        = "HERMEZON_PRICE_SCHEDULE_FREQUENCY"
 	availabilityScheduleEnv = "HERMEZON_AVAILABILITY_SCHEDULE_FREQUENCY"
+	listingScheduleEnv      = "HERMEZON_LISTING_SCHEDULE_FREQUENCY"
 	jwtSecretEnv            = "HERMEZON_JWT_SECRET"
 	databaseFilePathEnv     = "HERMEZON_DB_FILE_PATH"
 	twilioPhoneEnv          = "HERMEZON_TWILIO_PHONE"
+	ratesFilePathEnv        = "HERMEZON_RATES_FILE_PATH"
+	ratesURLEnv             = "HERMEZON_RATES_URL"
+	ratesTTLEnv             = "HERMEZON_RATES_TTL"
+	templatesDirEnv         = "HERMEZON_TEMPLATES_DIR"
+	defaultLocaleEnv        = "HERMEZON_DEFAULT_LOCALE"
+	smtpHostEnv             = "HERMEZON_SMTP_HOST"
+	smtpPortEnv             = "HERMEZON_SMTP_PORT"
+	smtpUsernameEnv         = "HERMEZON_SMTP_USERNAME"
+	smtpPasswordEnv         = "HERMEZON_SMTP_PASSWORD"
+	smtpSenderEnv           = "HERMEZON_SMTP_SENDER"
+	smtpTLSEnv              = "HERMEZON_SMTP_TLS"
+	defaultChannelEnv       = "HERMEZON_DEFAULT_CHANNEL"
+	ntfyServerEnv           = "HERMEZON_NTFY_SERVER"
+	ntfyTokenEnv            = "HERMEZON_NTFY_TOKEN"
+	gotifyURLEnv            = "HERMEZON_GOTIFY_URL"
+	whatsAppPhoneEnv        = "HERMEZON_TWILIO_WHATSAPP_PHONE"
+	whatsAppTemplateEnv     = "HERMEZON_WHATSAPP_TEMPLATE"
+	publicURLEnv            = "HERMEZON_PUBLIC_URL"
+	dispatchScheduleEnv     = "HERMEZON_DISPATCH_SCHEDULE_FREQUENCY"
+	outboxMaxAttemptsEnv    = "HERMEZON_OUTBOX_MAX_ATTEMPTS"
+	recipientRateLimitEnv   = "HERMEZON_RECIPIENT_RATE_LIMIT"
+	trackingRateLimitEnv    = "HERMEZON_TRACKING_RATE_LIMIT"
+	rateLimitWindowEnv      = "HERMEZON_RATE_LIMIT_WINDOW"
+	dedupWindowEnv          = "HERMEZON_DEDUP_WINDOW"
+	historyRetentionEnv     = "HERMEZON_HISTORY_RETENTION"
+	dailyDigestScheduleEnv  = "HERMEZON_DAILY_DIGEST_SCHEDULE"
+	weeklyDigestScheduleEnv = "HERMEZON_WEEKLY_DIGEST_SCHEDULE"
+	userMaxActionsEnv       = "HERMEZON_USER_MAX_ACTIONS"
+	userMaxGroupsEnv        = "HERMEZON_USER_MAX_GROUPS"
+	jwksURLEnv              = "HERMEZON_JWKS_URL"
+	jwksFilePathEnv         = "HERMEZON_JWKS_FILE_PATH"
+	jwksRefreshIntervalEnv  = "HERMEZON_JWKS_REFRESH_INTERVAL"
+	jwtAudienceEnv          = "HERMEZON_JWT_AUDIENCE"
+	jwtIssuerEnv            = "HERMEZON_JWT_ISSUER"
+	jwtUserClaimEnv         = "HERMEZON_JWT_USER_CLAIM"
 	apiVersion              = "/v1"
+
+	// insecureJWTSecret is the JWT secret that used to be taken by default,
+	// which can't be used anymore
+	insecureJWTSecret = "secret"
 )
 
 var (
@@ -41,13 +93,49 @@ var (
 	twilioPhone           = os.Getenv(twilioPhoneEnv)
 	telegramToken         = os.Getenv(telegramTokenEnv)
 	v                     = getOrElse(verboseEnv, "false")
-	jwtSecret             = getOrElse(jwtSecretEnv, "secret")
+	jwtSecret             = os.Getenv(jwtSecretEnv)
+	jwksURL               = os.Getenv(jwksURLEnv)
+	jwksFilePath          = os.Getenv(jwksFilePathEnv)
+	jwtAudience           = os.Getenv(jwtAudienceEnv)
+	jwtIssuer             = os.Getenv(jwtIssuerEnv)
+	jwtUserClaim          = getOrElse(jwtUserClaimEnv, "sub")
 	listenPort            = getOrElse(portEnv, "8080")
 	databaseFilePath      = getOrElse(databaseFilePathEnv, "hermezon.db")
 	priceFrequency        = getOrElse(priceScheduleEnv, "1h")
 	availabilityFrequency = getOrElse(availabilityScheduleEnv, "1m")
+	listingFrequency      = getOrElse(listingScheduleEnv, "15m")
+	ratesFilePath         = getOrElse(ratesFilePathEnv, "rates.json")
+	ratesURL              = os.Getenv(ratesURLEnv)
+	templatesDir          = os.Getenv(templatesDirEnv)
+	defaultLocale         = getOrElse(defaultLocaleEnv, templates.DefaultLocale)
+	smtpHost              = os.Getenv(smtpHostEnv)
+	smtpUsername          = os.Getenv(smtpUsernameEnv)
+	smtpPassword          = os.Getenv(smtpPasswordEnv)
+	smtpSender            = os.Getenv(smtpSenderEnv)
+	smtpTLS               = getOrElse(smtpTLSEnv, email.TLSStartTLS)
+	defaultChannel        = os.Getenv(defaultChannelEnv)
+	ntfyServer            = getOrElse(ntfyServerEnv, ntfy.DefaultServer)
+	ntfyToken             = os.Getenv(ntfyTokenEnv)
+	gotifyURL             = os.Getenv(gotifyURLEnv)
+	whatsAppPhone         = os.Getenv(whatsAppPhoneEnv)
+	whatsAppTemplate      = os.Getenv(whatsAppTemplateEnv)
+	publicURL             = os.Getenv(publicURLEnv)
+	dispatchFrequency     = getOrElse(dispatchScheduleEnv, "30s")
+	dailyDigestSchedule   = getOrElse(dailyDigestScheduleEnv, "0 8 * * *")
+	weeklyDigestSchedule  = getOrElse(weeklyDigestScheduleEnv, "0 8 * * 1")
+	outboxMaxAttempts     int
+	recipientRateLimit    int
+	trackingRateLimit     int
+	rateLimitWindow       time.Duration
+	dedupWindow           time.Duration
+	historyRetention      time.Duration
+	jwksRefreshInterval   time.Duration
+	userMaxActions        int
+	userMaxGroups         int
+	smtpPort              int
 	maxRetries            int8
 	retrySeconds          int8
+	ratesTTL              time.Duration
 	expectedStatusCode    int
 	sugar                 *zap.SugaredLogger
 	verbose               bool
@@ -55,7 +143,8 @@ var (
 	e                     *echo.Echo
 	p                     *prometheus.Prometheus
 	db                    KeyValueStorage
-	messagingClient       Messenger
+	messengers            map[string]Messenger
+	renderer              *templates.Renderer
 )
 
 func getOrElse(envVar, defaultValue string) string {
@@ -100,6 +189,19 @@ func init() {
 
 	sugar = zl.Sugar()
 	sugar.Debug("Logger initialization successful")
+}
+
+// configure reads the settings of the service from the environment, creating
+// its clients and routes
+func configure() {
+	var err error
+
+	if jwtSecret == insecureJWTSecret {
+		sugar.Fatalw("the jwt secret must be set to a secret value", "env", jwtSecretEnv)
+	}
+	if jwtSecret == "" && jwksURL == "" && jwksFilePath == "" {
+		sugar.Fatalw("either the jwt secret or a jwks is required", "env", jwtSecretEnv)
+	}
 
 	expectedStatusCode = http.StatusOK
 	if statusCode := os.Getenv(expectedStatusCodeEnv); statusCode != "" {
@@ -132,34 +234,236 @@ func init() {
 		}
 	}
 
-	if (twilioSID == "" || twilioToken == "" || twilioPhone == "") && telegramToken == "" {
-		sugar.Fatal("at least one of twilio or telegram configurations is required")
+	ratesTTL = currency.DefaultTTL
+	if ttl := os.Getenv(ratesTTLEnv); ttl != "" {
+		ratesTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			sugar.Errorw("error when setting rates ttl. Taking default value...", "msg", err.Error(), "ttl", ttl)
+			ratesTTL = currency.DefaultTTL
+		}
 	}
 
-	// Creating Messaging client
-	if twilioSID != "" && twilioToken != "" && twilioPhone != "" {
-		messagingClient = twilio.NewClient(twilioSID, twilioToken, twilio.SetLogger(sugar))
-	} else {
-		messagingClient, err = telegram.NewClient(telegramToken, sugar)
+	outboxMaxAttempts = defaultOutboxMaxAttempts
+	if attempts := os.Getenv(outboxMaxAttemptsEnv); attempts != "" {
+		outboxMaxAttempts, err = strconv.Atoi(attempts)
+		if err != nil || outboxMaxAttempts < 1 {
+			sugar.Errorw("error when setting outbox max attempts. Taking default value...", "attempts", attempts)
+			outboxMaxAttempts = defaultOutboxMaxAttempts
+		}
+	}
+
+	recipientRateLimit = defaultRecipientRateLimit
+	if limit := os.Getenv(recipientRateLimitEnv); limit != "" {
+		recipientRateLimit, err = strconv.Atoi(limit)
+		if err != nil {
+			sugar.Errorw("error when setting recipient rate limit. Taking default value...", "msg", err.Error(), "limit", limit)
+			recipientRateLimit = defaultRecipientRateLimit
+		}
+	}
+
+	trackingRateLimit = defaultTrackingRateLimit
+	if limit := os.Getenv(trackingRateLimitEnv); limit != "" {
+		trackingRateLimit, err = strconv.Atoi(limit)
+		if err != nil {
+			sugar.Errorw("error when setting tracking rate limit. Taking default value...", "msg", err.Error(), "limit", limit)
+			trackingRateLimit = defaultTrackingRateLimit
+		}
+	}
+
+	rateLimitWindow = defaultRateLimitWindow
+	if window := os.Getenv(rateLimitWindowEnv); window != "" {
+		rateLimitWindow, err = time.ParseDuration(window)
+		if err != nil {
+			sugar.Errorw("error when setting rate limit window. Taking default value...", "msg", err.Error(), "window", window)
+			rateLimitWindow = defaultRateLimitWindow
+		}
+	}
+
+	dedupWindow = defaultDedupWindow
+	if window := os.Getenv(dedupWindowEnv); window != "" {
+		dedupWindow, err = time.ParseDuration(window)
+		if err != nil {
+			sugar.Errorw("error when setting dedup window. Taking default value...", "msg", err.Error(), "window", window)
+			dedupWindow = defaultDedupWindow
+		}
+	}
+
+	historyRetention = defaultHistoryRetention
+	if retention := os.Getenv(historyRetentionEnv); retention != "" {
+		historyRetention, err = time.ParseDuration(retention)
+		if err != nil {
+			sugar.Errorw("error when setting history retention. Taking default value...", "msg", err.Error(), "retention", retention)
+			historyRetention = defaultHistoryRetention
+		}
+	}
+
+	jwksRefreshInterval = jwks.DefaultRefreshInterval
+	if interval := os.Getenv(jwksRefreshIntervalEnv); interval != "" {
+		jwksRefreshInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			sugar.Errorw("error when setting jwks refresh interval. Taking default value...", "msg", err.Error(), "interval", interval)
+			jwksRefreshInterval = jwks.DefaultRefreshInterval
+		}
+	}
+
+	// Loading the keys of the identity provider, if any. Tokens are still
+	// verified with the previous keys if they can't be loaded later on.
+	keySet = newKeySet()
+	if keySet != nil {
+		if err = keySet.Refresh(); err != nil {
+			sugar.Errorw("error when loading the jwks. Retrying on the first request...", "msg", err.Error())
+		}
+	}
+
+	userMaxActions = defaultUserMaxActions
+	if limit := os.Getenv(userMaxActionsEnv); limit != "" {
+		userMaxActions, err = strconv.Atoi(limit)
+		if err != nil {
+			sugar.Errorw("error when setting user max actions. Taking default value...", "msg", err.Error(), "limit", limit)
+			userMaxActions = defaultUserMaxActions
+		}
+	}
+
+	userMaxGroups = defaultUserMaxGroups
+	if limit := os.Getenv(userMaxGroupsEnv); limit != "" {
+		userMaxGroups, err = strconv.Atoi(limit)
+		if err != nil {
+			sugar.Errorw("error when setting user max groups. Taking default value...", "msg", err.Error(), "limit", limit)
+			userMaxGroups = defaultUserMaxGroups
+		}
+	}
+
+	smtpPort = email.DefaultPort
+	if port := os.Getenv(smtpPortEnv); port != "" {
+		smtpPort, err = strconv.Atoi(port)
+		if err != nil {
+			sugar.Errorw("error when setting smtp port. Taking default value...", "msg", err.Error(), "port", port)
+			smtpPort = email.DefaultPort
+		}
+	}
+
+	// Creating Messaging clients
+	messengers = map[string]Messenger{}
+	if twilioSID != "" && twilioToken != "" && (twilioPhone != "" || whatsAppPhone != "") {
+		twilioClient := twilio.NewClient(twilioSID, twilioToken,
+			twilio.SetPhone(twilioPhone),
+			twilio.SetStatusCallback(twilioStatusCallback()),
+			twilio.SetLogger(sugar),
+		)
+		if twilioPhone != "" {
+			messengers[smsChannel] = twilioClient
+		}
+		if whatsAppPhone != "" {
+			messengers[whatsAppChannel] = twilioClient.WhatsApp(whatsAppPhone, whatsAppSessions{},
+				twilio.SetTemplate(whatsAppTemplate),
+			)
+		}
+	}
+	if telegramToken != "" {
+		telegramClient, err := telegram.NewClient(telegramToken, sugar)
 		if err != nil {
 			sugar.Fatalw("error when creating the telegram client", "msg", err.Error())
 		}
+		messengers[telegramChannel] = telegramClient
+	}
+	if smtpHost != "" && smtpSender != "" {
+		if !email.IsValidTLSMode(smtpTLS) {
+			sugar.Fatalw("invalid smtp tls mode", "tls", smtpTLS)
+		}
+		messengers[emailChannel] = email.NewClient(smtpHost, smtpSender,
+			email.SetPort(smtpPort),
+			email.SetAuth(smtpUsername, smtpPassword),
+			email.SetTLSMode(smtpTLS),
+			email.SetLogger(sugar),
+		)
+	}
+	if gotifyURL != "" {
+		if !gotify.IsValidServer(gotifyURL) {
+			sugar.Fatalw("invalid gotify url", "url", gotifyURL)
+		}
+		messengers[gotifyChannel] = gotify.NewClient(gotifyURL, gotify.SetLogger(sugar))
+	}
+	if len(messengers) == 0 {
+		sugar.Fatal("at least one of twilio, whatsapp, telegram, smtp or gotify configurations is required")
+	}
+	// Webhooks, whose payloads are signed with the secret of every webhook,
+	// Slack and Discord webhooks and ntfy topics don't need any configuration.
+	// Failed webhook deliveries are retried by the outbox, which doesn't
+	// block the dispatch of the rest of the notifications meanwhile.
+	messengers[webhookChannel] = webhook.NewClient(webhookSecret,
+		webhook.SetHTTPClient(utils.NewPublicHTTPClient(10*time.Second)),
+		webhook.SetLogger(sugar),
+	)
+	messengers[slackChannel] = slack.NewClient(slack.SetLogger(sugar))
+	messengers[discordChannel] = discord.NewClient(discord.SetLogger(sugar))
+	messengers[ntfyChannel] = ntfy.NewClient(
+		ntfy.SetServer(ntfyServer),
+		ntfy.SetToken(ntfyToken),
+		ntfy.SetLogger(sugar),
+	)
+	if defaultChannel == "" {
+		for _, channel := range []string{smsChannel, whatsAppChannel, telegramChannel, emailChannel, gotifyChannel} {
+			if _, ok := messengers[channel]; ok {
+				defaultChannel = channel
+				break
+			}
+		}
+	}
+	if _, ok := messengers[defaultChannel]; !ok {
+		sugar.Fatalw("the default channel is not configured", "channel", defaultChannel)
 	}
 
-	// Setting routes in echo router and securing them with JWT
-	e = echo.New()
-	e.Use(middleware.Recover())
-	r := e.Group(fmt.Sprintf("%s/actions", apiVersion))
-	r.Use(middleware.JWT([]byte(jwtSecret)))
-	r.POST("", postActions)
+	// Creating the renderer of the notifications
+	renderer = templates.NewRenderer(
+		templates.SetDirectory(templatesDir),
+		templates.SetDefaultLocale(defaultLocale),
+		templates.SetLogger(sugar),
+	)
+
+	// Setting routes in echo router and securing them with API keys and JWT
+	e = newServer()
 
 	// Enabling Prometheus metrics
 	p = prometheus.NewPrometheus("echo", nil)
 	p.Use(e)
+}
 
+// newServer returns the echo router with the routes of the service, secured
+// with API keys and JWT
+func newServer() *echo.Echo {
+	e := echo.New()
+	e.Use(middleware.Recover())
+	if _, ok := messengers[whatsAppChannel]; ok {
+		e.POST("/twilio/whatsapp", postWhatsApp)
+	}
+	if twilioStatusCallback() != "" {
+		e.POST("/twilio/status", postTwilioStatus)
+	}
+	r := e.Group(apiVersion)
+	r.Use(apiKeyAuth)
+	r.Use(jwtAuth)
+	r.GET("/user", getUser)
+	r.PUT("/user", putUser)
+	r.GET("/api_keys", getAPIKeys)
+	r.POST("/api_keys", postAPIKeys)
+	r.DELETE("/api_keys/:id", deleteAPIKeys)
+	r.POST("/contacts", postContacts)
+	r.POST("/contacts/verify", postContactsVerify)
+	r.GET("/actions", getActions)
+	r.POST("/actions", postActions)
+	r.DELETE("/actions", deleteActions)
+	r.GET("/groups", getGroups)
+	r.POST("/groups", postGroups)
+	r.DELETE("/groups", deleteGroups)
+	r.GET("/notifications", getNotifications)
+	r.POST("/quiet_hours", postQuietHours)
+	r.DELETE("/quiet_hours", deleteQuietHours)
+	return e
 }
 
 func main() {
+	configure()
+
 	var err error
 
 	// Setting up the database
@@ -169,6 +473,17 @@ func main() {
 	}
 	defer db.Close()
 
+	// Migrating the records stored before they were scoped to their channel
+	// and owner
+	if err = migrateQuietHours(); err != nil {
+		sugar.Fatalw("error when migrating quiet hours", "msg", err.Error())
+	}
+	if err = assignOwners(); err != nil {
+		sugar.Fatalw("error when assigning owners to actions and groups", "msg", err.Error())
+	}
+
+	rateProvider = newRateProvider()
+
 	jobrunner.Start()
 	if err = jobrunner.Schedule(fmt.Sprintf("@every %s", availabilityFrequency), availability{}); err != nil {
 		sugar.Fatalw("error when scheduling availability jobs", "msg", err.Error())
@@ -176,5 +491,31 @@ func main() {
 	if err = jobrunner.Schedule(fmt.Sprintf("@every %s", priceFrequency), price{}); err != nil {
 		sugar.Fatalw("error when scheduling price down jobs", "msg", err.Error())
 	}
+	if err = jobrunner.Schedule(fmt.Sprintf("@every %s", priceFrequency), comparison{}); err != nil {
+		sugar.Fatalw("error when scheduling price comparison jobs", "msg", err.Error())
+	}
+	if err = jobrunner.Schedule(fmt.Sprintf("@every %s", listingFrequency), listing{}); err != nil {
+		sugar.Fatalw("error when scheduling listing jobs", "msg", err.Error())
+	}
+	if err = jobrunner.Schedule(fmt.Sprintf("@every %s", dispatchFrequency), dispatcher{}); err != nil {
+		sugar.Fatalw("error when scheduling outbox dispatcher jobs", "msg", err.Error())
+	}
+	if err = jobrunner.Schedule("@hourly", rateLimitPruner{}); err != nil {
+		sugar.Fatalw("error when scheduling rate limit pruning jobs", "msg", err.Error())
+	}
+	if err = jobrunner.Schedule("@hourly", historyPruner{}); err != nil {
+		sugar.Fatalw("error when scheduling notification history pruning jobs", "msg", err.Error())
+	}
+	if err = jobrunner.Schedule("@hourly", factsPruner{}); err != nil {
+		sugar.Fatalw("error when scheduling product facts pruning jobs", "msg", err.Error())
+	}
+	if err = jobrunner.Schedule(dailyDigestSchedule, digester{period: dailyDigest}); err != nil {
+		sugar.Fatalw("error when scheduling daily digest jobs", "msg", err.Error())
+	}
+	if err = jobrunner.Schedule(weeklyDigestSchedule, digester{period: weeklyDigest}); err != nil {
+		sugar.Fatalw("error when scheduling weekly digest jobs", "msg", err.Error())
+	}
+	// Notifications left in the outbox by a previous run are delivered right away
+	jobrunner.Now(dispatcher{})
 	sugar.Fatal(e.Start(fmt.Sprintf(":%s", listenPort)))
 }
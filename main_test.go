@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/igvaquero18/hermezon/boltdb"
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/templates"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	// testChannel is the channel of the fake messenger of the tests
+	testChannel = "test"
+	// testJWTSecret is the secret the JWT tokens of the tests are signed with
+	testJWTSecret = "test-secret"
+)
+
+// fakeMessenger records the notifications it sends, failing while its error
+// is set
+type fakeMessenger struct {
+	mutex sync.Mutex
+	sent  []*notification.Notification
+	err   error
+}
+
+func (m *fakeMessenger) Send(n *notification.Notification) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, n)
+	return nil
+}
+
+func (m *fakeMessenger) fail(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.err = err
+}
+
+func (m *fakeMessenger) messages() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	messages := make([]string, 0, len(m.sent))
+	for _, n := range m.sent {
+		messages = append(messages, n.Message)
+	}
+	return messages
+}
+
+// setUp points the service to a temporary database and the fake messenger,
+// with the default limits. The outbox is dispatched synchronously, so the
+// notifications are delivered when notify returns.
+func setUp(t *testing.T) *fakeMessenger {
+	dir, err := ioutil.TempDir("", "hermezon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sugar = zap.NewNop().Sugar()
+	if db, err = boltdb.NewClient(filepath.Join(dir, "hermezon.db"), sugar); err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeMessenger{}
+	messengers = map[string]Messenger{testChannel: fake}
+	defaultChannel = testChannel
+	renderer = templates.NewRenderer(templates.SetLogger(sugar))
+	expectedStatusCode = http.StatusOK
+	outboxMaxAttempts = defaultOutboxMaxAttempts
+	recipientRateLimit = defaultRecipientRateLimit
+	trackingRateLimit = defaultTrackingRateLimit
+	rateLimitWindow = defaultRateLimitWindow
+	dedupWindow = defaultDedupWindow
+	historyRetention = defaultHistoryRetention
+	userMaxActions = defaultUserMaxActions
+	userMaxGroups = defaultUserMaxGroups
+	jwtSecret, jwtUserClaim, jwtAudience, jwtIssuer, keySet = testJWTSecret, "sub", "", "", nil
+
+	dispatchOutbox = dispatcher{}.Run
+
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+	return fake
+}
+
+// token returns a JWT token of a user, signed with the JWT secret
+func token(id string) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": id,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// request makes a request to the API with an authorization, returning the
+// response
+func request(e *echo.Echo, method, path, auth string, body interface{}) *httptest.ResponseRecorder {
+	var payload string
+	if body != nil {
+		value, err := json.Marshal(body)
+		if err != nil {
+			panic(err)
+		}
+		payload = string(value)
+	}
+	req := httptest.NewRequest(method, path, strings.NewReader(payload))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if auth != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+auth)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// verify adds a verified destination to the contacts of a user
+func verify(t *testing.T, id, dest string) {
+	user := &User{ID: id, Contacts: []Contact{}, Limits: Limits{Actions: userMaxActions, Groups: userMaxGroups}}
+	if stored, err := loadUser(id); err != nil {
+		t.Fatal(err)
+	} else if stored != nil {
+		user = stored
+	}
+	if verified, err := verifyContact(user, testChannel, dest); err != nil || !verified {
+		t.Fatalf("destination %s not verified: %v", dest, err)
+	}
+}
+
+// errDown is the error of a messenger whose service is down
+var errDown = errors.New("service unavailable")
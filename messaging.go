@@ -1,6 +1,258 @@
 package main
 
-// Messenger is an interface for sending messages to a channel
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/igvaquero18/hermezon/email"
+	"github.com/igvaquero18/hermezon/gotify"
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/ntfy"
+	"github.com/igvaquero18/hermezon/templates"
+	"github.com/igvaquero18/hermezon/utils"
+)
+
+const (
+	smsChannel      = "sms"
+	telegramChannel = "telegram"
+	emailChannel    = "email"
+	webhookChannel  = "webhook"
+	slackChannel    = "slack"
+	discordChannel  = "discord"
+	ntfyChannel     = "ntfy"
+	gotifyChannel   = "gotify"
+	whatsAppChannel = "whatsapp"
+)
+
+// maxTags is the maximum number of tags of an action or group
+const maxTags = 5
+
+// tagRegexp matches the tags of actions and groups, like the emoji short
+// codes of ntfy
+var tagRegexp = regexp.MustCompile(`^[-_+A-Za-z0-9]{1,32}$`)
+
+// errSuppressed is returned when a notification is suppressed by the dedup
+// window or the rate limits, so the actions and groups it was sent for can
+// be kept until it's delivered
+var errSuppressed = errors.New("notification suppressed")
+
+// Messenger is an interface for sending notifications to a channel, which
+// renders them natively
 type Messenger interface {
-	SendMessage(title, body, from, dest string) error
+	Send(n *notification.Notification) error
+}
+
+// messengerFor returns the messenger of a channel, or the one of the default
+// channel if it's empty
+func messengerFor(channel string) (Messenger, error) {
+	if channel == "" {
+		channel = defaultChannel
+	}
+	m, ok := messengers[channel]
+	if !ok {
+		return nil, fmt.Errorf("channel %s is not configured", channel)
+	}
+	return m, nil
+}
+
+const (
+	// slackWebhookHost is the host of the Slack incoming webhooks
+	slackWebhookHost = "hooks.slack.com"
+	// discordWebhookHost is the host of the Discord webhooks
+	discordWebhookHost = "discord.com"
+	// discordWebhookPath is the prefix of the path of the Discord webhooks
+	discordWebhookPath = "/api/webhooks/"
+)
+
+// checkDestination returns an error if dest is not a valid destination for
+// the channel. Webhooks must be public URLs, and the ones of Slack and
+// Discord must be on their hosts. ntfy topics must be on the configured
+// server, Gotify tokens can't be anything else and emails must be bare
+// addresses.
+func checkDestination(channel, dest string) error {
+	if channel == "" {
+		channel = defaultChannel
+	}
+	switch channel {
+	case webhookChannel, slackChannel, discordChannel:
+		u, err := url.Parse(dest)
+		if err != nil {
+			return err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhooks must be http or https urls: %s", dest)
+		}
+		switch channel {
+		case slackChannel:
+			if u.Scheme != "https" || u.Host != slackWebhookHost {
+				return fmt.Errorf("slack webhooks must be https://%s urls: %s", slackWebhookHost, dest)
+			}
+		case discordChannel:
+			if u.Scheme != "https" || u.Host != discordWebhookHost || !strings.HasPrefix(u.Path, discordWebhookPath) {
+				return fmt.Errorf("discord webhooks must be https://%s%s urls: %s", discordWebhookHost, discordWebhookPath, dest)
+			}
+		default:
+			if err = utils.CheckPublicHost(u.Hostname()); err != nil {
+				return err
+			}
+		}
+	case ntfyChannel:
+		if _, err := ntfy.TopicURL(ntfyServer, dest); err != nil {
+			return err
+		}
+	case gotifyChannel:
+		if !gotify.IsValidToken(dest) {
+			return fmt.Errorf("invalid gotify application token: %s", dest)
+		}
+	case emailChannel:
+		if !email.IsValidAddress(dest) {
+			return fmt.Errorf("invalid email address: %q", dest)
+		}
+	}
+	return nil
+}
+
+// isValidPriority checks whether the priority of an action or group is valid
+// or not. A priority of 0 means the default one of the event.
+func isValidPriority(priority int) bool {
+	return priority == 0 || (priority >= notification.PriorityMin && priority <= notification.PriorityMax)
+}
+
+// isValidTags checks whether the tags of an action or group are valid or not.
+// Tags are sent in a comma separated header, so they can't have commas or
+// spaces.
+func isValidTags(tags []string) bool {
+	if len(tags) > maxTags {
+		return false
+	}
+	for _, tag := range tags {
+		if !tagRegexp.MatchString(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// eventPriority returns the priority of the notification of an event. Unless
+// set, products becoming available or below their price are high priority.
+func eventPriority(event string, priority int) int {
+	if priority != 0 {
+		return priority
+	}
+	switch event {
+	case templates.EventPrice, templates.EventAvailability:
+		return notification.PriorityHigh
+	}
+	return notification.PriorityDefault
+}
+
+// notify renders the notification of an event in the locale of the
+// customer and writes it to the outbox, to be delivered to its destination
+// through the given channel. Duplicated notifications and the ones over the
+// rate limits are suppressed, returning errSuppressed, and the ones which are
+// not urgent wait for the quiet hours of the customer to end. Notifications
+// of actions and groups in digest mode are added to their digest instead.
+func notify(event, channel, dest, locale string, data *templates.Data) error {
+	if channel == "" {
+		channel = defaultChannel
+	}
+	if _, err := messengerFor(channel); err != nil {
+		return err
+	}
+	title, body, err := renderer.Render(event, locale, data)
+	if err != nil {
+		return err
+	}
+	newPrice, currency := data.ComparedPrice, data.Currency
+	if data.Product != nil {
+		if newPrice == 0 {
+			newPrice = data.Product.Price
+		}
+		if currency == "" {
+			currency = data.Product.Currency
+		}
+	}
+	var image string
+	if data.Product != nil {
+		image = data.Product.Image
+	}
+	n := &notification.Notification{
+		Event:     event,
+		Recipient: dest,
+		Title:     title,
+		Message:   body,
+		Tracking:  data.Tracking,
+		Product:   data.Product,
+		URL:       data.URL,
+		Image:     image,
+		OldPrice:  data.OldPrice,
+		NewPrice:  newPrice,
+		Currency:  currency,
+		Priority:  eventPriority(event, data.Priority),
+		Tags:      data.Tags,
+		Items:     data.Items,
+		Links:     links(data),
+		Timestamp: time.Now().UTC(),
+	}
+	if d := digestOf(data.Tracking); d != nil {
+		return addToDigest(d, n)
+	}
+	reason, err := allowNotification(channel, n)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		sugar.Infow("notification suppressed",
+			"reason", reason,
+			"event", event,
+			"channel", channel,
+			"dest", dest,
+			"tracking", trackingKey(data.Tracking),
+		)
+		return fmt.Errorf("%w: %s", errSuppressed, reason)
+	}
+	at, err := deliveryTime(channel, dest, data.Tracking)
+	if err != nil {
+		return err
+	}
+	if at.After(n.Timestamp) {
+		sugar.Infow("notification delayed until the end of the quiet hours",
+			"event", event,
+			"channel", channel,
+			"dest", dest,
+			"until", at,
+		)
+	}
+	return enqueue(channel, n, at)
+}
+
+// links returns the links of the notification of an event: the product, or
+// the listing and its new items
+func links(data *templates.Data) []notification.Link {
+	links := []notification.Link{}
+	if data.URL != "" {
+		label := "Open"
+		if data.Product != nil && data.Product.Title != "" {
+			label = data.Product.Title
+		}
+		links = append(links, notification.Link{Label: label, URL: data.URL})
+	}
+	for _, item := range data.Items {
+		links = append(links, notification.Link{Label: item.Title, URL: item.URL})
+	}
+	return links
+}
+
+// deliver sends a notification to its recipient through the messenger of the
+// channel
+func deliver(channel string, n *notification.Notification) error {
+	m, err := messengerFor(channel)
+	if err != nil {
+		return err
+	}
+	return m.Send(n)
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDestination(t *testing.T) {
+	testCases := []struct {
+		name    string
+		channel string
+		dest    string
+		valid   bool
+	}{
+		{name: "email", channel: emailChannel, dest: "alice@example.com", valid: true},
+		{name: "email with display name", channel: emailChannel, dest: "Alice <alice@example.com>"},
+		{name: "several emails", channel: emailChannel, dest: "alice@example.com, bob@example.com"},
+		{name: "email with injected header", channel: emailChannel, dest: "alice@example.com\r\nBcc: bob@example.com"},
+		{name: "not an email", channel: emailChannel, dest: "+34698765432"},
+		{name: "slack webhook", channel: slackChannel, dest: "https://hooks.slack.com/services/T000/B000/XXXX", valid: true},
+		{name: "slack webhook on another host", channel: slackChannel, dest: "https://example.com/services/T000/B000/XXXX"},
+		{name: "gotify token", channel: gotifyChannel, dest: "AbC.dEf-123_x", valid: true},
+		{name: "gotify url", channel: gotifyChannel, dest: "https://gotify.example.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			err := checkDestination(tc.channel, tc.dest)
+			if tc.valid {
+				assert.NoError(tt, err)
+			} else {
+				assert.Error(tt, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package notification
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/igvaquero18/hermezon/scraper"
+)
+
+const (
+	// PriorityMin is the lowest priority of a notification
+	PriorityMin = 1
+	// PriorityLow is the priority of notifications which can wait
+	PriorityLow = 2
+	// PriorityDefault is the priority of notifications by default
+	PriorityDefault = 3
+	// PriorityHigh is the priority of important notifications
+	PriorityHigh = 4
+	// PriorityMax is the highest priority of a notification
+	PriorityMax = 5
+)
+
+// Notification is a notification of an event to a recipient, with the
+// rendered title and message and the data every messenger needs to render
+// it natively. The old and new prices are the ones compared by the tracking,
+// in its currency, and the tags are the ones of the tracking, if any.
+type Notification struct {
+	ID        string           `json:"id,omitempty"`
+	Event     string           `json:"event"`
+	Recipient string           `json:"recipient"`
+	Title     string           `json:"title"`
+	Message   string           `json:"message"`
+	Tracking  interface{}      `json:"tracking,omitempty"`
+	Product   *scraper.Product `json:"product,omitempty"`
+	URL       string           `json:"url,omitempty"`
+	Image     string           `json:"image,omitempty"`
+	OldPrice  float64          `json:"old_price,omitempty"`
+	NewPrice  float64          `json:"new_price,omitempty"`
+	Currency  string           `json:"currency,omitempty"`
+	Priority  int              `json:"priority,omitempty"`
+	Tags      []string         `json:"tags,omitempty"`
+	Items     []scraper.Item   `json:"items,omitempty"`
+	Links     []Link           `json:"links,omitempty"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// Link is a link the recipient can follow from a notification, like the
+// product or the items of a listing
+type Link struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// Price returns the new price of the notification with its currency, or an
+// empty string if there isn't any
+func (n *Notification) Price() string {
+	if n.NewPrice == 0 {
+		return ""
+	}
+	return FormatPrice(n.NewPrice, n.Currency)
+}
+
+// FormatPrice formats an amount with two decimals and its currency, if any
+func FormatPrice(amount float64, currency string) string {
+	return strings.TrimSpace(fmt.Sprintf("%.2f %s", amount, currency))
+}
@@ -0,0 +1,24 @@
+package notification
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrice(t *testing.T) {
+	testCases := []struct {
+		name, expected string
+		n              *Notification
+	}{
+		{name: "with currency", n: &Notification{NewPrice: 449.99, Currency: "EUR"}, expected: "449.99 EUR"},
+		{name: "without currency", n: &Notification{NewPrice: 20}, expected: "20.00"},
+		{name: "without price", n: &Notification{Currency: "EUR"}, expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, tc.n.Price())
+		})
+	}
+}
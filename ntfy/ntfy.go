@@ -0,0 +1,195 @@
+package ntfy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/utils"
+)
+
+const (
+	// DefaultServer is the default ntfy server topics are published to
+	DefaultServer = "https://ntfy.sh"
+
+	// maxActions is the maximum number of action buttons of a message
+	maxActions = 3
+)
+
+// topicRegexp matches the names of the topics
+var topicRegexp = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+
+// tags are the tags of every kind of event, shown as emojis by ntfy when
+// the notification doesn't have its own
+var tags = map[string][]string{
+	"price":        {"moneybag"},
+	"availability": {"package"},
+	"listing":      {"new"},
+	"comparison":   {"scales"},
+	"digest":       {"newspaper"},
+}
+
+// Client is a struct that implicitly implements the Messenger interface
+// for publishing messages to ntfy topics
+type Client struct {
+	server string
+	token  string
+	client *http.Client
+	utils.Logger
+}
+
+// Option is a function to apply settings to Client structure
+type Option func(c *Client) Option
+
+// NewClient returns a new Client
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		server: DefaultServer,
+		client: &http.Client{Timeout: 10 * time.Second},
+		Logger: &utils.DefaultLogger{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetServer Sets the server of the topics which are not full URLs
+func SetServer(server string) Option {
+	return func(c *Client) Option {
+		prev := c.server
+		c.server = server
+		return SetServer(prev)
+	}
+}
+
+// SetToken Sets the access token for publishing to protected topics
+func SetToken(token string) Option {
+	return func(c *Client) Option {
+		prev := c.token
+		c.token = token
+		return SetToken(prev)
+	}
+}
+
+// SetHTTPClient Sets the HTTP client for Client
+func SetHTTPClient(client *http.Client) Option {
+	return func(c *Client) Option {
+		prev := c.client
+		c.client = client
+		return SetHTTPClient(prev)
+	}
+}
+
+// SetLogger Sets the Logger for Client
+func SetLogger(logger utils.Logger) Option {
+	return func(c *Client) Option {
+		prev := c.Logger
+		c.Logger = logger
+		return SetLogger(prev)
+	}
+}
+
+// Send publishes a notification to the topic of its recipient, which is
+// either the name of a topic of the server or its full URL. Clicking the
+// notification opens the product, its image is attached and its links are
+// action buttons.
+func (c *Client) Send(n *notification.Notification) error {
+	topicURL, err := TopicURL(c.server, n.Recipient)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, topicURL, strings.NewReader(n.Message))
+	if err != nil {
+		return err
+	}
+	// Non ASCII titles are sent as RFC 2047 encoded-words
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", n.Title))
+	req.Header.Set("Priority", strconv.Itoa(priority(n)))
+	t := n.Tags
+	if len(t) == 0 {
+		t = tags[n.Event]
+	}
+	if len(t) > 0 {
+		req.Header.Set("Tags", strings.Join(t, ","))
+	}
+	if n.URL != "" {
+		req.Header.Set("Click", n.URL)
+	}
+	if n.Image != "" {
+		req.Header.Set("Attach", n.Image)
+	}
+	if actions := actions(n.Links); actions != "" {
+		req.Header.Set("Actions", actions)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+	}
+
+	c.Debugw("publishing message to ntfy", "event", n.Event)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("ntfy response status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// TopicURL returns the URL of a topic of the server, given either its name
+// or its full URL. URLs of other servers are refused, so the access token is
+// never sent to them.
+func TopicURL(server, topic string) (string, error) {
+	server = strings.TrimSuffix(server, "/")
+	if strings.HasPrefix(topic, "http://") || strings.HasPrefix(topic, "https://") {
+		s, err := url.Parse(server)
+		if err != nil {
+			return "", err
+		}
+		u, err := url.Parse(topic)
+		if err != nil {
+			return "", err
+		}
+		if u.Scheme != s.Scheme || u.Host != s.Host || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+			return "", fmt.Errorf("topics must be on %s: %s", server, topic)
+		}
+		topic = strings.TrimPrefix(u.Path, s.Path+"/")
+	}
+	if !topicRegexp.MatchString(topic) {
+		return "", fmt.Errorf("invalid topic: %s", topic)
+	}
+	return fmt.Sprintf("%s/%s", server, topic), nil
+}
+
+// priority returns the priority of a notification, which is the same in
+// ntfy
+func priority(n *notification.Notification) int {
+	if n.Priority < notification.PriorityMin || n.Priority > notification.PriorityMax {
+		return notification.PriorityDefault
+	}
+	return n.Priority
+}
+
+// actions returns the view actions of the links, in the simple format of the
+// Actions header. Labels are quoted, as they may contain commas.
+func actions(links []notification.Link) string {
+	views := []string{}
+	for _, link := range links {
+		if len(views) == maxActions {
+			break
+		}
+		label := strings.NewReplacer(`"`, "", ";", "").Replace(link.Label)
+		views = append(views, fmt.Sprintf(`view, "%s", %s`, label, link.URL))
+	}
+	return strings.Join(views, "; ")
+}
@@ -0,0 +1,153 @@
+package ntfy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSend(t *testing.T) {
+	testCases := []struct {
+		name, dest, token, path string
+		n                       *notification.Notification
+		status                  int
+		headers                 map[string]string
+		err                     bool
+	}{
+		{
+			name:  "availability to a topic of the server",
+			dest:  "hermezon",
+			token: "tk_secret",
+			path:  "/hermezon",
+			n: &notification.Notification{
+				Event:    "availability",
+				Title:    "¡Disponible!",
+				Message:  "PlayStation 5",
+				URL:      "https://www.amazon.es/dp/B08KKJ37F7",
+				Image:    "https://m.media-amazon.com/images/I/ps5.jpg",
+				Links:    []notification.Link{{Label: "PlayStation 5, 825GB", URL: "https://www.amazon.es/dp/B08KKJ37F7"}},
+				Priority: notification.PriorityHigh,
+			},
+			status: http.StatusOK,
+			headers: map[string]string{
+				"Title":         "=?utf-8?q?=C2=A1Disponible!?=",
+				"Priority":      "4",
+				"Tags":          "package",
+				"Click":         "https://www.amazon.es/dp/B08KKJ37F7",
+				"Attach":        "https://m.media-amazon.com/images/I/ps5.jpg",
+				"Authorization": "Bearer tk_secret",
+			},
+		},
+		{
+			name: "price with its own tags",
+			dest: "hermezon",
+			path: "/hermezon",
+			n: &notification.Notification{
+				Event:   "price",
+				Title:   "Price drop",
+				Message: "PlayStation 5",
+				Tags:    []string{"video_game", "+1"},
+			},
+			status: http.StatusOK,
+			headers: map[string]string{
+				"Tags": "video_game,+1",
+			},
+		},
+		{
+			name:   "message to a full topic url",
+			path:   "/other",
+			n:      &notification.Notification{Title: "Title", Message: "Body"},
+			status: http.StatusOK,
+			headers: map[string]string{
+				"Title":         "Title",
+				"Priority":      "3",
+				"Tags":          "",
+				"Click":         "",
+				"Attach":        "",
+				"Actions":       "",
+				"Authorization": "",
+			},
+		},
+		{
+			name:  "full topic url of another server",
+			dest:  "https://evil.example.com/hermezon",
+			token: "tk_secret",
+			n:     &notification.Notification{Title: "Title", Message: "Body"},
+			err:   true,
+		},
+		{
+			name:   "forbidden topic",
+			dest:   "hermezon",
+			n:      &notification.Notification{Title: "Title", Message: "Body"},
+			status: http.StatusForbidden,
+			err:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			var body string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.status == 0 {
+					tt.Error("unexpected request to the server")
+				}
+				if tc.path != "" {
+					assert.Equal(tt, tc.path, r.URL.Path)
+				}
+				for header, value := range tc.headers {
+					assert.Equal(tt, value, r.Header.Get(header), header)
+				}
+				content, _ := ioutil.ReadAll(r.Body)
+				body = string(content)
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+
+			dest := tc.dest
+			if dest == "" {
+				dest = ts.URL + tc.path
+			}
+			tc.n.Recipient = dest
+			err := NewClient(SetServer(ts.URL+"/"), SetToken(tc.token)).Send(tc.n)
+			if tc.err {
+				assert.Error(tt, err)
+				return
+			}
+			assert.NoError(tt, err)
+			assert.Equal(tt, tc.n.Message, body)
+		})
+	}
+}
+
+func TestTopicURL(t *testing.T) {
+	testCases := []struct {
+		name, server, topic, expected string
+		err                           bool
+	}{
+		{name: "topic name", server: "https://ntfy.sh", topic: "hermezon", expected: "https://ntfy.sh/hermezon"},
+		{name: "full url of the server", server: "https://ntfy.sh/", topic: "https://ntfy.sh/hermezon", expected: "https://ntfy.sh/hermezon"},
+		{name: "server with path", server: "https://example.com/ntfy", topic: "https://example.com/ntfy/hermezon", expected: "https://example.com/ntfy/hermezon"},
+		{name: "full url of another server", server: "https://ntfy.sh", topic: "https://evil.example.com/hermezon", err: true},
+		{name: "another scheme", server: "https://ntfy.sh", topic: "http://ntfy.sh/hermezon", err: true},
+		{name: "user info", server: "https://ntfy.sh", topic: "https://ntfy.sh@evil.example.com/hermezon", err: true},
+		{name: "another path", server: "https://example.com/ntfy", topic: "https://example.com/admin/hermezon", err: true},
+		{name: "path traversal", server: "https://ntfy.sh", topic: "../v1/account", err: true},
+		{name: "empty topic", server: "https://ntfy.sh", topic: "", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			topicURL, err := TopicURL(tc.server, tc.topic)
+			if tc.err {
+				assert.Error(tt, err)
+				return
+			}
+			assert.NoError(tt, err)
+			assert.Equal(tt, tc.expected, topicURL)
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+)
+
+const (
+	// outboxBucket is the bucket where the notifications pending delivery
+	// are stored, under their ID
+	outboxBucket = "outbox"
+	// deadLettersBucket is the bucket where the notifications that couldn't
+	// be delivered after every attempt are moved to
+	deadLettersBucket = "dead_letters"
+
+	// outboxBackoff is the time waited before retrying the delivery of a
+	// notification for the first time. It doubles on every attempt.
+	outboxBackoff = 30 * time.Second
+	// outboxMaxBackoff is the maximum time waited between attempts
+	outboxMaxBackoff = time.Hour
+	// defaultOutboxMaxAttempts is the default number of attempts to deliver a
+	// notification before moving it to the dead letters
+	defaultOutboxMaxAttempts = 10
+)
+
+var (
+	// dispatchMutex prevents the outbox from being dispatched concurrently,
+	// which would deliver the same notification twice
+	dispatchMutex sync.Mutex
+	// dispatchOutbox dispatches the outbox once a notification is added to
+	// it, in the background so its sender doesn't wait for the delivery
+	dispatchOutbox = func() { go dispatcher{}.Run() }
+)
+
+// outboxEntry is a rendered notification waiting in the outbox to be
+// delivered to its destination
+type outboxEntry struct {
+	ID      string `json:"id"`
+	Channel string `json:"channel"`
+	Dest    string `json:"dest"`
+	// Notification is stored as "event", as in the entries written before
+	// notifications had their own type
+	Notification *notification.Notification `json:"event"`
+	Attempts     int                        `json:"attempts"`
+	NextAttempt  time.Time                  `json:"next_attempt"`
+	LastError    string                     `json:"last_error,omitempty"`
+	CreatedAt    time.Time                  `json:"created_at"`
+}
+
+// newEntryID returns a new ID for an outbox entry. IDs sort in the order in
+// which entries are created.
+func newEntryID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%020d-%s", time.Now().UnixNano(), hex.EncodeToString(suffix))
+}
+
+// saveEntry stores an outbox entry in a bucket
+func saveEntry(entry *outboxEntry, bucket string) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return db.Save(entry.ID, string(value), bucket)
+}
+
+// enqueue writes a notification to the outbox, to be delivered at the given
+// time, and starts dispatching it. Once it's in the outbox, it will be
+// delivered even if the service restarts.
+func enqueue(channel string, n *notification.Notification, at time.Time) error {
+	now := time.Now().UTC()
+	n.ID = newEntryID()
+	entry := &outboxEntry{
+		ID:           n.ID,
+		Channel:      channel,
+		Dest:         n.Recipient,
+		Notification: n,
+		NextAttempt:  at,
+		CreatedAt:    now,
+	}
+	if err := saveEntry(entry, outboxBucket); err != nil {
+		return err
+	}
+	if err := recordNotification(entry); err != nil {
+		sugar.Errorw("error when adding notification to history", "id", entry.ID, "msg", err.Error())
+	}
+	sugar.Debugw("notification added to outbox", "id", entry.ID, "channel", channel, "dest", n.Recipient, "event", n.Event, "next_attempt", at)
+	dispatchOutbox()
+	return nil
+}
+
+type dispatcher struct{}
+
+// Run delivers the notifications of the outbox whose next attempt is due,
+// in the order in which they were enqueued
+func (d dispatcher) Run() {
+	dispatchMutex.Lock()
+	defer dispatchMutex.Unlock()
+
+	results, err := db.GetAll(outboxBucket)
+	if err != nil {
+		sugar.Errorw("error when reading the outbox", "msg", err.Error())
+		return
+	}
+	ids := make([]string, 0, len(results))
+	for id := range results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	now := time.Now()
+	for _, id := range ids {
+		entry := &outboxEntry{}
+		if err = json.Unmarshal([]byte(results[id]), entry); err != nil {
+			sugar.Errorw("invalid outbox entry", "id", id, "msg", err.Error())
+			continue
+		}
+		if entry.NextAttempt.After(now) {
+			continue
+		}
+		if err = dispatch(entry); err != nil {
+			sugar.Errorw("error when dispatching notification", "id", id, "msg", err.Error())
+		}
+	}
+}
+
+// dispatch tries to deliver an outbox entry, removing it from the outbox
+// when it succeeds. Otherwise, the entry is scheduled for a new attempt, or
+// moved to the dead letters when there are no attempts left.
+func dispatch(entry *outboxEntry) error {
+	entry.Attempts++
+	if entry.Notification.Recipient == "" {
+		entry.Notification.Recipient = entry.Dest
+	}
+	err := deliver(entry.Channel, entry.Notification)
+	recordAttempt(entry, err)
+	if err == nil {
+		sugar.Debugw("notification delivered", "id", entry.ID, "channel", entry.Channel, "attempts", entry.Attempts)
+		return db.Delete(entry.ID, outboxBucket)
+	}
+
+	entry.LastError = err.Error()
+	if entry.Attempts >= outboxMaxAttempts {
+		sugar.Errorw("notification couldn't be delivered. Moving it to dead letters...",
+			"id", entry.ID,
+			"channel", entry.Channel,
+			"dest", entry.Dest,
+			"attempts", entry.Attempts,
+			"msg", err.Error(),
+		)
+		if err = saveEntry(entry, deadLettersBucket); err != nil {
+			return err
+		}
+		return db.Delete(entry.ID, outboxBucket)
+	}
+
+	backoff := outboxBackoff << uint(entry.Attempts-1)
+	if backoff > outboxMaxBackoff || backoff <= 0 {
+		backoff = outboxMaxBackoff
+	}
+	entry.NextAttempt = time.Now().UTC().Add(backoff)
+	sugar.Infow("error when delivering notification. Retrying later...",
+		"id", entry.ID,
+		"channel", entry.Channel,
+		"attempts", entry.Attempts,
+		"next_attempt", entry.NextAttempt,
+		"msg", err.Error(),
+	)
+	return saveEntry(entry, outboxBucket)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/igvaquero18/hermezon/boltdb"
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadEntry returns an outbox entry stored in a bucket, or nil if it isn't
+// there
+func loadEntry(t *testing.T, id, bucket string) *outboxEntry {
+	value, err := db.Get(id, bucket)
+	assert.NoError(t, err)
+	if value == "" {
+		return nil
+	}
+	entry := &outboxEntry{}
+	assert.NoError(t, json.Unmarshal([]byte(value), entry))
+	return entry
+}
+
+// newEntry stores a new outbox entry whose delivery is due at the given time
+func newEntry(t *testing.T, message string, at time.Time) *outboxEntry {
+	entry := &outboxEntry{
+		ID:           newEntryID(),
+		Channel:      testChannel,
+		Dest:         "alice",
+		Notification: &notification.Notification{Event: "test", Recipient: "alice", Message: message},
+		NextAttempt:  at,
+		CreatedAt:    time.Now().UTC(),
+	}
+	assert.NoError(t, saveEntry(entry, outboxBucket))
+	return entry
+}
+
+func TestDispatcherOrder(t *testing.T) {
+	fake := setUp(t)
+	now := time.Now().UTC()
+	newEntry(t, "first", now.Add(-time.Minute))
+	newEntry(t, "second", now)
+	later := newEntry(t, "later", now.Add(time.Hour))
+	newEntry(t, "third", now.Add(-time.Hour))
+
+	dispatcher{}.Run()
+	assert.Equal(t, []string{"first", "second", "third"}, fake.messages())
+	assert.NotNil(t, loadEntry(t, later.ID, outboxBucket))
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	fake := setUp(t)
+	fake.fail(errDown)
+	entry := newEntry(t, "retried", time.Now().UTC())
+
+	before := time.Now().UTC()
+	dispatcher{}.Run()
+	stored := loadEntry(t, entry.ID, outboxBucket)
+	assert.Equal(t, 1, stored.Attempts)
+	assert.Equal(t, errDown.Error(), stored.LastError)
+	assert.False(t, stored.NextAttempt.Before(before.Add(outboxBackoff)))
+	assert.False(t, stored.NextAttempt.After(time.Now().UTC().Add(outboxBackoff)))
+
+	// Entries aren't attempted again before their backoff ends
+	dispatcher{}.Run()
+	assert.Equal(t, 1, loadEntry(t, entry.ID, outboxBucket).Attempts)
+
+	stored.NextAttempt = time.Now().UTC()
+	assert.NoError(t, saveEntry(stored, outboxBucket))
+	before = time.Now().UTC()
+	dispatcher{}.Run()
+	stored = loadEntry(t, entry.ID, outboxBucket)
+	assert.Equal(t, 2, stored.Attempts)
+	assert.False(t, stored.NextAttempt.Before(before.Add(2*outboxBackoff)))
+
+	fake.fail(nil)
+	stored.NextAttempt = time.Now().UTC()
+	assert.NoError(t, saveEntry(stored, outboxBucket))
+	dispatcher{}.Run()
+	assert.Nil(t, loadEntry(t, entry.ID, outboxBucket))
+	assert.Equal(t, []string{"retried"}, fake.messages())
+}
+
+func TestDispatcherDeadLetters(t *testing.T) {
+	fake := setUp(t)
+	fake.fail(errDown)
+	outboxMaxAttempts = 2
+	n := &notification.Notification{Event: "test", Recipient: "alice", Message: "lost"}
+	assert.NoError(t, enqueue(testChannel, n, time.Now().UTC()))
+
+	entry := loadEntry(t, n.ID, outboxBucket)
+	assert.Equal(t, 1, entry.Attempts)
+	entry.NextAttempt = time.Now().UTC()
+	assert.NoError(t, saveEntry(entry, outboxBucket))
+	dispatcher{}.Run()
+
+	assert.Nil(t, loadEntry(t, n.ID, outboxBucket))
+	dead := loadEntry(t, n.ID, deadLettersBucket)
+	if assert.NotNil(t, dead) {
+		assert.Equal(t, 2, dead.Attempts)
+		assert.Equal(t, errDown.Error(), dead.LastError)
+	}
+	value, err := db.Get(n.ID, notificationsBucket)
+	assert.NoError(t, err)
+	history := &HistoryEntry{}
+	assert.NoError(t, json.Unmarshal([]byte(value), history))
+	assert.Equal(t, statusFailed, history.Status)
+	assert.Equal(t, 2, history.Attempts)
+}
+
+func TestDispatcherRestart(t *testing.T) {
+	fake := setUp(t)
+	entry := newEntry(t, "pending", time.Now().UTC().Add(-time.Minute))
+
+	// The entries in the outbox are delivered after the service restarts
+	path := db.(*boltdb.Client).Path()
+	assert.NoError(t, db.Close())
+	var err error
+	db, err = boltdb.NewClient(path, sugar)
+	assert.NoError(t, err)
+
+	dispatcher{}.Run()
+	assert.Equal(t, []string{"pending"}, fake.messages())
+	assert.Nil(t, loadEntry(t, entry.ID, outboxBucket))
+}
@@ -1,12 +1,10 @@
 package main
 
 import (
-	"fmt"
-	"regexp"
-	"strconv"
-	"strings"
+	"errors"
 
 	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/igvaquero18/hermezon/templates"
 )
 
 type price struct{}
@@ -15,23 +13,23 @@ type price struct{}
 // price in the corresponding store, looking for price drops.
 func (p price) Run() {
 	sugar.Debug("checking all products for price drop")
-	results, err := db.GetAll(priceAction)
+	actions, err := loadActions(priceAction)
 	if err != nil {
 		sugar.Fatalw("error when reading the database", "msg", err.Error())
 	}
-	for k, v := range results {
+	for k, action := range actions {
 		databaseKey := k
-		keys := strings.Split(databaseKey, "|")
-		values := strings.Split(v, "|")
-		if len(keys) < 2 || len(values) < 2 {
-			sugar.Fatalw("invalid keys and/or values returned from database.", "keys", keys, "values", values)
+		action := action
+		channel := action.From
+		url := action.URL
+		selector := action.Selector
+		// Price actions stored before they had their own default selector
+		// have the one of availability actions
+		if selector == scraper.DefaultSelector {
+			selector = scraper.DefaultPriceSelector
 		}
-		reg := regexp.MustCompile(`\d+[\.\,]?\d*`)
-		channel := keys[0]
-		url := keys[1]
-		selector := values[0]
-		targetPriceStr := values[1]
-		targetPrice, err := strconv.ParseFloat(strings.ReplaceAll(reg.FindString(targetPriceStr), ",", "."), 64)
+		targetPriceStr := action.Price
+		targetPrice, err := parseAmount(targetPriceStr)
 		if err != nil {
 			sugar.Fatalw("invalid target price retrieved from database: %s", err.Error())
 		}
@@ -41,6 +39,8 @@ func (p price) Run() {
 			"url", url,
 			"selector", selector,
 			"target_price", targetPriceStr,
+			"json_path", action.JSONPath,
+			"variant", action.Variant,
 		)
 
 		// Build the scraper
@@ -49,36 +49,99 @@ func (p price) Run() {
 			scraper.SetLogger(sugar),
 			scraper.SetMaxRetries(maxRetries),
 			scraper.SetRetrySeconds(retrySeconds),
-			scraper.SetSelector(selector),
-			scraper.SetTargetPrice(targetPrice),
+			scraper.SetPriceSelector(selector),
+			scraper.SetJSONPath(action.JSONPath),
+			scraper.SetVariant(action.Variant),
+			scraper.SetVariantParam(action.VariantParam),
 			scraper.SetURL(url),
 		)
 
 		go func() {
-			priceBelow, err := scr.IsPriceBelow()
+			product, err := scr.Product()
 			if err != nil {
 				sugar.Errorw("error when checking price", "channel", channel, "url", url, "msg", err.Error())
-			}
-			if priceBelow {
-				sugar.Debugw("Price is below!", "channel", channel, "url", url, "desired_price", targetPriceStr)
-				err = messagingClient.SendMessage(
-					"Product is below desired price!",
-					fmt.Sprintf("URL: %s\nDesired price: %s", url, targetPriceStr),
-					twilioPhone,
-					channel,
-				)
-				if err != nil {
-					sugar.Errorw("error when sending message", "msg", err.Error())
-					return
-				}
-				err = db.Delete(databaseKey, priceAction)
-				if err != nil {
-					sugar.Fatalw("error when reading the database", "msg", err.Error())
-				}
-				sugar.Debugw("deleted key from bucket", "key", databaseKey, "bucket", priceAction)
 				return
 			}
-			sugar.Debugw("Price is not below...", "channel", channel, "url", url, "desired_price", targetPriceStr)
+			productURL, _ := scr.ProductURL()
+			checkPrice(databaseKey, action, targetPrice, productURL, product)
 		}()
 	}
 }
+
+// checkPrice saves the facts of the product of a price action and notifies
+// its price once it's below the target one. Notified actions are deleted,
+// unless they are in digest mode.
+func checkPrice(databaseKey string, action *Action, targetPrice float64, productURL string, product *scraper.Product) {
+	channel, url, targetPriceStr := action.From, action.URL, action.Price
+	previous, err := loadFacts(factsKey(priceAction, databaseKey))
+	if err != nil {
+		sugar.Errorw("error when reading product facts", "key", databaseKey, "msg", err.Error())
+	}
+	if err = saveFacts(factsKey(priceAction, databaseKey), product); err != nil {
+		sugar.Errorw("error when saving product facts", "key", databaseKey, "msg", err.Error())
+	}
+	trackChanges(action, productURL, previous, product)
+	if product.Price == 0 {
+		sugar.Errorw("error when checking price", "channel", channel, "url", url, "msg", "no price matched")
+		return
+	}
+	currentPrice, err := action.comparablePrice(product)
+	if err != nil {
+		sugar.Errorw("error when checking price", "channel", channel, "url", url, "msg", err.Error())
+		return
+	}
+	if targetPrice <= currentPrice {
+		sugar.Debugw("Price is not below...",
+			"channel", channel,
+			"url", url,
+			"desired_price", targetPriceStr,
+			"price", currentPrice,
+			"price_mode", action.PriceMode,
+			"currency", action.Currency,
+		)
+		return
+	}
+	if !action.meetsOfferConditions(product) {
+		sugar.Debugw("Price is below, but the offer doesn't meet the conditions...",
+			"channel", channel,
+			"url", url,
+			"seller", product.Seller,
+			"fulfillment", product.Fulfillment,
+			"condition", product.Condition,
+		)
+		return
+	}
+	sugar.Debugw("Price is below!", "channel", channel, "url", url, "desired_price", targetPriceStr)
+	var oldPrice float64
+	if previous != nil && previous.Price > 0 {
+		oldPrice, _ = action.comparablePrice(previous)
+	}
+	err = notify(templates.EventPrice, action.Channel, channel, action.Locale, &templates.Data{
+		Product:       product,
+		URL:           productURL,
+		DesiredPrice:  targetPriceStr,
+		ComparedPrice: currentPrice,
+		OldPrice:      oldPrice,
+		Currency:      action.Currency,
+		Tracking:      action,
+		Priority:      action.Priority,
+		Tags:          action.Tags,
+	})
+	if errors.Is(err, errSuppressed) {
+		sugar.Debugw("Notification suppressed. Keeping the action until it's delivered...", "channel", channel, "url", url)
+		return
+	}
+	if err != nil {
+		sugar.Errorw("error when queueing notification", "msg", err.Error())
+		return
+	}
+	if digestOf(action) != nil {
+		sugar.Debugw("Notification added to the digest. Keeping the action...", "channel", channel, "url", url)
+		return
+	}
+	err = deleteAction(priceAction, databaseKey)
+	if err != nil {
+		sugar.Fatalw("error when reading the database", "msg", err.Error())
+	}
+	sugar.Debugw("deleted key from bucket", "key", databaseKey, "bucket", priceAction)
+}
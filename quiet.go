@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// quietHoursBucket is the bucket where the quiet hours of every customer
+	// are stored, under their channel and from
+	quietHoursBucket = "quiet_hours"
+
+	// clockLayout is the layout of the start and end of the quiet hours
+	clockLayout = "15:04"
+)
+
+// QuietHours is the daily window, in the time zone of a customer, during
+// which they don't want to get non-urgent notifications
+type QuietHours struct {
+	From     string `json:"from"`
+	Channel  string `json:"channel,omitempty"`
+	TimeZone string `json:"time_zone"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+}
+
+// validate checks the time zone, start and end of the quiet hours
+func (q *QuietHours) validate() error {
+	if q.From == "" || q.Start == "" || q.End == "" {
+		return fmt.Errorf("from, start and end are required")
+	}
+	if _, err := time.LoadLocation(q.TimeZone); err != nil {
+		return fmt.Errorf("invalid time zone: %s", q.TimeZone)
+	}
+	for _, clock := range []string{q.Start, q.End} {
+		if _, err := time.Parse(clockLayout, clock); err != nil {
+			return fmt.Errorf("invalid time: %s", clock)
+		}
+	}
+	if q.Start == q.End {
+		return fmt.Errorf("start and end must be different")
+	}
+	return nil
+}
+
+// endOf returns when the quiet hours that t is in end, or the zero time if t
+// is not in the quiet hours. Windows can span midnight, e.g. from 22:00 to
+// 08:00.
+func (q *QuietHours) endOf(t time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(q.TimeZone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	start, err := time.Parse(clockLayout, q.Start)
+	if err != nil {
+		return time.Time{}, err
+	}
+	end, err := time.Parse(clockLayout, q.End)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	startMinute, endMinute := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	quiet := minute >= startMinute && minute < endMinute
+	if startMinute > endMinute {
+		quiet = minute >= startMinute || minute < endMinute
+	}
+	if !quiet {
+		return time.Time{}, nil
+	}
+
+	endsAt := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+	if !endsAt.After(local) {
+		endsAt = endsAt.AddDate(0, 0, 1)
+	}
+	return endsAt.UTC(), nil
+}
+
+// isUrgent returns true if the action or group a notification is sent for
+// bypasses the quiet hours
+func isUrgent(tracking interface{}) bool {
+	switch t := tracking.(type) {
+	case *Action:
+		return t.Urgent
+	case *Group:
+		return t.Urgent
+	}
+	return false
+}
+
+// deliveryTime returns when a notification to a customer through a channel
+// can be delivered: right away, unless it's not urgent and they are in their
+// quiet hours
+func deliveryTime(channel, dest string, tracking interface{}) (time.Time, error) {
+	now := time.Now().UTC()
+	if isUrgent(tracking) {
+		return now, nil
+	}
+	value, err := db.Get(contactKey(channel, dest), quietHoursBucket)
+	if err != nil || value == "" {
+		return now, err
+	}
+	q := &QuietHours{}
+	if err = json.Unmarshal([]byte(value), q); err != nil {
+		return now, err
+	}
+	end, err := q.endOf(now)
+	if err != nil || end.IsZero() {
+		return now, err
+	}
+	return end, nil
+}
+
+// postQuietHours will allow us to set the quiet hours of a customer
+func postQuietHours(c echo.Context) error {
+	q := &QuietHours{}
+	if err := c.Bind(q); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid quiet hours: %s", err.Error())})
+	}
+	if err := q.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid quiet hours: %s", err.Error())})
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if q.Channel == "" {
+		q.Channel = defaultChannel
+	}
+	if !user.isVerified(q.Channel, q.From) {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"invalid from: the destination doesn't belong to the user"})
+	}
+
+	sugar.Debugw("setting quiet hours",
+		"from", q.From,
+		"channel", q.Channel,
+		"time_zone", q.TimeZone,
+		"start", q.Start,
+		"end", q.End,
+	)
+
+	value, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	return db.Save(contactKey(q.Channel, q.From), string(value), quietHoursBucket)
+}
+
+// deleteQuietHours will allow us to remove the quiet hours of a customer
+func deleteQuietHours(c echo.Context) error {
+	from, channel := c.QueryParam("from"), c.QueryParam("channel")
+	if from == "" {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid query: from is required"})
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if !user.isVerified(channel, from) {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"invalid from: the destination doesn't belong to the user"})
+	}
+	sugar.Debugw("removing quiet hours", "from", from, "channel", channel)
+	return db.Delete(contactKey(channel, from), quietHoursBucket)
+}
+
+// migrateQuietHours moves the quiet hours stored under their from, before
+// they had a channel, to the key of the default channel
+func migrateQuietHours() error {
+	results, err := db.GetAll(quietHoursBucket)
+	if err != nil {
+		return err
+	}
+	for key, value := range results {
+		q := &QuietHours{}
+		if err = json.Unmarshal([]byte(value), q); err != nil {
+			return err
+		}
+		if q.Channel != "" {
+			continue
+		}
+		q.Channel = defaultChannel
+		migrated, err := json.Marshal(q)
+		if err != nil {
+			return err
+		}
+		sugar.Infow("migrating quiet hours", "from", q.From, "channel", q.Channel)
+		if err = db.Save(contactKey(q.Channel, q.From), string(migrated), quietHoursBucket); err != nil {
+			return err
+		}
+		if err = db.Delete(key, quietHoursBucket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndOf(t *testing.T) {
+	night := &QuietHours{From: "alice", TimeZone: "Europe/Madrid", Start: "22:00", End: "08:00"}
+	nap := &QuietHours{From: "alice", TimeZone: "Europe/Madrid", Start: "14:00", End: "16:30"}
+
+	testCases := []struct {
+		name     string
+		quiet    *QuietHours
+		at       string
+		expected string
+	}{
+		{name: "before midnight", quiet: night, at: "2021-06-10T21:30:00Z", expected: "2021-06-11T06:00:00Z"},
+		{name: "after midnight", quiet: night, at: "2021-06-11T05:00:00Z", expected: "2021-06-11T06:00:00Z"},
+		{name: "at the start", quiet: night, at: "2021-06-10T20:00:00Z", expected: "2021-06-11T06:00:00Z"},
+		{name: "at the end", quiet: night, at: "2021-06-11T06:00:00Z"},
+		{name: "outside a window spanning midnight", quiet: night, at: "2021-06-10T10:00:00Z"},
+		{name: "inside a window within the day", quiet: nap, at: "2021-06-10T13:00:00Z", expected: "2021-06-10T14:30:00Z"},
+		{name: "outside a window within the day", quiet: nap, at: "2021-06-10T11:00:00Z"},
+		{name: "night the clocks go forward", quiet: night, at: "2021-03-27T22:30:00Z", expected: "2021-03-28T06:00:00Z"},
+		{name: "night the clocks go back", quiet: night, at: "2021-10-30T21:30:00Z", expected: "2021-10-31T07:00:00Z"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			at, err := time.Parse(time.RFC3339, tc.at)
+			assert.NoError(tt, err)
+			end, err := tc.quiet.endOf(at)
+			assert.NoError(tt, err)
+			if tc.expected == "" {
+				assert.True(tt, end.IsZero(), end.String())
+				return
+			}
+			assert.Equal(tt, tc.expected, end.Format(time.RFC3339))
+		})
+	}
+}
+
+func TestDeliveryTime(t *testing.T) {
+	setUp(t)
+	now := time.Now().UTC()
+	// Quiet hours from an hour ago to an hour from now, in UTC
+	q := &QuietHours{
+		From:     "alice",
+		Channel:  testChannel,
+		TimeZone: "UTC",
+		Start:    now.Add(-time.Hour).Format(clockLayout),
+		End:      now.Add(time.Hour).Format(clockLayout),
+	}
+	value, err := json.Marshal(q)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Save(contactKey(testChannel, "alice"), string(value), quietHoursBucket))
+
+	at, err := deliveryTime(testChannel, "alice", nil)
+	assert.NoError(t, err)
+	assert.True(t, at.After(now.Add(59*time.Minute)), at.String())
+
+	at, err = deliveryTime(testChannel, "alice", &Action{Urgent: true})
+	assert.NoError(t, err)
+	assert.True(t, at.Before(now.Add(time.Minute)), at.String())
+
+	// Quiet hours are scoped to their channel
+	at, err = deliveryTime("email", "alice", nil)
+	assert.NoError(t, err)
+	assert.True(t, at.Before(now.Add(time.Minute)), at.String())
+}
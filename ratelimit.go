@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/templates"
+)
+
+const (
+	// rateLimitsBucket is the bucket where the times at which notifications
+	// were sent are stored, under the recipient, tracking or fingerprint they
+	// are limited by
+	rateLimitsBucket = "rate_limits"
+
+	// defaultRecipientRateLimit is the default number of notifications a
+	// recipient gets per rate limit window
+	defaultRecipientRateLimit = 10
+	// defaultTrackingRateLimit is the default number of notifications an
+	// action or group sends per rate limit window
+	defaultTrackingRateLimit = 3
+	// defaultRateLimitWindow is the default window of the rate limits
+	defaultRateLimitWindow = time.Hour
+	// defaultDedupWindow is the default window during which identical
+	// notifications are only sent once
+	defaultDedupWindow = time.Hour
+)
+
+// rateLimitMutex prevents concurrent notifications from exceeding the limits
+var rateLimitMutex sync.Mutex
+
+// limit is a maximum number of notifications sent under a key per window
+type limit struct {
+	key    string
+	max    int
+	window time.Duration
+	reason string
+}
+
+// trackingKey returns the key of the action or group a notification is sent
+// for
+func trackingKey(tracking interface{}) string {
+	switch t := tracking.(type) {
+	case *Action:
+		return fmt.Sprintf("%s|%s", t.Type, t.key())
+	case *Group:
+		return fmt.Sprintf("group|%s", t.key())
+	}
+	return ""
+}
+
+// fingerprint returns a hash identifying a notification to its recipient, so
+// identical ones can be told apart
+func fingerprint(channel string, n *notification.Notification) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s", channel, n.Recipient, n.Event, n.Title, n.Message)))
+	return hex.EncodeToString(sum[:])
+}
+
+// allowNotification checks a notification against the dedup window and the
+// rate limits of its recipient and tracking, recording it when it's allowed.
+// Otherwise, it returns the reason why it's suppressed. Digests already batch
+// the notifications of their period, so they are only deduplicated.
+func allowNotification(channel string, n *notification.Notification) (string, error) {
+	rateLimitMutex.Lock()
+	defer rateLimitMutex.Unlock()
+
+	limits := []limit{
+		{key: "dedup|" + fingerprint(channel, n), max: 1, window: dedupWindow, reason: "duplicate"},
+	}
+	if n.Event != templates.EventDigest {
+		limits = append(limits, limit{key: fmt.Sprintf("recipient|%s|%s", channel, n.Recipient), max: recipientRateLimit, window: rateLimitWindow, reason: "recipient rate limit"})
+	}
+	if key := trackingKey(n.Tracking); key != "" {
+		limits = append(limits, limit{key: "tracking|" + key, max: trackingRateLimit, window: rateLimitWindow, reason: "tracking rate limit"})
+	}
+	return checkLimits(limits)
+}
+
+// checkLimits checks the limits, recording the time under all of their keys
+// when none of them is reached. Otherwise, it returns the reason of the first
+// one reached. It must be called with rateLimitMutex locked.
+func checkLimits(limits []limit) (string, error) {
+	now := time.Now().UTC()
+	sent := make([][]time.Time, len(limits))
+	for i, l := range limits {
+		if l.max <= 0 || l.window <= 0 {
+			continue
+		}
+		times, err := sentTimes(l.key, now.Add(-l.window))
+		if err != nil {
+			return "", err
+		}
+		if len(times) >= l.max {
+			return l.reason, nil
+		}
+		sent[i] = times
+	}
+
+	for i, l := range limits {
+		if l.max <= 0 || l.window <= 0 {
+			continue
+		}
+		value, err := json.Marshal(append(sent[i], now))
+		if err != nil {
+			return "", err
+		}
+		if err = db.Save(l.key, string(value), rateLimitsBucket); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// sentTimes returns the times at which notifications limited by a key were
+// sent since the given time
+func sentTimes(key string, since time.Time) ([]time.Time, error) {
+	value, err := db.Get(key, rateLimitsBucket)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	var times []time.Time
+	if err = json.Unmarshal([]byte(value), &times); err != nil {
+		sugar.Errorw("invalid rate limit entry. Resetting it...", "key", key, "msg", err.Error())
+		return nil, nil
+	}
+	recent := times[:0]
+	for _, t := range times {
+		if t.After(since) {
+			recent = append(recent, t)
+		}
+	}
+	return recent, nil
+}
+
+type rateLimitPruner struct{}
+
+// Run deletes the rate limit entries whose notifications were all sent
+// before their window, like the ones of notifications which are not sent
+// again.
+func (p rateLimitPruner) Run() {
+	if err := pruneRateLimits(); err != nil {
+		sugar.Errorw("error when pruning rate limits", "msg", err.Error())
+	}
+}
+
+// pruneRateLimits deletes the rate limit entries which no longer limit any
+// notification
+func pruneRateLimits() error {
+	rateLimitMutex.Lock()
+	defer rateLimitMutex.Unlock()
+
+	results, err := db.GetAll(rateLimitsBucket)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	pruned := 0
+	for key := range results {
+		window := rateLimitWindow
+		switch {
+		case strings.HasPrefix(key, "dedup|"):
+			window = dedupWindow
+		case strings.HasPrefix(key, "verification|"):
+			window = verificationStartWindow
+		}
+		times, err := sentTimes(key, now.Add(-window))
+		if err != nil {
+			return err
+		}
+		if len(times) > 0 {
+			continue
+		}
+		if err = db.Delete(key, rateLimitsBucket); err != nil {
+			return err
+		}
+		pruned++
+	}
+	sugar.Debugw("pruned rate limits", "pruned", pruned, "kept", len(results)-pruned)
+	return nil
+}
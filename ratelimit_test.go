@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/igvaquero18/hermezon/templates"
+	"github.com/stretchr/testify/assert"
+)
+
+// saveSentTimes stores the times at which notifications limited by a key
+// were sent
+func saveSentTimes(t *testing.T, key string, times ...time.Time) {
+	value, err := json.Marshal(times)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Save(key, string(value), rateLimitsBucket))
+}
+
+func TestAllowNotification(t *testing.T) {
+	setUp(t)
+	recipientRateLimit = 2
+	message := func(text string) *notification.Notification {
+		return &notification.Notification{Event: templates.EventAvailability, Recipient: "alice", Message: text}
+	}
+
+	reason, err := allowNotification(testChannel, message("first"))
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// Identical notifications are sent once per dedup window
+	reason, err = allowNotification(testChannel, message("first"))
+	assert.NoError(t, err)
+	assert.Equal(t, "duplicate", reason)
+
+	reason, err = allowNotification(testChannel, message("second"))
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+	reason, err = allowNotification(testChannel, message("third"))
+	assert.NoError(t, err)
+	assert.Equal(t, "recipient rate limit", reason)
+
+	// The limits are per channel and recipient
+	other := message("third")
+	other.Recipient = "bob"
+	reason, err = allowNotification(testChannel, other)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// Digests are only deduplicated
+	digest := message("digest")
+	digest.Event = templates.EventDigest
+	reason, err = allowNotification(testChannel, digest)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+}
+
+func TestAllowNotificationWindows(t *testing.T) {
+	setUp(t)
+	trackingRateLimit = 1
+	action := &Action{Type: availabilityAction, From: "alice", URL: "https://www.amazon.es/dp/B01"}
+	n := &notification.Notification{Event: templates.EventAvailability, Recipient: "alice", Message: "available", Tracking: action}
+
+	// Notifications sent before the windows don't count
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	saveSentTimes(t, "dedup|"+fingerprint(testChannel, n), old)
+	saveSentTimes(t, "tracking|"+trackingKey(action), old)
+	reason, err := allowNotification(testChannel, n)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	n.Message = "available again"
+	reason, err = allowNotification(testChannel, n)
+	assert.NoError(t, err)
+	assert.Equal(t, "tracking rate limit", reason)
+
+	// Limits without a window are disabled
+	dedupWindow, rateLimitWindow = 0, 0
+	reason, err = allowNotification(testChannel, n)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+}
+
+func TestNotifySuppressed(t *testing.T) {
+	fake := setUp(t)
+	data := &templates.Data{
+		Product: &scraper.Product{Title: "Kindle", Available: true},
+		URL:     "https://www.amazon.es/dp/B01",
+	}
+	assert.NoError(t, notify(templates.EventAvailability, "", "alice", "", data))
+	err := notify(templates.EventAvailability, "", "alice", "", data)
+	assert.True(t, errors.Is(err, errSuppressed), fmt.Sprint(err))
+
+	assert.Len(t, fake.messages(), 1)
+}
+
+func TestPruneRateLimits(t *testing.T) {
+	setUp(t)
+	now := time.Now().UTC()
+	saveSentTimes(t, "dedup|expired", now.Add(-2*dedupWindow))
+	saveSentTimes(t, "dedup|fresh", now.Add(-dedupWindow/2))
+	saveSentTimes(t, "recipient|test|alice", now.Add(-2*rateLimitWindow), now.Add(-time.Minute))
+	saveSentTimes(t, "verification|alice", now.Add(-2*verificationStartWindow))
+
+	assert.NoError(t, pruneRateLimits())
+	results, err := db.GetAll(rateLimitsBucket)
+	assert.NoError(t, err)
+	keys := []string{}
+	for key := range results {
+		keys = append(keys, key)
+	}
+	assert.ElementsMatch(t, []string{"dedup|fresh", "recipient|test|alice"}, keys)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/igvaquero18/hermezon/currency"
+)
+
+// rateProvider provides the exchange rates used to compare prices in
+// different currencies. It's nil when no exchange rates are configured.
+var rateProvider currency.RateProvider
+
+// newRateProvider returns the provider of exchange rates, which is the HTTP
+// one when its URL is set, and the static table file otherwise. Rates are
+// cached in the database. A nil provider is returned when none of them are
+// available.
+func newRateProvider() currency.RateProvider {
+	var provider currency.RateProvider
+	if ratesURL != "" {
+		provider = currency.NewHTTPProvider(ratesURL)
+	} else {
+		table, err := currency.NewStaticProvider(ratesFilePath)
+		if err != nil {
+			sugar.Infow("exchange rates are not available, prices won't be converted", "path", ratesFilePath, "msg", err.Error())
+			return nil
+		}
+		provider = table
+	}
+	return currency.NewCachedProvider(provider, db, ratesTTL, sugar)
+}
+
+// convertPrice converts a price to the target currency. Prices whose
+// currency is unknown are considered to be in the target currency already.
+func convertPrice(price float64, from, to string) (float64, error) {
+	if from == "" || to == "" || strings.EqualFold(from, to) {
+		return price, nil
+	}
+	if rateProvider == nil {
+		return 0, fmt.Errorf("unable to convert price from %s to %s: no exchange rates configured", from, to)
+	}
+	return currency.Convert(rateProvider, price, from, to)
+}
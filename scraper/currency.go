@@ -0,0 +1,70 @@
+package scraper
+
+import (
+	"net/url"
+	"strings"
+)
+
+var (
+	// currencySymbols maps the symbols and codes found next to prices to
+	// their ISO 4217 code. Codes are checked before symbols, since some
+	// symbols are part of other codes. Ambiguous symbols, shared by several
+	// currencies, only tell the currency when the store doesn't.
+	currencySymbols = []struct {
+		symbol, code string
+		ambiguous    bool
+	}{
+		{"EUR", "EUR", false}, {"GBP", "GBP", false}, {"USD", "USD", false},
+		{"CHF", "CHF", false}, {"SEK", "SEK", false}, {"PLN", "PLN", false},
+		{"CAD", "CAD", false}, {"MXN", "MXN", false}, {"JPY", "JPY", false},
+		{"€", "EUR", false}, {"£", "GBP", false}, {"zł", "PLN", false},
+		{"¥", "JPY", true}, {"$", "USD", true},
+	}
+
+	// domainCurrencies maps the top level domains of stores to the currency
+	// of their prices. Generic domains like .com are only mapped for Amazon.
+	domainCurrencies = map[string]string{
+		".es": "EUR", ".de": "EUR", ".fr": "EUR", ".it": "EUR", ".nl": "EUR",
+		".be": "EUR", ".pt": "EUR", ".ie": "EUR", ".at": "EUR",
+		".co.uk": "GBP", ".uk": "GBP", "amazon.com": "USD", ".ca": "CAD",
+		".com.mx": "MXN", ".co.jp": "JPY", ".jp": "JPY", ".se": "SEK",
+		".pl": "PLN", ".ch": "CHF",
+	}
+)
+
+// detectCurrency returns the ISO 4217 code of the currency of a price text,
+// or the one of the store when the text doesn't tell, based on the top
+// level domain of its URL. Ambiguous symbols like $ are only used when the
+// store is unknown. An empty string is returned if it's unknown.
+func detectCurrency(text, storeURL string) string {
+	for _, c := range currencySymbols {
+		if !strings.Contains(text, c.symbol) {
+			continue
+		}
+		if !c.ambiguous {
+			return c.code
+		}
+		if code := domainCurrency(storeURL); code != "" {
+			return code
+		}
+		return c.code
+	}
+	return domainCurrency(storeURL)
+}
+
+// domainCurrency returns the ISO 4217 code of the currency of a store, based
+// on the top level domain of its URL, or an empty string if it's unknown
+func domainCurrency(storeURL string) string {
+	u, err := url.Parse(storeURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	longest := ""
+	for domain := range domainCurrencies {
+		if strings.HasSuffix(host, domain) && len(domain) > len(longest) {
+			longest = domain
+		}
+	}
+	return domainCurrencies[longest]
+}
@@ -0,0 +1,32 @@
+package scraper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectCurrency(t *testing.T) {
+	testCases := []struct {
+		name, text, url, expected string
+	}{
+		{name: "euro symbol", text: "499,99 €", url: "https://www.amazon.co.uk/dp/B08L5SNWD2", expected: "EUR"},
+		{name: "pound symbol", text: "£449.00", url: "https://store.com", expected: "GBP"},
+		{name: "currency code", text: "CHF 499.00", url: "https://store.com", expected: "CHF"},
+		{name: "dollar symbol", text: "$499", url: "https://store.com", expected: "USD"},
+		{name: "german amazon", text: "499,99", url: "https://www.amazon.de/dp/B08L5SNWD2", expected: "EUR"},
+		{name: "british amazon", text: "449.00", url: "https://www.amazon.co.uk/dp/B08L5SNWD2", expected: "GBP"},
+		{name: "american amazon", text: "499.00", url: "https://www.amazon.com/dp/B08L5SNWD2", expected: "USD"},
+		{name: "mexican amazon", text: "9999.00", url: "https://www.amazon.com.mx/dp/B08L5SNWD2", expected: "MXN"},
+		{name: "dollar symbol in mexican amazon", text: "$9,999.00", url: "https://www.amazon.com.mx/dp/B08L5SNWD2", expected: "MXN"},
+		{name: "dollar symbol in canadian store", text: "$499.00", url: "https://store.ca/product", expected: "CAD"},
+		{name: "euro symbol in american amazon", text: "499,99 €", url: "https://www.amazon.com/dp/B08L5SNWD2", expected: "EUR"},
+		{name: "unknown", text: "499.00", url: "https://store.com/product", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, detectCurrency(tc.text, tc.url))
+		})
+	}
+}
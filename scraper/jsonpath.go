@@ -0,0 +1,130 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is a single step of a parsed JSONPath expression. A step
+// either selects an object member by name, an array element by index
+// or, when wildcard is true, every child of the current node.
+type jsonPathStep struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the subset of JSONPath supported by the scraper:
+// the root ($), dot notation ($.a.b), bracket notation ($['a'] or $["a"]),
+// array indexes, including negative ones ($.items[0], $.items[-1]) and
+// wildcards ($.items[*].price, $.offers.*).
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("invalid json path %q: it must start with $", path)
+	}
+	steps := []jsonPathStep{}
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("invalid json path %q: empty member name", path)
+			}
+			if name == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else {
+				steps = append(steps, jsonPathStep{name: name})
+			}
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("invalid json path %q: unclosed bracket", path)
+			}
+			content := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case content == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0]:
+				steps = append(steps, jsonPathStep{name: content[1 : len(content)-1]})
+			default:
+				index, err := strconv.Atoi(content)
+				if err != nil {
+					return nil, fmt.Errorf("invalid json path %q: invalid index %q", path, content)
+				}
+				steps = append(steps, jsonPathStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("invalid json path %q: unexpected character %q", path, rest[0])
+		}
+	}
+	return steps, nil
+}
+
+// evalJSONPath evaluates a JSONPath expression against a decoded JSON
+// document and returns every matched node.
+func evalJSONPath(path string, doc interface{}) ([]interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []interface{}{doc}
+	for _, step := range steps {
+		next := []interface{}{}
+		for _, node := range nodes {
+			switch n := node.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					for _, v := range n {
+						next = append(next, v)
+					}
+				} else if v, ok := n[step.name]; ok && !step.isIndex {
+					next = append(next, v)
+				}
+			case []interface{}:
+				if step.wildcard {
+					next = append(next, n...)
+				} else if step.isIndex {
+					i := step.index
+					if i < 0 {
+						i += len(n)
+					}
+					if i >= 0 && i < len(n) {
+						next = append(next, n[i])
+					}
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes, nil
+}
+
+// jsonNodeText returns the textual representation of a JSON node, the
+// same way it would be read from an HTML element.
+func jsonNodeText(node interface{}) string {
+	switch n := node.(type) {
+	case nil:
+		return ""
+	case string:
+		return n
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(n)
+	default:
+		b, _ := json.Marshal(n)
+		return string(b)
+	}
+}
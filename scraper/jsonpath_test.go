@@ -0,0 +1,120 @@
+package scraper
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalJSONPath(t *testing.T) {
+	const document = `{
+		"name": "Playstation 5",
+		"in stock": true,
+		"offers": [
+			{"seller": "Amazon", "price": 499.99},
+			{"seller": "Other", "price": 650}
+		],
+		"stock": {"madrid": 0}
+	}`
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(document), &doc); err != nil {
+		t.Fatalf("error decoding test document: %s", err.Error())
+	}
+
+	testCases := []struct {
+		name, path string
+		expected   []interface{}
+		err        bool
+	}{
+		{
+			name:     "root",
+			path:     "$",
+			expected: []interface{}{doc},
+		},
+		{
+			name:     "dot notation",
+			path:     "$.name",
+			expected: []interface{}{"Playstation 5"},
+		},
+		{
+			name:     "bracket notation",
+			path:     "$['in stock']",
+			expected: []interface{}{true},
+		},
+		{
+			name:     "array index",
+			path:     "$.offers[1].price",
+			expected: []interface{}{650.0},
+		},
+		{
+			name:     "negative array index",
+			path:     `$.offers[-1]["seller"]`,
+			expected: []interface{}{"Other"},
+		},
+		{
+			name:     "array wildcard",
+			path:     "$.offers[*].seller",
+			expected: []interface{}{"Amazon", "Other"},
+		},
+		{
+			name:     "object wildcard",
+			path:     "$.stock.*",
+			expected: []interface{}{0.0},
+		},
+		{
+			name:     "non existing member",
+			path:     "$.offers[5].price",
+			expected: []interface{}{},
+		},
+		{
+			name: "missing root",
+			path: "offers[0].price",
+			err:  true,
+		},
+		{
+			name: "unclosed bracket",
+			path: "$.offers[0",
+			err:  true,
+		},
+		{
+			name: "invalid index",
+			path: "$.offers[first]",
+			err:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			actual, err := evalJSONPath(tc.path, doc)
+			if tc.err {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+				assert.Equal(tt, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestJSONNodeText(t *testing.T) {
+	testCases := []struct {
+		name     string
+		node     interface{}
+		expected string
+	}{
+		{name: "null", node: nil, expected: ""},
+		{name: "string", node: "in_stock", expected: "in_stock"},
+		{name: "integer", node: 650.0, expected: "650"},
+		{name: "decimal", node: 499.99, expected: "499.99"},
+		{name: "boolean", node: true, expected: "true"},
+		{name: "object", node: map[string]interface{}{"a": 1.0}, expected: `{"a":1}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, jsonNodeText(tc.node))
+		})
+	}
+}
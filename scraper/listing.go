@@ -0,0 +1,124 @@
+package scraper
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// DefaultItemSelector is a default CSS selector for the items of a search
+	// or category listing.
+	DefaultItemSelector = "div[data-component-type='s-search-result']"
+
+	// DefaultItemPriceSelector is a default CSS selector for the price of an
+	// item, relative to the item itself.
+	DefaultItemPriceSelector = ".a-price .a-offscreen"
+)
+
+var (
+	amazonProductRegexp = regexp.MustCompile(`/(?:dp|gp/product)/([A-Z0-9]{10})`)
+	trackingParams      = []string{"ref", "ref_", "qid", "sr", "crid", "sprefix", "keywords", "dchild", "th", "psc"}
+)
+
+// Item is a product found in a search or category listing
+type Item struct {
+	URL   string  `json:"url"`
+	Title string  `json:"title"`
+	Price float64 `json:"price,omitempty"`
+}
+
+// SetItemSelector Sets the CSS selector for the items of a listing
+func SetItemSelector(itemSelector string) Option {
+	return func(s *Scraper) Option {
+		prev := s.itemSelector
+		s.itemSelector = itemSelector
+		return SetItemSelector(prev)
+	}
+}
+
+// Listing returns the items found in a search or category listing page.
+// The link of each item is the first anchor inside of it, and its price
+// is read from the selector of the Scraper, relative to the item. Items
+// whose price can't be found are returned with a price of 0.
+func (s Scraper) Listing() ([]Item, error) {
+	base, err := url.Parse(s.url)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []Item{}
+	doc.Find(s.itemSelector).Each(func(i int, sel *goquery.Selection) {
+		link := sel.Find("a[href]").First()
+		if goquery.NodeName(sel) == "a" {
+			link = sel
+		}
+		href, ok := link.Attr("href")
+		if !ok {
+			return
+		}
+		ref, err := base.Parse(href)
+		if err != nil {
+			s.Debugw("invalid item link", "url", s.url, "href", href)
+			return
+		}
+		title := strings.TrimSpace(sel.Find("h2").First().Text())
+		if title == "" {
+			title = strings.TrimSpace(link.Text())
+		}
+		item := Item{
+			URL:   canonicalItemURL(ref),
+			Title: strings.Join(strings.Fields(title), " "),
+		}
+		if text := sel.Find(s.selector).First().Text(); text != "" {
+			if price, err := parsePrice(text); err == nil {
+				item.Price = price
+			}
+		}
+		items = append(items, item)
+	})
+	s.Debugw("found items", "url", s.url, "items", len(items), "item_selector", s.itemSelector)
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no items matched")
+	}
+	return items, nil
+}
+
+// canonicalItemURL strips the parts of a product URL that change between
+// two loads of the same listing, like fragments or tracking parameters, so
+// the same product is always identified by the same URL. Amazon product
+// URLs are reduced to their /dp/ASIN form.
+func canonicalItemURL(u *url.URL) string {
+	c := *u
+	c.Fragment = ""
+	if match := amazonProductRegexp.FindStringSubmatch(c.Path); match != nil && strings.Contains(c.Host, "amazon.") {
+		c.Path = fmt.Sprintf("/dp/%s", match[1])
+		c.RawQuery = ""
+		return c.String()
+	}
+	query := c.Query()
+	for param := range query {
+		for _, tracking := range trackingParams {
+			if param == tracking || strings.HasPrefix(param, "utm_") {
+				query.Del(param)
+			}
+		}
+	}
+	c.RawQuery = query.Encode()
+	return c.String()
+}
@@ -0,0 +1,200 @@
+package scraper
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/igvaquero18/hermezon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListing(t *testing.T) {
+	const listing = `
+	<div class="results">
+		<div data-component-type="s-search-result">
+			<h2><a href="/Sony-PlayStation-5/dp/B08KKJ37F7/ref=sr_1_1?qid=1612&sr=8-1">Sony  PlayStation 5</a></h2>
+			<span class="a-price"><span class="a-offscreen">499,99 €</span></span>
+		</div>
+		<div data-component-type="s-search-result">
+			<h2><a href="https://www.amazon.es/gp/product/B08H93ZRK9?psc=1">Xbox Series X</a></h2>
+		</div>
+		<div data-component-type="s-search-result">
+			<span>Sponsored content without link</span>
+		</div>
+	</div>`
+
+	testCases := []struct {
+		name     string
+		scr      *Scraper
+		err      error
+		expected []Item
+	}{
+		{
+			name: "items with and without price",
+			scr: &Scraper{
+				url:                "https://www.amazon.es/s?k=consola",
+				expectedStatusCode: http.StatusOK,
+				selector:           DefaultItemPriceSelector,
+				itemSelector:       DefaultItemSelector,
+				maxRetries:         DefaultMaxRetries,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client: NewTestClient(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewBufferString(listing)),
+						Header:     make(http.Header),
+					}, nil
+				}),
+			},
+			expected: []Item{
+				{
+					URL:   "https://www.amazon.es/dp/B08KKJ37F7",
+					Title: "Sony PlayStation 5",
+					Price: 499.99,
+				},
+				{
+					URL:   "https://www.amazon.es/dp/B08H93ZRK9",
+					Title: "Xbox Series X",
+				},
+			},
+		},
+		{
+			name: "items are anchors",
+			scr: &Scraper{
+				url:                "https://store.com/category/consoles",
+				expectedStatusCode: http.StatusOK,
+				selector:           ".price",
+				itemSelector:       "a.product",
+				maxRetries:         DefaultMaxRetries,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client: NewTestClient(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body: ioutil.NopCloser(bytes.NewBufferString(
+							`<a class="product" href="ps5?id=1&utm_source=home#reviews">PS5 <span class="price">$499</span></a>`,
+						)),
+						Header: make(http.Header),
+					}, nil
+				}),
+			},
+			expected: []Item{
+				{
+					URL:   "https://store.com/category/ps5?id=1",
+					Title: "PS5 $499",
+					Price: 499,
+				},
+			},
+		},
+		{
+			name: "prices which can't be parsed",
+			scr: &Scraper{
+				url:                "https://store.com/category/consoles",
+				expectedStatusCode: http.StatusOK,
+				selector:           ".price",
+				itemSelector:       ".product",
+				maxRetries:         DefaultMaxRetries,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client: NewTestClient(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body: ioutil.NopCloser(bytes.NewBufferString(
+							`<div class="product"><h2><a href="/xbox">Xbox Series X</a></h2><span class="price">Sold out</span></div>`,
+						)),
+						Header: make(http.Header),
+					}, nil
+				}),
+			},
+			expected: []Item{
+				{
+					URL:   "https://store.com/xbox",
+					Title: "Xbox Series X",
+				},
+			},
+		},
+		{
+			name: "no items matched",
+			scr: &Scraper{
+				url:                "https://store.com/category/consoles",
+				expectedStatusCode: http.StatusOK,
+				selector:           ".price",
+				itemSelector:       ".product",
+				maxRetries:         DefaultMaxRetries,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client: NewTestClient(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewBufferString(listing)),
+						Header:     make(http.Header),
+					}, nil
+				}),
+			},
+			err: fmt.Errorf("no items matched"),
+		},
+		{
+			name: "errors when accessing the store",
+			scr: &Scraper{
+				url:                "https://store.com/category/consoles",
+				expectedStatusCode: http.StatusOK,
+				selector:           ".price",
+				itemSelector:       ".product",
+				maxRetries:         1,
+				retrySeconds:       0,
+				Logger:             &utils.DefaultLogger{},
+				client: NewTestClient(func(req *http.Request) (*http.Response, error) {
+					return nil, fmt.Errorf("some error")
+				}),
+			},
+			err: fmt.Errorf("some error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			items, err := tc.scr.Listing()
+			if tc.err != nil {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+				assert.Equal(tt, tc.expected, items)
+			}
+		})
+	}
+}
+
+func TestCanonicalItemURL(t *testing.T) {
+	testCases := []struct {
+		name, url, expected string
+	}{
+		{
+			name:     "amazon product with slug and ref",
+			url:      "https://www.amazon.es/Apple-iPhone-12/dp/B08L5SNWD2/ref=sr_1_3?dchild=1&keywords=iphone",
+			expected: "https://www.amazon.es/dp/B08L5SNWD2",
+		},
+		{
+			name:     "non amazon store with dp path",
+			url:      "https://store.com/dp/B08L5SNWD2?id=3",
+			expected: "https://store.com/dp/B08L5SNWD2?id=3",
+		},
+		{
+			name:     "tracking parameters and fragment",
+			url:      "https://store.com/product?id=3&utm_campaign=x&ref=home#top",
+			expected: "https://store.com/product?id=3",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			u, err := url.Parse(tc.url)
+			assert.NoError(tt, err)
+			assert.Equal(tt, tc.expected, canonicalItemURL(u))
+		})
+	}
+}
@@ -0,0 +1,571 @@
+package scraper
+
+import (
+	"encoding/json"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// DefaultStockSelector is a default CSS selector for the remaining stock
+	// message of a product, like "Solo quedan 3 en stock".
+	DefaultStockSelector = "#availability"
+
+	// DefaultDeliverySelector is a default CSS selector for the estimated
+	// delivery message of a product.
+	DefaultDeliverySelector = "#mir-layout-DELIVERY_BLOCK, #deliveryMessageMirId, #ddmDeliveryMessage"
+
+	// DefaultPriceSelector is a default CSS selector for the price of a product.
+	DefaultPriceSelector = "#priceblock_ourprice, #priceblock_dealprice, #priceblock_saleprice, #price_inside_buybox, #corePrice_feature_div .a-offscreen"
+
+	// DefaultMerchantSelector is a default CSS selector for the message telling
+	// who sells and ships the offer in the buy box.
+	DefaultMerchantSelector = "#merchant-info, #tabular-buybox"
+
+	// DefaultSellerSelector is a default CSS selector for the name of the
+	// third-party seller of the offer in the buy box.
+	DefaultSellerSelector = "#sellerProfileTriggerId"
+
+	// DefaultConditionSelector is a default CSS selector for the buy box of
+	// offers that are not new.
+	DefaultConditionSelector = "#usedOnlyBuybox, #usedBuySection, #renewedBuyBoxFeature_feature_div"
+
+	// DefaultShippingSelector is a default CSS selector for the shipping cost
+	// message of a product. The delivery messages are looked into as well.
+	DefaultShippingSelector = "#price-shipping-message, #ourprice_shippingmessage, #exports_desktop_qualifiedBuybox_tlc_feature_div"
+
+	// DefaultCouponSelector is a default CSS selector for the coupons and
+	// promotions of a product.
+	DefaultCouponSelector = "#couponBadge, #vpcButton, #promoPriceBlockMessage_feature_div, #applicable_promotion_list_sec"
+
+	// gtinMicrodataSelector is a CSS selector for the GTIN of a product in
+	// its microdata
+	gtinMicrodataSelector = `[itemprop="gtin13"], [itemprop="gtin"], [itemprop="gtin12"], [itemprop="gtin14"], [itemprop="gtin8"]`
+
+	// DefaultTitleSelector is a default CSS selector for the title of a product.
+	// The Open Graph and structured data titles are used when it's not found.
+	DefaultTitleSelector = "#productTitle"
+
+	// DefaultImageSelector is a default CSS selector for the main image of a
+	// product. The Open Graph and structured data images are used when it's
+	// not found.
+	DefaultImageSelector = "#landingImage, #imgBlkFront"
+
+	// FulfillmentAmazon is the fulfillment of offers shipped by Amazon
+	FulfillmentAmazon = "amazon"
+
+	// FulfillmentMarketplace is the fulfillment of offers shipped by third-party sellers
+	FulfillmentMarketplace = "marketplace"
+
+	// ConditionNew is the condition of new offers
+	ConditionNew = "new"
+
+	// ConditionUsed is the condition of used offers
+	ConditionUsed = "used"
+
+	// ConditionRefurbished is the condition of refurbished offers
+	ConditionRefurbished = "refurbished"
+)
+
+var (
+	gtinKeys = []string{"gtin13", "gtin", "gtin12", "gtin14", "gtin8", "ean"}
+
+	// now is used instead of time.Now so tests can fix the current date
+	now = time.Now
+
+	months = map[string]time.Month{
+		"enero": time.January, "febrero": time.February, "marzo": time.March,
+		"abril": time.April, "mayo": time.May, "junio": time.June, "julio": time.July,
+		"agosto": time.August, "septiembre": time.September, "setiembre": time.September,
+		"octubre": time.October, "noviembre": time.November, "diciembre": time.December,
+		"january": time.January, "february": time.February, "march": time.March,
+		"april": time.April, "may": time.May, "june": time.June, "july": time.July,
+		"august": time.August, "september": time.September, "october": time.October,
+		"november": time.November, "december": time.December,
+		"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+		"jun": time.June, "jul": time.July, "aug": time.August, "sep": time.September,
+		"sept": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+	}
+
+	monthNames           = `(enero|febrero|marzo|abril|mayo|junio|julio|agosto|septiembre|setiembre|octubre|noviembre|diciembre|january|february|march|april|may|june|july|august|september|october|november|december|jan|feb|mar|apr|jun|jul|aug|sept|sep|oct|nov|dec)`
+	dayMonthRegexp       = regexp.MustCompile(`(?i)\b(\d{1,2})(?:\s*-\s*(\d{1,2}))?\s+(?:de\s+)?` + monthNames + `\b`)
+	monthDayRegexp       = regexp.MustCompile(`(?i)\b` + monthNames + `\.?\s+(\d{1,2})(?:\s*-\s*(\d{1,2}))?\b`)
+	tomorrowRegexp       = regexp.MustCompile(`(?i)\b(mañana|tomorrow)\b`)
+	todayRegexp          = regexp.MustCompile(`(?i)\b(hoy|today)\b`)
+	lowQuantityRegexp    = regexp.MustCompile(`(?i)\b(?:quedan?|only)\s+(\d+)\s+(?:unidad(?:es)?\s+)?(?:en stock|left in stock)`)
+	sellerRegexp         = regexp.MustCompile(`(?i)\b(?:vendido|sold)(?:\s+y\s+enviado)?\s+(?:por|by)\s+(.+?)(?:\s+(?:y|and)\s+|\.\s|\.$|$)`)
+	freeShippingRegexp   = regexp.MustCompile(`(?i)\b(?:env[ií]o|entrega)\s+gratis|\bfree\s+(?:shipping|delivery)`)
+	shippingAfterRegexp  = regexp.MustCompile(`(?i)(?:env[ií]o|entrega|shipping|delivery)\s+(?:por|de|for)?\s*[€$£]?\s*(\d+[.,]\d{2})`)
+	shippingBeforeRegexp = regexp.MustCompile(`(?i)(\d+[.,]\d{2})\s*[€$£]?\s+(?:de\s+)?(?:gastos de\s+)?(?:env[ií]o|shipping|delivery)`)
+	nonDigitRegexp       = regexp.MustCompile(`\D`)
+	percentRegexp        = regexp.MustCompile(`(\d+(?:[.,]\d+)?)\s*%`)
+	couponRegexp         = regexp.MustCompile(`(?i)\b(?:cup[oó]n|coupon|ahorra|save)`)
+	amountAfterRegexp    = regexp.MustCompile(`[€$£]\s*(\d+(?:[.,]\d+)?)`)
+	amountBeforeRegexp   = regexp.MustCompile(`(\d+(?:[.,]\d+)?)\s*[€$£]`)
+	shippedByAmazon      = regexp.MustCompile(`(?i)\b(?:enviado (?:por|desde)|gestionado por|fulfilled by|ships from|dispatched from)(?: and sold by)?\s+amazon`)
+)
+
+// Product holds the facts scraped from the page of a product
+type Product struct {
+	Title        string     `json:"title,omitempty"`
+	Image        string     `json:"image,omitempty"`
+	Available    bool       `json:"available"`
+	Price        float64    `json:"price,omitempty"`
+	Currency     string     `json:"currency,omitempty"`
+	Quantity     int        `json:"quantity,omitempty"`
+	DeliveryDate *time.Time `json:"delivery_date,omitempty"`
+	Seller       string     `json:"seller,omitempty"`
+	Fulfillment  string     `json:"fulfillment,omitempty"`
+	Condition    string     `json:"condition,omitempty"`
+	Shipping     float64    `json:"shipping,omitempty"`
+	Discount     float64    `json:"discount,omitempty"`
+	GTIN         string     `json:"gtin,omitempty"`
+}
+
+// EffectivePrice returns the price the customer actually pays for the
+// product, including the shipping costs and the coupons and promotions
+// shown on its page
+func (p *Product) EffectivePrice() float64 {
+	price := p.Price + p.Shipping - p.Discount
+	if price < 0 {
+		return 0
+	}
+	return price
+}
+
+// SoldByAmazon returns true if the offer is sold by Amazon itself
+func (p *Product) SoldByAmazon() bool {
+	return strings.HasPrefix(strings.ToLower(p.Seller), "amazon")
+}
+
+// Product scrapes the page of the product and returns its facts. The
+// product is available if the text in the selector contains the text to
+// find, and its price is the one in the price selector. When those selectors
+// don't match anything, the offer in the structured data of the page is used
+// instead. For JSON responses both are read from the JSONPath expression. The
+// rest of the facts are only set when the store shows them.
+func (s Scraper) Product() (*Product, error) {
+	doc, text, err := s.getPage()
+	if err != nil {
+		return nil, err
+	}
+	if doc != nil {
+		if err = s.checkVariant(doc); err != nil {
+			return nil, err
+		}
+	}
+	product := &Product{
+		Available: strings.Contains(strings.TrimSpace(strings.ToLower(text)), strings.TrimSpace(strings.ToLower(s.findText))),
+	}
+	if doc == nil {
+		if price, err := parsePrice(text); err == nil {
+			product.Price = price
+			product.Currency = detectCurrency(text, s.url)
+		}
+		return product, nil
+	}
+
+	if priceText := doc.Find(s.priceSelector).First().Text(); priceText != "" {
+		if price, err := parsePrice(priceText); err == nil {
+			product.Price = price
+			product.Currency = detectCurrency(priceText, s.url)
+		}
+	}
+	offer := extractStructuredOffer(doc)
+	if product.Price == 0 && offer.price > 0 {
+		product.Price = offer.price
+		product.Currency = offer.currency
+		if product.Currency == "" {
+			product.Currency = detectCurrency("", s.url)
+		}
+	}
+	if strings.TrimSpace(text) == "" && offer.availability != "" {
+		product.Available = isInStock(offer.availability)
+	}
+	product.Title, product.Image = extractMetadata(doc, s.url)
+	product.Quantity = extractQuantity(text + " " + doc.Find(DefaultStockSelector).Text())
+	product.DeliveryDate = extractDeliveryDate(deliveryText(doc))
+	product.Seller, product.Fulfillment = extractMerchant(doc)
+	product.Condition = extractCondition(doc, product.Seller != "" || product.Price > 0)
+	product.Shipping = extractShipping(deliveryText(doc) + " " + strings.Join(strings.Fields(doc.Find(DefaultShippingSelector).Text()), " "))
+	product.GTIN = extractGTIN(doc)
+	product.Discount = extractDiscount(strings.Join(strings.Fields(doc.Find(DefaultCouponSelector).Text()), " "), product.Price)
+	s.Debugw("found product facts",
+		"url", s.url,
+		"variant", s.variant,
+		"title", product.Title,
+		"image", product.Image,
+		"available", product.Available,
+		"price", product.Price,
+		"currency", product.Currency,
+		"quantity", product.Quantity,
+		"delivery_date", product.DeliveryDate,
+		"seller", product.Seller,
+		"fulfillment", product.Fulfillment,
+		"condition", product.Condition,
+		"shipping", product.Shipping,
+		"discount", product.Discount,
+		"gtin", product.GTIN,
+	)
+	return product, nil
+}
+
+// extractGTIN returns the GTIN (EAN, UPC...) of the product from its
+// structured data, either JSON-LD or microdata, or an empty string if the
+// page doesn't have it
+func extractGTIN(doc *goquery.Document) string {
+	for _, data := range structuredData(doc) {
+		if gtin := findGTIN(data); gtin != "" {
+			return gtin
+		}
+	}
+	gtin := ""
+	doc.Find(gtinMicrodataSelector).EachWithBreak(func(i int, sel *goquery.Selection) bool {
+		value, ok := sel.Attr("content")
+		if !ok {
+			value = sel.Text()
+		}
+		gtin = normalizeGTIN(value)
+		return gtin == ""
+	})
+	return gtin
+}
+
+// structuredData returns the decoded JSON-LD documents of a page
+func structuredData(doc *goquery.Document) []interface{} {
+	documents := []interface{}{}
+	doc.Find(`script[type="application/ld+json"]`).Each(func(i int, sel *goquery.Selection) {
+		var data interface{}
+		if err := json.Unmarshal([]byte(sel.Text()), &data); err == nil {
+			documents = append(documents, data)
+		}
+	})
+	return documents
+}
+
+// structuredOffer is an offer found in the structured data of a page
+type structuredOffer struct {
+	price        float64
+	currency     string
+	availability string
+}
+
+// extractStructuredOffer returns the price, currency and schema.org
+// availability of the first offer found in the JSON-LD documents of a page.
+// Most stores publish them, so they are used when the selectors don't match
+// anything.
+func extractStructuredOffer(doc *goquery.Document) structuredOffer {
+	for _, data := range structuredData(doc) {
+		if offer := findOffer(data); offer != nil {
+			price, _ := parsePrice(jsonNodeText(offer["price"]))
+			if price == 0 {
+				price, _ = parsePrice(jsonNodeText(offer["lowPrice"]))
+			}
+			currency, _ := offer["priceCurrency"].(string)
+			availability, _ := offer["availability"].(string)
+			return structuredOffer{price: price, currency: strings.ToUpper(currency), availability: availability}
+		}
+	}
+	return structuredOffer{}
+}
+
+// findOffer looks for an Offer or an AggregateOffer in a decoded JSON-LD document
+func findOffer(data interface{}) map[string]interface{} {
+	return findTyped(data, "Offer", "AggregateOffer")
+}
+
+// findTyped looks for an object of any of the given types in a decoded JSON-LD
+// document
+func findTyped(data interface{}, types ...string) map[string]interface{} {
+	switch d := data.(type) {
+	case map[string]interface{}:
+		if t, _ := d["@type"].(string); containsType(types, t) {
+			return d
+		}
+		for _, value := range d {
+			if found := findTyped(value, types...); found != nil {
+				return found
+			}
+		}
+	case []interface{}:
+		for _, value := range d {
+			if found := findTyped(value, types...); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// containsType returns true if t is one of the types
+func containsType(types []string, t string) bool {
+	for _, typ := range types {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+// isInStock returns true if a schema.org availability means that the product
+// can be bought
+func isInStock(availability string) bool {
+	for _, inStock := range []string{"InStock", "LimitedAvailability", "OnlineOnly"} {
+		if strings.HasSuffix(availability, inStock) {
+			return true
+		}
+	}
+	return false
+}
+
+// findGTIN looks for a GTIN in a decoded JSON-LD document
+func findGTIN(data interface{}) string {
+	switch d := data.(type) {
+	case map[string]interface{}:
+		for _, key := range gtinKeys {
+			if value, ok := d[key]; ok {
+				if gtin := normalizeGTIN(jsonNodeText(value)); gtin != "" {
+					return gtin
+				}
+			}
+		}
+		for _, value := range d {
+			if gtin := findGTIN(value); gtin != "" {
+				return gtin
+			}
+		}
+	case []interface{}:
+		for _, value := range d {
+			if gtin := findGTIN(value); gtin != "" {
+				return gtin
+			}
+		}
+	}
+	return ""
+}
+
+// normalizeGTIN strips everything but digits from a GTIN, and left-pads it
+// with zeros to 13 digits, so the UPC and the EAN of a product are equal.
+// Values which can't be a GTIN are returned as an empty string.
+func normalizeGTIN(value string) string {
+	digits := nonDigitRegexp.ReplaceAllString(value, "")
+	if len(digits) < 8 || len(digits) > 14 {
+		return ""
+	}
+	if len(digits) == 14 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	if len(digits) < 13 {
+		digits = strings.Repeat("0", 13-len(digits)) + digits
+	}
+	return digits
+}
+
+// extractShipping returns the shipping cost from texts like "Envío 3,99 €",
+// "+ 5,99 € de envío" or "FREE delivery". Unknown shipping costs are returned
+// as free, since stores tend to omit them when there are none.
+func extractShipping(text string) float64 {
+	if freeShippingRegexp.MatchString(text) {
+		return 0
+	}
+	for _, reg := range []*regexp.Regexp{shippingAfterRegexp, shippingBeforeRegexp} {
+		if match := reg.FindStringSubmatch(text); match != nil {
+			if shipping, err := parsePrice(match[1]); err == nil {
+				return shipping
+			}
+		}
+	}
+	return 0
+}
+
+// extractDiscount returns the amount saved with the coupons and promotions
+// described in a text, like "Aplicar cupón del 10%" or "Save €5.00 with
+// coupon". Percentages are applied to the given price, and only when the text
+// mentions a coupon or a saving. Amounts must come with a currency symbol.
+func extractDiscount(text string, price float64) float64 {
+	if text == "" {
+		return 0
+	}
+	if match := percentRegexp.FindStringSubmatch(text); match != nil && couponRegexp.MatchString(text) {
+		percent, err := parsePrice(match[1])
+		if err != nil {
+			return 0
+		}
+		return math.Round(price*percent) / 100
+	}
+	for _, reg := range []*regexp.Regexp{amountAfterRegexp, amountBeforeRegexp} {
+		if match := reg.FindStringSubmatch(text); match != nil {
+			if discount, err := parsePrice(match[1]); err == nil {
+				return discount
+			}
+		}
+	}
+	return 0
+}
+
+// extractMetadata returns the title and the absolute URL of the main image
+// of a product
+func extractMetadata(doc *goquery.Document, pageURL string) (string, string) {
+	title := strings.TrimSpace(doc.Find(DefaultTitleSelector).First().Text())
+	if title == "" {
+		title, _ = doc.Find(`meta[property="og:title"]`).First().Attr("content")
+	}
+
+	image := ""
+	img := doc.Find(DefaultImageSelector).First()
+	for _, attr := range []string{"data-old-hires", "src"} {
+		if src, ok := img.Attr(attr); ok && src != "" && !strings.HasPrefix(src, "data:") {
+			image = src
+			break
+		}
+	}
+	if image == "" {
+		image, _ = doc.Find(`meta[property="og:image"]`).First().Attr("content")
+	}
+
+	if title == "" || image == "" {
+		for _, data := range structuredData(doc) {
+			product := findTyped(data, "Product")
+			if product == nil {
+				continue
+			}
+			if title == "" {
+				title, _ = product["name"].(string)
+			}
+			if image == "" {
+				switch img := product["image"].(type) {
+				case string:
+					image = img
+				case []interface{}:
+					if len(img) > 0 {
+						image, _ = img[0].(string)
+					}
+				}
+			}
+			break
+		}
+	}
+	if title == "" {
+		title = doc.Find("title").First().Text()
+	}
+
+	if base, err := url.Parse(pageURL); err == nil && image != "" {
+		if ref, err := base.Parse(image); err == nil {
+			image = ref.String()
+		}
+	}
+	return strings.Join(strings.Fields(title), " "), image
+}
+
+// extractMerchant returns the seller of the offer in the buy box, and whether
+// it's fulfilled by Amazon or by a third-party seller. Both are empty when the
+// page doesn't tell.
+func extractMerchant(doc *goquery.Document) (string, string) {
+	text := strings.Join(strings.Fields(doc.Find(DefaultMerchantSelector).Text()), " ")
+	seller := strings.TrimSpace(doc.Find(DefaultSellerSelector).First().Text())
+	if seller == "" {
+		if match := sellerRegexp.FindStringSubmatch(text); match != nil {
+			seller = strings.TrimSpace(match[1])
+		}
+	}
+	if seller == "" {
+		return "", ""
+	}
+	if shippedByAmazon.MatchString(text) || strings.HasPrefix(strings.ToLower(seller), "amazon") {
+		return seller, FulfillmentAmazon
+	}
+	return seller, FulfillmentMarketplace
+}
+
+// extractCondition returns the condition of the offer in the buy box. Offers
+// are considered new unless the buy box is the one of used or refurbished
+// products. The condition is empty when there's no offer.
+func extractCondition(doc *goquery.Document, hasOffer bool) string {
+	text := strings.ToLower(doc.Find(DefaultConditionSelector).Text())
+	switch {
+	case strings.Contains(text, "reacondicionado") || strings.Contains(text, "renewed") || strings.Contains(text, "refurbished"):
+		return ConditionRefurbished
+	case strings.Contains(text, "usado") || strings.Contains(text, "used"):
+		return ConditionUsed
+	case hasOffer:
+		return ConditionNew
+	}
+	return ""
+}
+
+// deliveryText returns the text of the estimated delivery messages
+func deliveryText(doc *goquery.Document) string {
+	return strings.Join(strings.Fields(doc.Find(DefaultDeliverySelector).Text()), " ")
+}
+
+// extractQuantity returns the remaining quantity of a product from texts like
+// "Solo quedan 3 en stock" or "Only 3 left in stock", or 0 if there's none.
+func extractQuantity(text string) int {
+	match := lowQuantityRegexp.FindStringSubmatch(text)
+	if match == nil {
+		return 0
+	}
+	quantity, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	return quantity
+}
+
+// extractDeliveryDate returns the estimated delivery date from texts like
+// "Recíbelo el lunes, 8 de febrero" or "Get it Feb 8 - 10". When the text
+// contains a range or several dates, the latest one is returned. Since stores
+// don't show the year, dates more than a month in the past are considered to
+// belong to the next year.
+func extractDeliveryDate(text string) *time.Time {
+	today := now()
+	var latest *time.Time
+	consider := func(day string, month string) {
+		d, err := strconv.Atoi(day)
+		m, ok := months[strings.ToLower(month)]
+		if err != nil || !ok || d < 1 || d > 31 {
+			return
+		}
+		date := time.Date(today.Year(), m, d, 0, 0, 0, 0, today.Location())
+		if date.Before(today.AddDate(0, -1, 0)) {
+			date = date.AddDate(1, 0, 0)
+		}
+		if latest == nil || date.After(*latest) {
+			latest = &date
+		}
+	}
+
+	for _, match := range dayMonthRegexp.FindAllStringSubmatch(text, -1) {
+		day := match[1]
+		if match[2] != "" {
+			day = match[2]
+		}
+		consider(day, match[3])
+	}
+	for _, match := range monthDayRegexp.FindAllStringSubmatch(text, -1) {
+		day := match[2]
+		if match[3] != "" {
+			day = match[3]
+		}
+		consider(day, match[1])
+	}
+	if latest != nil {
+		return latest
+	}
+
+	midnight := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	switch {
+	case tomorrowRegexp.MatchString(text):
+		midnight = midnight.AddDate(0, 0, 1)
+		return &midnight
+	case todayRegexp.MatchString(text):
+		return &midnight
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+package scraper
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/igvaquero18/hermezon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func date(year int, month time.Month, day int) *time.Time {
+	d := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &d
+}
+
+func TestProduct(t *testing.T) {
+	now = func() time.Time { return time.Date(2021, time.February, 5, 18, 30, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	testCases := []struct {
+		name     string
+		body     string
+		header   http.Header
+		err      error
+		expected *Product
+	}{
+		{
+			name: "available with quantity and delivery date",
+			body: `<div id="availability"><span>Solo quedan 3 en stock.</span></div>
+				<div id="mir-layout-DELIVERY_BLOCK">Recíbelo el lunes, 8 de febrero</div>`,
+			header: make(http.Header),
+			expected: &Product{
+				Available:    true,
+				Quantity:     3,
+				DeliveryDate: date(2021, time.February, 8),
+			},
+		},
+		{
+			name: "new offer sold by amazon",
+			body: `<span id="productTitle">PlayStation 5</span><img id="landingImage" src="/ps5.jpg">
+				<div id="availability"><span>En stock.</span></div>
+				<span id="priceblock_ourprice">499,99 €</span>
+				<div id="merchant-info">Vendido y enviado por Amazon.</div>`,
+			header: make(http.Header),
+			expected: &Product{
+				Title:       "PlayStation 5",
+				Image:       "https://test.com/ps5.jpg",
+				Available:   true,
+				Price:       499.99,
+				Currency:    "EUR",
+				Seller:      "Amazon",
+				Fulfillment: FulfillmentAmazon,
+				Condition:   ConditionNew,
+			},
+		},
+		{
+			name: "used offer sold by a third-party seller",
+			body: `<div id="availability"><span>En stock.</span></div>
+				<div id="usedOnlyBuybox">Usado - Como nuevo <span id="price_inside_buybox">650,00 €</span></div>
+				<div id="merchant-info">Vendido por <a id="sellerProfileTriggerId">Reventas SL</a> y enviado por Reventas SL.</div>`,
+			header: make(http.Header),
+			expected: &Product{
+				Available:   true,
+				Price:       650,
+				Currency:    "EUR",
+				Seller:      "Reventas SL",
+				Fulfillment: FulfillmentMarketplace,
+				Condition:   ConditionUsed,
+			},
+		},
+		{
+			name: "offer with shipping costs and coupon",
+			body: `<div id="availability"><span>En stock.</span></div>
+				<span id="priceblock_ourprice">200,00 €</span>
+				<div id="mir-layout-DELIVERY_BLOCK">Entrega por 4,99 € el lunes, 8 de febrero</div>
+				<div id="vpcButton">Aplicar cupón del 10%</div>`,
+			header: make(http.Header),
+			expected: &Product{
+				Available:    true,
+				Price:        200,
+				Currency:     "EUR",
+				DeliveryDate: date(2021, time.February, 8),
+				Condition:    ConditionNew,
+				Shipping:     4.99,
+				Discount:     20,
+			},
+		},
+		{
+			name: "offer in structured data",
+			body: `<script type="application/ld+json">{"@type": "Product", "gtin13": "0711719541028",
+				"offers": {"@type": "Offer", "price": "489.90", "priceCurrency": "EUR", "availability": "https://schema.org/InStock"}}</script>`,
+			header: make(http.Header),
+			expected: &Product{
+				Available: true,
+				Price:     489.9,
+				Currency:  "EUR",
+				Condition: ConditionNew,
+				GTIN:      "0711719541028",
+			},
+		},
+		{
+			name:     "json response with price",
+			body:     `{"availability": 99.5}`,
+			header:   http.Header{"Content-Type": []string{"application/json"}},
+			expected: &Product{Available: false, Price: 99.5},
+		},
+		{
+			name:     "available without quantity nor delivery date",
+			body:     `<div id="availability"><span>En stock.</span></div>`,
+			header:   make(http.Header),
+			expected: &Product{Available: true},
+		},
+		{
+			name:     "not available",
+			body:     `<div id="availability"><span>No disponible.</span></div>`,
+			header:   make(http.Header),
+			expected: &Product{Available: false},
+		},
+		{
+			name:     "json response",
+			body:     `{"availability": "en stock."}`,
+			header:   http.Header{"Content-Type": []string{"application/json"}},
+			expected: &Product{Available: true},
+		},
+		{
+			name:   "not expected status code",
+			header: make(http.Header),
+			err:    fmt.Errorf("response status code: 500, expected: 200"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			scr := &Scraper{
+				url:                "https://test.com",
+				expectedStatusCode: http.StatusOK,
+				selector:           DefaultSelector,
+				priceSelector:      DefaultPriceSelector,
+				findText:           DefaultFindText,
+				jsonPath:           "$.availability",
+				maxRetries:         0,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client: NewTestClient(func(req *http.Request) (*http.Response, error) {
+					statusCode := http.StatusOK
+					if tc.err != nil {
+						statusCode = http.StatusInternalServerError
+					}
+					return &http.Response{
+						StatusCode: statusCode,
+						Body:       ioutil.NopCloser(bytes.NewBufferString(tc.body)),
+						Header:     tc.header,
+					}, nil
+				}),
+			}
+			actual, err := scr.Product()
+			if tc.err != nil {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+				assert.Equal(tt, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestExtractMetadata(t *testing.T) {
+	testCases := []struct {
+		name, body, title, image string
+	}{
+		{
+			name: "amazon product",
+			body: `<span id="productTitle">
+				Sony PlayStation 5
+			</span><img id="landingImage" src="data:image/gif;base64,R0lGOD" data-old-hires="https://m.media-amazon.com/images/I/ps5.jpg">`,
+			title: "Sony PlayStation 5",
+			image: "https://m.media-amazon.com/images/I/ps5.jpg",
+		},
+		{
+			name:  "open graph",
+			body:  `<head><meta property="og:title" content="iPhone 12 256GB Negro"><meta property="og:image" content="/img/iphone.jpg"><title>Store</title></head>`,
+			title: "iPhone 12 256GB Negro",
+			image: "https://store.com/img/iphone.jpg",
+		},
+		{
+			name:  "structured data",
+			body:  `<script type="application/ld+json">{"@type": "Product", "name": "Xbox Series X", "image": ["https://store.com/xbox.jpg"]}</script>`,
+			title: "Xbox Series X",
+			image: "https://store.com/xbox.jpg",
+		},
+		{
+			name:  "page title",
+			body:  `<head><title>Nintendo Switch | Store</title></head>`,
+			title: "Nintendo Switch | Store",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(bytes.NewBufferString(tc.body))
+			assert.NoError(tt, err)
+			title, image := extractMetadata(doc, "https://store.com/product/1")
+			assert.Equal(tt, tc.title, title)
+			assert.Equal(tt, tc.image, image)
+		})
+	}
+}
+
+func TestExtractMerchant(t *testing.T) {
+	testCases := []struct {
+		name, body, seller, fulfillment string
+	}{
+		{
+			name:        "sold and shipped by amazon in spanish",
+			body:        `<div id="merchant-info">Vendido y enviado por Amazon.</div>`,
+			seller:      "Amazon",
+			fulfillment: FulfillmentAmazon,
+		},
+		{
+			name:        "sold by amazon in english",
+			body:        `<div id="merchant-info">Ships from and sold by Amazon.com.</div>`,
+			seller:      "Amazon.com",
+			fulfillment: FulfillmentAmazon,
+		},
+		{
+			name:        "sold by third-party seller and fulfilled by amazon",
+			body:        `<div id="merchant-info">Vendido por <a id="sellerProfileTriggerId">Tienda X</a> y gestionado por Amazon.</div>`,
+			seller:      "Tienda X",
+			fulfillment: FulfillmentAmazon,
+		},
+		{
+			name:        "sold and shipped by third-party seller",
+			body:        `<div id="merchant-info">Sold by Gadgets Inc and shipped by Gadgets Inc.</div>`,
+			seller:      "Gadgets Inc",
+			fulfillment: FulfillmentMarketplace,
+		},
+		{
+			name: "no merchant information",
+			body: `<div id="availability">No disponible.</div>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(bytes.NewBufferString(tc.body))
+			assert.NoError(tt, err)
+			seller, fulfillment := extractMerchant(doc)
+			assert.Equal(tt, tc.seller, seller)
+			assert.Equal(tt, tc.fulfillment, fulfillment)
+		})
+	}
+}
+
+func TestExtractGTIN(t *testing.T) {
+	testCases := []struct {
+		name, body, expected string
+	}{
+		{
+			name:     "json-ld product",
+			body:     `<script type="application/ld+json">{"@context": "https://schema.org", "@type": "Product", "gtin13": "0711719541028"}</script>`,
+			expected: "0711719541028",
+		},
+		{
+			name:     "json-ld graph with nested offer",
+			body:     `<script type="application/ld+json">{"@graph": [{"@type": "WebPage"}, {"@type": "Product", "offers": {"gtin": 711719541028}}]}</script>`,
+			expected: "0711719541028",
+		},
+		{
+			name:     "microdata",
+			body:     `<div itemscope itemtype="https://schema.org/Product"><meta itemprop="gtin14" content="00711719541028"></div>`,
+			expected: "0711719541028",
+		},
+		{
+			name:     "invalid json-ld and microdata text",
+			body:     `<script type="application/ld+json">{invalid</script><span itemprop="gtin13">8 412345 678905</span>`,
+			expected: "8412345678905",
+		},
+		{
+			name:     "no structured data",
+			body:     `<div id="availability">En stock.</div>`,
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(bytes.NewBufferString(tc.body))
+			assert.NoError(tt, err)
+			assert.Equal(tt, tc.expected, extractGTIN(doc))
+		})
+	}
+}
+
+func TestExtractStructuredOffer(t *testing.T) {
+	testCases := []struct {
+		name, body string
+		expected   structuredOffer
+	}{
+		{
+			name: "offer",
+			body: `<script type="application/ld+json">{"@type": "Product", "offers": {"@type": "Offer", "price": 19.99, "priceCurrency": "eur", "availability": "http://schema.org/OutOfStock"}}</script>`,
+			expected: structuredOffer{
+				price:        19.99,
+				currency:     "EUR",
+				availability: "http://schema.org/OutOfStock",
+			},
+		},
+		{
+			name:     "aggregate offer in a list",
+			body:     `<script type="application/ld+json">[{"@type": "Product", "offers": [{"@type": "AggregateOffer", "lowPrice": "15,50"}]}]</script>`,
+			expected: structuredOffer{price: 15.5},
+		},
+		{
+			name: "no offer",
+			body: `<script type="application/ld+json">{"@type": "Organization"}</script>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(bytes.NewBufferString(tc.body))
+			assert.NoError(tt, err)
+			assert.Equal(tt, tc.expected, extractStructuredOffer(doc))
+		})
+	}
+}
+
+func TestExtractShipping(t *testing.T) {
+	testCases := []struct {
+		name, text string
+		expected   float64
+	}{
+		{name: "spanish free shipping", text: "Envío GRATIS el lunes, 8 de febrero", expected: 0},
+		{name: "english free delivery", text: "FREE delivery Monday, Feb 8", expected: 0},
+		{name: "spanish cost after keyword", text: "Entrega por 3,99 € el lunes, 8 de febrero", expected: 3.99},
+		{name: "spanish cost before keyword", text: "+ 5,49 € de gastos de envío", expected: 5.49},
+		{name: "english cost after keyword", text: "$6.99 delivery February 8 - 10", expected: 6.99},
+		{name: "unknown shipping", text: "Recíbelo el lunes, 8 de febrero", expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, extractShipping(tc.text))
+		})
+	}
+}
+
+func TestExtractDiscount(t *testing.T) {
+	testCases := []struct {
+		name, text string
+		price      float64
+		expected   float64
+	}{
+		{name: "percentage coupon", text: "Aplicar cupón del 15%", price: 80, expected: 12},
+		{name: "decimal percentage coupon", text: "Save 2,5% with coupon", price: 100, expected: 2.5},
+		{name: "amount coupon in euros", text: "Aplicar cupón de 5,00 €", price: 80, expected: 5},
+		{name: "amount coupon in dollars", text: "Save $10.00 with coupon", price: 80, expected: 10},
+		{name: "no coupon", text: "", price: 80, expected: 0},
+		{name: "no amount", text: "Ver promociones", price: 80, expected: 0},
+		{name: "number without currency", text: "1 promoción aplicable", price: 100, expected: 0},
+		{name: "percentage without coupon", text: "Valoración del 95%", price: 100, expected: 0},
+		{name: "amount coupon with symbol first", text: "Ahorra €3,50 con cupón", price: 80, expected: 3.5},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, extractDiscount(tc.text, tc.price))
+		})
+	}
+}
+
+func TestEffectivePrice(t *testing.T) {
+	testCases := []struct {
+		name     string
+		product  *Product
+		expected float64
+	}{
+		{name: "price only", product: &Product{Price: 100}, expected: 100},
+		{name: "price with shipping and discount", product: &Product{Price: 100, Shipping: 5, Discount: 10}, expected: 95},
+		{name: "discount above price", product: &Product{Price: 5, Discount: 10}, expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, tc.product.EffectivePrice())
+		})
+	}
+}
+
+func TestExtractQuantity(t *testing.T) {
+	testCases := []struct {
+		name, text string
+		expected   int
+	}{
+		{name: "spanish plural", text: "Solo quedan 3 en stock (hay más unidades en camino).", expected: 3},
+		{name: "spanish singular", text: "Solo queda 1 en stock.", expected: 1},
+		{name: "spanish units", text: "Quedan 12 unidades en stock", expected: 12},
+		{name: "english", text: "Only 2 left in stock - order soon.", expected: 2},
+		{name: "no quantity", text: "En stock.", expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, extractQuantity(tc.text))
+		})
+	}
+}
+
+func TestExtractDeliveryDate(t *testing.T) {
+	now = func() time.Time { return time.Date(2021, time.December, 28, 10, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	testCases := []struct {
+		name, text string
+		expected   *time.Time
+	}{
+		{name: "spanish date", text: "Entrega GRATIS el miércoles, 29 de diciembre", expected: date(2021, time.December, 29)},
+		{name: "spanish range", text: "Recíbelo entre el 30 de diciembre - 3 de enero", expected: date(2022, time.January, 3)},
+		{name: "spanish day range", text: "Recíbelo 30 - 31 de diciembre", expected: date(2021, time.December, 31)},
+		{name: "english month first", text: "FREE delivery Friday, Dec 31", expected: date(2021, time.December, 31)},
+		{name: "english month first range", text: "Get it Jan 3 - 5", expected: date(2022, time.January, 5)},
+		{name: "english day first", text: "FREE delivery Friday, 31 December", expected: date(2021, time.December, 31)},
+		{name: "tomorrow in spanish", text: "Recíbelo mañana", expected: date(2021, time.December, 29)},
+		{name: "today in english", text: "Get it today", expected: date(2021, time.December, 28)},
+		{name: "no date", text: "Envío gratis", expected: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, extractDeliveryDate(tc.text))
+		})
+	}
+}
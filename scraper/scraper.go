@@ -1,8 +1,11 @@
 package scraper
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -33,6 +36,8 @@ const (
 	userAgent = "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:84.0) Gecko/20100101 Firefox/84.0"
 )
 
+var priceRegexp = regexp.MustCompile(`\d+[\.\,]?\d*`)
+
 // Scraper is a struct that contains all the details for performing scraping of a store
 // website like Amazon, El Corte Ingles, Scraper, etc.
 type Scraper struct {
@@ -40,7 +45,12 @@ type Scraper struct {
 	expectedStatusCode int
 	targetPrice        float64
 	selector           string
+	priceSelector      string
 	findText           string
+	jsonPath           string
+	itemSelector       string
+	variant            string
+	variantParam       string
 	maxRetries         int8
 	retrySeconds       int8
 	client             *http.Client
@@ -57,7 +67,9 @@ func NewScraper(opts ...Option) *Scraper {
 		expectedStatusCode: http.StatusOK,
 		targetPrice:        DefaultTargetPrice,
 		selector:           DefaultSelector,
+		priceSelector:      DefaultPriceSelector,
 		findText:           DefaultFindText,
+		itemSelector:       DefaultItemSelector,
 		maxRetries:         DefaultMaxRetries,
 		retrySeconds:       DefaultRetrySeconds,
 		Logger:             &utils.DefaultLogger{},
@@ -105,6 +117,15 @@ func SetSelector(selector string) Option {
 	}
 }
 
+// SetPriceSelector Sets the CSS selector for the price of the product
+func SetPriceSelector(priceSelector string) Option {
+	return func(s *Scraper) Option {
+		prev := s.priceSelector
+		s.priceSelector = priceSelector
+		return SetPriceSelector(prev)
+	}
+}
+
 // SetFindText Sets the text to compare
 func SetFindText(findText string) Option {
 	return func(s *Scraper) Option {
@@ -114,6 +135,16 @@ func SetFindText(findText string) Option {
 	}
 }
 
+// SetJSONPath Sets the JSONPath expression used to extract the text
+// from JSON responses
+func SetJSONPath(jsonPath string) Option {
+	return func(s *Scraper) Option {
+		prev := s.jsonPath
+		s.jsonPath = jsonPath
+		return SetJSONPath(prev)
+	}
+}
+
 // SetMaxRetries Sets the text to compare
 func SetMaxRetries(maxRetries int8) Option {
 	return func(s *Scraper) Option {
@@ -143,11 +174,19 @@ func SetTargetPrice(target float64) Option {
 	}
 }
 
-func (s Scraper) getTextInSelector() (string, error) {
+// get performs a GET request against the URL of the Scraper, retrying
+// as many times as configured while the store doesn't answer with the
+// expected status code. The caller is responsible for closing the body
+// of the response.
+func (s Scraper) get() (*http.Response, error) {
 	var retries int8 = 0
-	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	productURL, err := s.ProductURL()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, productURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("error building the request: %x", err.Error())
+		return nil, fmt.Errorf("error building the request: %x", err.Error())
 	}
 	req.Header.Set("User-Agent", userAgent)
 	resp, err := s.client.Do(req)
@@ -160,11 +199,12 @@ func (s Scraper) getTextInSelector() (string, error) {
 	}
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if resp.StatusCode != s.expectedStatusCode {
 		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
 		s.Debugw(
 			"error when accessing store.",
 			"url", s.url,
@@ -174,31 +214,82 @@ func (s Scraper) getTextInSelector() (string, error) {
 			"expected_status_code", s.expectedStatusCode,
 			"response_body", string(body),
 		)
-		return "", fmt.Errorf("response status code: %d, expected: %d", resp.StatusCode, s.expectedStatusCode)
+		return nil, fmt.Errorf("response status code: %d, expected: %d", resp.StatusCode, s.expectedStatusCode)
 	}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	return resp, nil
+}
+
+func (s Scraper) getTextInSelector() (string, error) {
+	_, text, err := s.getPage()
+	return text, err
+}
+
+// getPage fetches the page of the product, returning the parsed HTML document
+// and the text found in the selector. JSON responses don't have a document, and
+// their text is the one found in the JSONPath expression of the Scraper.
+func (s Scraper) getPage() (*goquery.Document, string, error) {
+	resp, err := s.get()
 	if err != nil {
-		return "", err
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if isJSON(resp.Header.Get("Content-Type")) {
+		text, err := s.getTextInJSONPath(resp.Body)
+		return nil, text, err
 	}
 
-	err = resp.Body.Close()
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
 
 	text := doc.Find(s.selector).Text()
 	s.Debugw("found text", "url", s.url, "text", text, "selector", s.selector)
+	return doc, text, nil
+}
+
+// getTextInJSONPath decodes a JSON document and returns the text of the
+// nodes matched by the JSONPath expression of the Scraper, separated by
+// blank spaces.
+func (s Scraper) getTextInJSONPath(body io.Reader) (string, error) {
+	if s.jsonPath == "" {
+		return "", fmt.Errorf("a json path is required for json responses")
+	}
+	var doc interface{}
+	if err := json.NewDecoder(body).Decode(&doc); err != nil {
+		return "", errors.Wrap(err, "error when decoding json response")
+	}
+	nodes, err := evalJSONPath(s.jsonPath, doc)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		texts = append(texts, jsonNodeText(node))
+	}
+	text := strings.Join(texts, " ")
+	s.Debugw("found text", "url", s.url, "text", text, "json_path", s.jsonPath)
 	return text, nil
 }
 
+// isJSON returns true if the content type belongs to a JSON document
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
 // IsAvailable checks whether the product is available or not
 func (s Scraper) IsAvailable() (bool, error) {
-	text, err := s.getTextInSelector()
+	product, err := s.Product()
 	if err != nil {
 		return false, err
 	}
-	return strings.Contains(strings.TrimSpace(strings.ToLower(text)), strings.TrimSpace(strings.ToLower(s.findText))), nil
+	return product.Available, nil
 }
 
 // IsPriceBelow returns true if the price is below s.targetPrice
@@ -210,12 +301,20 @@ func (s Scraper) IsPriceBelow() (bool, error) {
 	if text == "" {
 		return false, fmt.Errorf("no price matched")
 	}
-	reg := regexp.MustCompile(`\d+[\.\,]?\d*`)
-	text = strings.ReplaceAll(reg.FindString(text), ",", ".")
-	price, err := strconv.ParseFloat(text, 64)
+	price, err := parsePrice(text)
 	if err != nil {
-		return false, errors.Wrap(err, "error when converting price from string to float")
+		return false, err
 	}
 
 	return s.targetPrice > price, nil
 }
+
+// parsePrice returns the first price found in a text
+func parsePrice(text string) (float64, error) {
+	text = strings.ReplaceAll(priceRegexp.FindString(text), ",", ".")
+	price, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "error when converting price from string to float")
+	}
+	return price, nil
+}
@@ -25,7 +25,9 @@ func TestNewScraper(t *testing.T) {
 				expectedStatusCode: http.StatusOK,
 				targetPrice:        DefaultTargetPrice,
 				selector:           DefaultSelector,
+				priceSelector:      DefaultPriceSelector,
 				findText:           DefaultFindText,
+				itemSelector:       DefaultItemSelector,
 				maxRetries:         DefaultMaxRetries,
 				retrySeconds:       DefaultRetrySeconds,
 				Logger:             &utils.DefaultLogger{},
@@ -40,7 +42,9 @@ func TestNewScraper(t *testing.T) {
 				expectedStatusCode: http.StatusOK,
 				targetPrice:        10.0,
 				selector:           DefaultSelector,
+				priceSelector:      DefaultPriceSelector,
 				findText:           DefaultFindText,
+				itemSelector:       DefaultItemSelector,
 				maxRetries:         DefaultMaxRetries,
 				retrySeconds:       DefaultRetrySeconds,
 				Logger:             &utils.DefaultLogger{},
@@ -55,7 +59,9 @@ func TestNewScraper(t *testing.T) {
 				expectedStatusCode: http.StatusCreated,
 				targetPrice:        DefaultTargetPrice,
 				selector:           DefaultSelector,
+				priceSelector:      DefaultPriceSelector,
 				findText:           DefaultFindText,
+				itemSelector:       DefaultItemSelector,
 				maxRetries:         DefaultMaxRetries,
 				retrySeconds:       DefaultRetrySeconds,
 				Logger:             &utils.DefaultLogger{},
@@ -70,7 +76,26 @@ func TestNewScraper(t *testing.T) {
 				expectedStatusCode: http.StatusOK,
 				targetPrice:        DefaultTargetPrice,
 				selector:           ".available",
+				priceSelector:      DefaultPriceSelector,
 				findText:           DefaultFindText,
+				itemSelector:       DefaultItemSelector,
+				maxRetries:         DefaultMaxRetries,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client:             new(http.Client),
+			},
+		},
+		{
+			name:    "Custom Price Selector",
+			options: []Option{SetPriceSelector(".price")},
+			expected: &Scraper{
+				url:                "",
+				expectedStatusCode: http.StatusOK,
+				targetPrice:        DefaultTargetPrice,
+				selector:           DefaultSelector,
+				priceSelector:      ".price",
+				findText:           DefaultFindText,
+				itemSelector:       DefaultItemSelector,
 				maxRetries:         DefaultMaxRetries,
 				retrySeconds:       DefaultRetrySeconds,
 				Logger:             &utils.DefaultLogger{},
@@ -85,7 +110,46 @@ func TestNewScraper(t *testing.T) {
 				expectedStatusCode: http.StatusOK,
 				targetPrice:        DefaultTargetPrice,
 				selector:           DefaultSelector,
+				priceSelector:      DefaultPriceSelector,
 				findText:           "text",
+				itemSelector:       DefaultItemSelector,
+				maxRetries:         DefaultMaxRetries,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client:             new(http.Client),
+			},
+		},
+		{
+			name:    "Custom JSON Path",
+			options: []Option{SetJSONPath("$.price")},
+			expected: &Scraper{
+				url:                "",
+				expectedStatusCode: http.StatusOK,
+				targetPrice:        DefaultTargetPrice,
+				selector:           DefaultSelector,
+				priceSelector:      DefaultPriceSelector,
+				findText:           DefaultFindText,
+				jsonPath:           "$.price",
+				itemSelector:       DefaultItemSelector,
+				maxRetries:         DefaultMaxRetries,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client:             new(http.Client),
+			},
+		},
+		{
+			name:    "Custom Variant",
+			options: []Option{SetVariant("black-256gb"), SetVariantParam("variant")},
+			expected: &Scraper{
+				url:                "",
+				expectedStatusCode: http.StatusOK,
+				targetPrice:        DefaultTargetPrice,
+				selector:           DefaultSelector,
+				priceSelector:      DefaultPriceSelector,
+				findText:           DefaultFindText,
+				itemSelector:       DefaultItemSelector,
+				variant:            "black-256gb",
+				variantParam:       "variant",
 				maxRetries:         DefaultMaxRetries,
 				retrySeconds:       DefaultRetrySeconds,
 				Logger:             &utils.DefaultLogger{},
@@ -100,7 +164,9 @@ func TestNewScraper(t *testing.T) {
 				expectedStatusCode: http.StatusOK,
 				targetPrice:        DefaultTargetPrice,
 				selector:           DefaultSelector,
+				priceSelector:      DefaultPriceSelector,
 				findText:           DefaultFindText,
+				itemSelector:       DefaultItemSelector,
 				maxRetries:         20,
 				retrySeconds:       DefaultRetrySeconds,
 				Logger:             &utils.DefaultLogger{},
@@ -115,7 +181,9 @@ func TestNewScraper(t *testing.T) {
 				expectedStatusCode: http.StatusOK,
 				targetPrice:        DefaultTargetPrice,
 				selector:           DefaultSelector,
+				priceSelector:      DefaultPriceSelector,
 				findText:           DefaultFindText,
+				itemSelector:       DefaultItemSelector,
 				maxRetries:         DefaultMaxRetries,
 				retrySeconds:       30,
 				Logger:             &utils.DefaultLogger{},
@@ -130,7 +198,9 @@ func TestNewScraper(t *testing.T) {
 				expectedStatusCode: http.StatusOK,
 				targetPrice:        DefaultTargetPrice,
 				selector:           DefaultSelector,
+				priceSelector:      DefaultPriceSelector,
 				findText:           DefaultFindText,
+				itemSelector:       DefaultItemSelector,
 				maxRetries:         DefaultMaxRetries,
 				retrySeconds:       DefaultRetrySeconds,
 				Logger:             &utils.DefaultLogger{},
@@ -145,7 +215,9 @@ func TestNewScraper(t *testing.T) {
 				expectedStatusCode: http.StatusOK,
 				targetPrice:        DefaultTargetPrice,
 				selector:           DefaultSelector,
+				priceSelector:      DefaultPriceSelector,
 				findText:           DefaultFindText,
+				itemSelector:       DefaultItemSelector,
 				maxRetries:         DefaultMaxRetries,
 				retrySeconds:       DefaultRetrySeconds,
 				Logger:             &utils.DefaultLogger{},
@@ -170,7 +242,9 @@ func TestNewScraper(t *testing.T) {
 				expectedStatusCode: http.StatusCreated,
 				targetPrice:        10,
 				selector:           ".available",
+				priceSelector:      DefaultPriceSelector,
 				findText:           "text",
+				itemSelector:       DefaultItemSelector,
 				maxRetries:         20,
 				retrySeconds:       30,
 				Logger:             &utils.DefaultLogger{},
@@ -337,6 +411,97 @@ func TestGetTextInSelector(t *testing.T) {
 			err:          fmt.Errorf("some error"),
 			expectedText: "something",
 		},
+		{
+			name: "no errors, json response and some text in json path",
+			scr: &Scraper{
+				url:                "https://test.com",
+				expectedStatusCode: http.StatusOK,
+				targetPrice:        DefaultTargetPrice,
+				selector:           DefaultSelector,
+				findText:           DefaultFindText,
+				jsonPath:           "$.product.availability",
+				maxRetries:         DefaultMaxRetries,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client: NewTestClient(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewBufferString(`{"product": {"availability": "in_stock"}}`)),
+						Header:     http.Header{"Content-Type": []string{"application/json; charset=utf-8"}},
+					}, nil
+				}),
+			},
+			err:          nil,
+			expectedText: "in_stock",
+		},
+		{
+			name: "no errors, json response and number in json path",
+			scr: &Scraper{
+				url:                "https://test.com",
+				expectedStatusCode: http.StatusOK,
+				targetPrice:        DefaultTargetPrice,
+				selector:           DefaultSelector,
+				findText:           DefaultFindText,
+				jsonPath:           "$.offers[0].price",
+				maxRetries:         DefaultMaxRetries,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client: NewTestClient(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewBufferString(`{"offers": [{"price": 99.5}, {"price": 120}]}`)),
+						Header:     http.Header{"Content-Type": []string{"application/json"}},
+					}, nil
+				}),
+			},
+			err:          nil,
+			expectedText: "99.5",
+		},
+		{
+			name: "json response without json path",
+			scr: &Scraper{
+				url:                "https://test.com",
+				expectedStatusCode: http.StatusOK,
+				targetPrice:        DefaultTargetPrice,
+				selector:           DefaultSelector,
+				findText:           DefaultFindText,
+				maxRetries:         DefaultMaxRetries,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client: NewTestClient(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewBufferString(`{"price": 99.5}`)),
+						Header:     http.Header{"Content-Type": []string{"application/json"}},
+					}, nil
+				}),
+			},
+			err:          fmt.Errorf("a json path is required for json responses"),
+			expectedText: "",
+		},
+		{
+			name: "invalid json response",
+			scr: &Scraper{
+				url:                "https://test.com",
+				expectedStatusCode: http.StatusOK,
+				targetPrice:        DefaultTargetPrice,
+				selector:           DefaultSelector,
+				findText:           DefaultFindText,
+				jsonPath:           "$.price",
+				maxRetries:         DefaultMaxRetries,
+				retrySeconds:       DefaultRetrySeconds,
+				Logger:             &utils.DefaultLogger{},
+				client: NewTestClient(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewBufferString(`<div id="price">99,5</div>`)),
+						Header:     http.Header{"Content-Type": []string{"application/json"}},
+					}, nil
+				}),
+			},
+			err:          fmt.Errorf("error when decoding json response"),
+			expectedText: "",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,77 @@
+package scraper
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultASINSelector is a default CSS selector for the input holding the
+// ASIN of the variant shown in an Amazon product page
+const DefaultASINSelector = "input#ASIN"
+
+// SetVariant Sets the variant of the product to check. It's either the
+// ASIN of the child product in Amazon, or the value of the variant query
+// parameter in other stores.
+func SetVariant(variant string) Option {
+	return func(s *Scraper) Option {
+		prev := s.variant
+		s.variant = variant
+		return SetVariant(prev)
+	}
+}
+
+// SetVariantParam Sets the name of the query parameter used by the store to
+// select a variant of the product
+func SetVariantParam(variantParam string) Option {
+	return func(s *Scraper) Option {
+		prev := s.variantParam
+		s.variantParam = variantParam
+		return SetVariantParam(prev)
+	}
+}
+
+// ProductURL returns the URL of the page of the product, pointing to its
+// variant when there's one. In Amazon, the ASIN of the product in the URL
+// is replaced with the one of the variant.
+func (s Scraper) ProductURL() (string, error) {
+	if s.variant == "" {
+		return s.url, nil
+	}
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return "", err
+	}
+	if s.variantParam != "" {
+		query := u.Query()
+		query.Set(s.variantParam, s.variant)
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+	match := amazonProductRegexp.FindStringSubmatchIndex(u.Path)
+	if match == nil || !strings.Contains(u.Host, "amazon.") {
+		return "", fmt.Errorf("unable to resolve variant %s of %s: a variant parameter is required", s.variant, s.url)
+	}
+	u.Path = fmt.Sprintf("/dp/%s", s.variant)
+	query := u.Query()
+	query.Set("th", "1")
+	query.Set("psc", "1")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// checkVariant makes sure the page shows the variant of the product that
+// was asked for, since Amazon falls back to the default variant of a product
+// when the requested one doesn't exist.
+func (s Scraper) checkVariant(doc *goquery.Document) error {
+	if s.variant == "" || s.variantParam != "" {
+		return nil
+	}
+	asin, ok := doc.Find(DefaultASINSelector).First().Attr("value")
+	if !ok || strings.EqualFold(asin, s.variant) {
+		return nil
+	}
+	return fmt.Errorf("variant %s not found, the page shows %s", s.variant, asin)
+}
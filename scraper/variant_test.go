@@ -0,0 +1,97 @@
+package scraper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProductURL(t *testing.T) {
+	testCases := []struct {
+		name, url, variant, variantParam, expected string
+		err                                        bool
+	}{
+		{
+			name:     "no variant",
+			url:      "https://www.amazon.es/Apple-iPhone-12/dp/B08L5SNWD2?ref=x",
+			expected: "https://www.amazon.es/Apple-iPhone-12/dp/B08L5SNWD2?ref=x",
+		},
+		{
+			name:     "amazon child asin",
+			url:      "https://www.amazon.es/Apple-iPhone-12/dp/B08L5SNWD2?ref=x",
+			variant:  "B08L5TNJHG",
+			expected: "https://www.amazon.es/dp/B08L5TNJHG?psc=1&ref=x&th=1",
+		},
+		{
+			name:         "variant query parameter",
+			url:          "https://store.com/iphone-12?color=white",
+			variant:      "black-256gb",
+			variantParam: "sku",
+			expected:     "https://store.com/iphone-12?color=white&sku=black-256gb",
+		},
+		{
+			name:    "non amazon store without variant parameter",
+			url:     "https://store.com/iphone-12",
+			variant: "black-256gb",
+			err:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			scr := NewScraper(SetURL(tc.url), SetVariant(tc.variant), SetVariantParam(tc.variantParam))
+			actual, err := scr.ProductURL()
+			if tc.err {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+				assert.Equal(tt, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCheckVariant(t *testing.T) {
+	testCases := []struct {
+		name, body, variant, variantParam string
+		err                               bool
+	}{
+		{
+			name:    "page shows the variant",
+			body:    `<input type="hidden" id="ASIN" value="B08L5TNJHG">`,
+			variant: "B08L5TNJHG",
+		},
+		{
+			name:    "page shows the default variant",
+			body:    `<input type="hidden" id="ASIN" value="B08L5SNWD2">`,
+			variant: "B08L5TNJHG",
+			err:     true,
+		},
+		{
+			name:    "page doesn't show the asin",
+			body:    `<div id="availability">En stock.</div>`,
+			variant: "B08L5TNJHG",
+		},
+		{
+			name:         "variant query parameter",
+			body:         `<input type="hidden" id="ASIN" value="B08L5SNWD2">`,
+			variant:      "black-256gb",
+			variantParam: "sku",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(bytes.NewBufferString(tc.body))
+			assert.NoError(tt, err)
+			scr := NewScraper(SetVariant(tc.variant), SetVariantParam(tc.variantParam))
+			if err = scr.checkVariant(doc); tc.err {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+			}
+		})
+	}
+}
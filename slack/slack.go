@@ -0,0 +1,188 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/utils"
+)
+
+// Client is a struct that implicitly implements the Messenger interface
+// for posting messages to Slack incoming webhooks, whose URL is the
+// destination
+type Client struct {
+	client *http.Client
+	utils.Logger
+}
+
+// Option is a function to apply settings to Client structure
+type Option func(c *Client) Option
+
+// NewClient returns a new Client
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		client: &http.Client{Timeout: 10 * time.Second},
+		Logger: &utils.DefaultLogger{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetHTTPClient Sets the HTTP client for Client
+func SetHTTPClient(client *http.Client) Option {
+	return func(c *Client) Option {
+		prev := c.client
+		c.client = client
+		return SetHTTPClient(prev)
+	}
+}
+
+// SetLogger Sets the Logger for Client
+func SetLogger(logger utils.Logger) Option {
+	return func(c *Client) Option {
+		prev := c.Logger
+		c.Logger = logger
+		return SetLogger(prev)
+	}
+}
+
+// message is the payload of an incoming webhook
+type message struct {
+	Text   string  `json:"text"`
+	Blocks []block `json:"blocks,omitempty"`
+}
+
+// block is a layout block of a message
+type block struct {
+	Type      string   `json:"type"`
+	Text      *text    `json:"text,omitempty"`
+	Accessory *element `json:"accessory,omitempty"`
+	// Elements are texts in context blocks, and buttons in actions blocks
+	Elements []interface{} `json:"elements,omitempty"`
+}
+
+// text is a text object of a block
+type text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// element is an interactive or image element of a block
+type element struct {
+	Type     string `json:"type"`
+	Text     *text  `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	AltText  string `json:"alt_text,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+const (
+	// maxButtons is the maximum number of link buttons of a message
+	maxButtons = 5
+	// maxHeaderLength is the maximum length of the text of a header block
+	maxHeaderLength = 150
+	// maxSectionLength is the maximum length of the text of a section block
+	maxSectionLength = 3000
+)
+
+// Send posts a notification to the incoming webhook at its recipient, as a
+// message with its title, price, image and buttons for its links
+func (c *Client) Send(n *notification.Notification) error {
+	c.Debugw("sending message to Slack", "event", n.Event)
+	payload, err := json.Marshal(newMessage(n))
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Post(n.Recipient, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Slack response status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// newMessage builds the message of a notification
+func newMessage(n *notification.Notification) *message {
+	msg := &message{
+		Text: n.Title,
+		Blocks: []block{
+			{Type: "header", Text: &text{Type: "plain_text", Text: truncate(n.Title, maxHeaderLength)}},
+		},
+	}
+
+	section := block{Type: "section", Text: &text{Type: "mrkdwn", Text: truncate(escape(n.Message), maxSectionLength)}}
+	if n.Image != "" {
+		section.Accessory = &element{Type: "image", ImageURL: n.Image, AltText: altText(n)}
+	}
+	msg.Blocks = append(msg.Blocks, section)
+
+	if price := price(n); price != "" {
+		msg.Blocks = append(msg.Blocks, block{
+			Type:     "context",
+			Elements: []interface{}{&text{Type: "mrkdwn", Text: price}},
+		})
+	}
+
+	buttons := []interface{}{}
+	for _, link := range n.Links {
+		if len(buttons) == maxButtons {
+			break
+		}
+		buttons = append(buttons, &element{
+			Type: "button",
+			Text: &text{Type: "plain_text", Text: truncate(link.Label, 75)},
+			URL:  link.URL,
+		})
+	}
+	if len(buttons) > 0 {
+		msg.Blocks = append(msg.Blocks, block{Type: "actions", Elements: buttons})
+	}
+	return msg
+}
+
+// price returns the new price of the notification in bold, after the old
+// one struck through when it was higher
+func price(n *notification.Notification) string {
+	if n.NewPrice == 0 {
+		return ""
+	}
+	price := fmt.Sprintf("*%s*", n.Price())
+	if n.OldPrice > n.NewPrice {
+		price = fmt.Sprintf("~%.2f~ %s", n.OldPrice, price)
+	}
+	return price
+}
+
+// altText returns the alternative text of the image of the product
+func altText(n *notification.Notification) string {
+	if n.Product != nil && n.Product.Title != "" {
+		return n.Product.Title
+	}
+	return n.Title
+}
+
+// escape escapes the control characters of Slack mrkdwn
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// truncate truncates a string to a maximum number of runes
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,88 @@
+package slack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSend(t *testing.T) {
+	testCases := []struct {
+		name     string
+		n        *notification.Notification
+		status   int
+		expected string
+		err      bool
+	}{
+		{
+			name: "price drop with image",
+			n: &notification.Notification{
+				Event:    "price",
+				Title:    "Product is below desired price!",
+				Message:  "PlayStation 5\nURL: https://www.amazon.es/dp/B08KKJ37F7",
+				Product:  &scraper.Product{Title: "PlayStation 5"},
+				URL:      "https://www.amazon.es/dp/B08KKJ37F7",
+				Image:    "https://m.media-amazon.com/images/I/ps5.jpg",
+				OldPrice: 499.99,
+				NewPrice: 449.99,
+				Currency: "EUR",
+				Links:    []notification.Link{{Label: "PlayStation 5", URL: "https://www.amazon.es/dp/B08KKJ37F7"}},
+			},
+			status: http.StatusOK,
+			expected: `{"text":"Product is below desired price!","blocks":[` +
+				`{"type":"header","text":{"type":"plain_text","text":"Product is below desired price!"}},` +
+				`{"type":"section","text":{"type":"mrkdwn","text":"PlayStation 5\nURL: https://www.amazon.es/dp/B08KKJ37F7"},"accessory":{"type":"image","image_url":"https://m.media-amazon.com/images/I/ps5.jpg","alt_text":"PlayStation 5"}},` +
+				`{"type":"context","elements":[{"type":"mrkdwn","text":"~499.99~ *449.99 EUR*"}]},` +
+				`{"type":"actions","elements":[{"type":"button","text":{"type":"plain_text","text":"PlayStation 5"},"url":"https://www.amazon.es/dp/B08KKJ37F7"}]}]}`,
+		},
+		{
+			name:   "plain message",
+			n:      &notification.Notification{Title: "Title", Message: "<Body> & more"},
+			status: http.StatusOK,
+			expected: `{"text":"Title","blocks":[` +
+				`{"type":"header","text":{"type":"plain_text","text":"Title"}},` +
+				`{"type":"section","text":{"type":"mrkdwn","text":"&lt;Body&gt; &amp; more"}}]}`,
+		},
+		{
+			name:   "long message",
+			n:      &notification.Notification{Title: strings.Repeat("t", 200), Message: strings.Repeat("m", 3100)},
+			status: http.StatusOK,
+			expected: `{"text":"` + strings.Repeat("t", 200) + `","blocks":[` +
+				`{"type":"header","text":{"type":"plain_text","text":"` + strings.Repeat("t", 149) + `…"}},` +
+				`{"type":"section","text":{"type":"mrkdwn","text":"` + strings.Repeat("m", 2999) + `…"}}]}`,
+		},
+		{
+			name:   "invalid webhook",
+			n:      &notification.Notification{Title: "Title", Message: "Body"},
+			status: http.StatusNotFound,
+			err:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			var received json.RawMessage
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(tt, "application/json", r.Header.Get("Content-Type"))
+				assert.NoError(tt, json.NewDecoder(r.Body).Decode(&received))
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+
+			tc.n.Recipient = ts.URL
+			err := NewClient().Send(tc.n)
+			if tc.err {
+				assert.Error(tt, err)
+				return
+			}
+			assert.NoError(tt, err)
+			assert.JSONEq(tt, tc.expected, string(received))
+		})
+	}
+}
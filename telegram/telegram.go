@@ -3,6 +3,7 @@ package telegram
 import (
 	"strconv"
 
+	"github.com/igvaquero18/hermezon/notification"
 	"github.com/igvaquero18/hermezon/utils"
 	"github.com/igvaquero18/telegram-notifier/telegram"
 )
@@ -30,11 +31,11 @@ func NewClient(telegramToken string, logger utils.Logger) (*Client, error) {
 	return &Client{t}, nil
 }
 
-// SendMessage creates a new Telegram Client and sends a message
-func (c *Client) SendMessage(title, body, from, dest string) error {
-	intDest, err := strconv.ParseInt(dest, 10, 64)
+// Send sends a notification to the chat whose ID is its recipient
+func (c *Client) Send(n *notification.Notification) error {
+	intDest, err := strconv.ParseInt(n.Recipient, 10, 64)
 	if err != nil {
 		return err
 	}
-	return c.SendNotification(title, body, []int64{intDest})
+	return c.SendNotification(n.Title, n.Message, []int64{intDest})
 }
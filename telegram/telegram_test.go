@@ -5,11 +5,12 @@ import (
 	"testing"
 
 	"github.com/golang/mock/gomock"
+	"github.com/igvaquero18/hermezon/notification"
 	mock_telegram "github.com/igvaquero18/hermezon/telegram/mock_telegram"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestSendMessage(t *testing.T) {
+func TestSend(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -24,15 +25,14 @@ func TestSendMessage(t *testing.T) {
 	cl := &Client{tel}
 
 	testCases := []struct {
-		name, title, body, from, dest string
-		client                        *Client
-		err                           error
+		name, title, body, dest string
+		client                  *Client
+		err                     error
 	}{
 		{
 			name:   "normal message to proper destination",
 			title:  "Hello",
 			body:   "World",
-			from:   "",
 			dest:   "20",
 			client: cl,
 		},
@@ -40,7 +40,6 @@ func TestSendMessage(t *testing.T) {
 			name:   "message without title to proper destination",
 			title:  "",
 			body:   "World",
-			from:   "",
 			dest:   "20",
 			client: cl,
 		},
@@ -48,7 +47,6 @@ func TestSendMessage(t *testing.T) {
 			name:   "totally empty message to proper destination",
 			title:  "",
 			body:   "",
-			from:   "",
 			dest:   "20",
 			client: cl,
 		},
@@ -56,7 +54,6 @@ func TestSendMessage(t *testing.T) {
 			name:   "normal message to invalid destination",
 			title:  "Hello",
 			body:   "World",
-			from:   "",
 			dest:   "2A0",
 			client: cl,
 			err:    errors.New("An error"),
@@ -65,7 +62,7 @@ func TestSendMessage(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(tt *testing.T) {
-			err := tc.client.SendMessage(tc.title, tc.body, tc.from, tc.dest)
+			err := tc.client.Send(&notification.Notification{Recipient: tc.dest, Title: tc.title, Message: tc.body})
 			if tc.err != nil {
 				assert.Error(tt, err)
 			} else {
@@ -0,0 +1,111 @@
+package templates
+
+// defaultTemplates are the built-in templates, by locale and name
+var defaultTemplates = map[string]map[string]string{
+	"en": {
+		commonTemplate: `
+{{define "header"}}{{with .Product}}{{with .Title}}{{.}}
+{{end}}{{end}}{{end}}
+{{define "facts"}}{{with .Product}}{{if .Price}}Price: {{amount .Price .Currency}}
+{{end}}{{if .Quantity}}Units left: {{.Quantity}}
+{{end}}{{with .DeliveryDate}}Delivery: {{.Format "2006-01-02"}}
+{{end}}{{end}}URL: {{.URL}}
+{{with .Product}}{{with .Image}}Image: {{.}}
+{{end}}{{end}}{{end}}
+`,
+		EventPrice: `
+{{define "title"}}Product is below desired price!{{end}}
+{{define "body"}}{{template "header" .}}Desired price: {{.DesiredPrice}}
+{{if ne .ComparedPrice .Product.Price}}Compared price: {{amount .ComparedPrice .Currency}}
+{{end}}{{template "facts" .}}{{end}}
+`,
+		EventAvailability: `
+{{define "title"}}Product is available!{{end}}
+{{define "body"}}{{template "header" .}}{{template "facts" .}}{{end}}
+`,
+		EventListing: `
+{{define "title"}}New products found!{{end}}
+{{define "body"}}Listing: {{.URL}}
+{{range .Items}}- {{.Title}}{{if .Price}} ({{amount .Price ""}}){{end}}
+  {{.URL}}
+{{end}}{{end}}
+`,
+		EventComparison: `
+{{define "title"}}Cheapest offer for {{.Name}}!{{end}}
+{{define "body"}}{{template "header" .}}Store: {{.Store}}
+{{template "facts" .}}
+Offers:
+{{range .Offers}}- {{.Store}}: {{amount .Price ""}}
+{{end}}{{end}}
+`,
+		EventDigest: `
+{{define "title"}}Your {{.Period}} digest{{end}}
+{{define "body"}}{{range .Changes}}- {{if eq .Kind "price_change"}}{{.Title}}: {{amount .OldPrice .Currency}} -> {{amount .NewPrice .Currency}}
+{{- else if eq .Kind "new_low"}}{{.Title}}: lowest price ever, {{amount .NewPrice .Currency}}
+{{- else if eq .Kind "sold_out"}}{{.Title}} is sold out
+{{- else if eq .Kind "availability"}}{{.Title}} is available
+{{- else if eq .Kind "price"}}{{.Title}}: below the desired price, {{amount .NewPrice .Currency}}
+{{- else if eq .Kind "comparison"}}{{.Title}}: cheapest offer, {{amount .NewPrice .Currency}}
+{{- else}}{{.Title}}{{end}}
+  {{.URL}}
+{{end}}{{end}}
+`,
+		EventVerification: `
+{{define "title"}}Your verification code{{end}}
+{{define "body"}}Your Hermezon verification code is {{.Code}}. If you didn't ask for it, you can ignore this message.{{end}}
+`,
+	},
+	"es": {
+		commonTemplate: `
+{{define "header"}}{{with .Product}}{{with .Title}}{{.}}
+{{end}}{{end}}{{end}}
+{{define "facts"}}{{with .Product}}{{if .Price}}Precio: {{amount .Price .Currency}}
+{{end}}{{if .Quantity}}Unidades restantes: {{.Quantity}}
+{{end}}{{with .DeliveryDate}}Entrega: {{.Format "02/01/2006"}}
+{{end}}{{end}}URL: {{.URL}}
+{{with .Product}}{{with .Image}}Imagen: {{.}}
+{{end}}{{end}}{{end}}
+`,
+		EventPrice: `
+{{define "title"}}¡El producto está por debajo del precio deseado!{{end}}
+{{define "body"}}{{template "header" .}}Precio deseado: {{.DesiredPrice}}
+{{if ne .ComparedPrice .Product.Price}}Precio comparado: {{amount .ComparedPrice .Currency}}
+{{end}}{{template "facts" .}}{{end}}
+`,
+		EventAvailability: `
+{{define "title"}}¡El producto está disponible!{{end}}
+{{define "body"}}{{template "header" .}}{{template "facts" .}}{{end}}
+`,
+		EventListing: `
+{{define "title"}}¡Nuevos productos encontrados!{{end}}
+{{define "body"}}Listado: {{.URL}}
+{{range .Items}}- {{.Title}}{{if .Price}} ({{amount .Price ""}}){{end}}
+  {{.URL}}
+{{end}}{{end}}
+`,
+		EventComparison: `
+{{define "title"}}¡Oferta más barata de {{.Name}}!{{end}}
+{{define "body"}}{{template "header" .}}Tienda: {{.Store}}
+{{template "facts" .}}
+Ofertas:
+{{range .Offers}}- {{.Store}}: {{amount .Price ""}}
+{{end}}{{end}}
+`,
+		EventDigest: `
+{{define "title"}}Tu resumen {{if eq .Period "weekly"}}semanal{{else}}diario{{end}}{{end}}
+{{define "body"}}{{range .Changes}}- {{if eq .Kind "price_change"}}{{.Title}}: {{amount .OldPrice .Currency}} -> {{amount .NewPrice .Currency}}
+{{- else if eq .Kind "new_low"}}{{.Title}}: precio más bajo, {{amount .NewPrice .Currency}}
+{{- else if eq .Kind "sold_out"}}{{.Title}} está agotado
+{{- else if eq .Kind "availability"}}{{.Title}} está disponible
+{{- else if eq .Kind "price"}}{{.Title}}: por debajo del precio deseado, {{amount .NewPrice .Currency}}
+{{- else if eq .Kind "comparison"}}{{.Title}}: oferta más barata, {{amount .NewPrice .Currency}}
+{{- else}}{{.Title}}{{end}}
+  {{.URL}}
+{{end}}{{end}}
+`,
+		EventVerification: `
+{{define "title"}}Tu código de verificación{{end}}
+{{define "body"}}Tu código de verificación de Hermezon es {{.Code}}. Si no lo has pedido, puedes ignorar este mensaje.{{end}}
+`,
+	},
+}
@@ -0,0 +1,250 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/igvaquero18/hermezon/utils"
+)
+
+const (
+	// EventPrice is the event of a product whose price dropped below the
+	// target price
+	EventPrice = "price"
+	// EventAvailability is the event of a product that became available
+	EventAvailability = "availability"
+	// EventListing is the event of new products found in a listing
+	EventListing = "listing"
+	// EventComparison is the event of a new cheapest offer in a product group
+	EventComparison = "comparison"
+	// EventDigest is the event of the periodic summary of the changes of the
+	// products tracked in digest mode
+	EventDigest = "digest"
+	// EventVerification is the event of the one-time code sent to verify a
+	// destination
+	EventVerification = "verification"
+
+	// ChangePrice is the change of the price of a product in a digest
+	ChangePrice = "price_change"
+	// ChangeNewLow is the change of a product reaching its lowest price in a
+	// digest
+	ChangeNewLow = "new_low"
+	// ChangeSoldOut is the change of a product being sold out in a digest.
+	// Products becoming available are EventAvailability changes.
+	ChangeSoldOut = "sold_out"
+
+	// DefaultLocale is the locale used when there are no templates for the
+	// locale of a customer
+	DefaultLocale = "en"
+
+	// commonTemplate is the name of the file with the templates shared by
+	// every event of a locale
+	commonTemplate = "common"
+	// extension is the extension of the template files
+	extension = ".tmpl"
+)
+
+// Data is the data available to the templates of a notification
+type Data struct {
+	// Name of the product group
+	Name    string
+	Product *scraper.Product
+	// URL of the product, or of the listing for listing events
+	URL           string
+	Store         string
+	DesiredPrice  string
+	ComparedPrice float64
+	// OldPrice is the price of the product in the previous check
+	OldPrice float64
+	Currency string
+	Items    []scraper.Item
+	Offers   []Offer
+	// Tracking is the action or group which triggered the notification
+	Tracking interface{}
+	// Priority of the notification, from 1 (min) to 5 (max), or 0 for the
+	// default priority of the event
+	Priority int
+	// Tags of the action or group, shown instead of the ones of the event
+	// by the messengers supporting them
+	Tags []string
+	// Period of digests, either "daily" or "weekly"
+	Period string
+	// Changes summarized in digests
+	Changes []Change
+	// Code sent to verify a destination
+	Code string
+}
+
+// Change is a change of a tracked product summarized in a digest. Its kind
+// is either one of the Change constants or the event of a notification that
+// was added to the digest instead of being sent.
+type Change struct {
+	Kind string `json:"kind"`
+	// Title of the product, or of the notification when it's unknown
+	Title    string    `json:"title"`
+	URL      string    `json:"url"`
+	OldPrice float64   `json:"old_price,omitempty"`
+	NewPrice float64   `json:"new_price,omitempty"`
+	Currency string    `json:"currency,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// Offer is the offer of a product group in one of its stores
+type Offer struct {
+	Store string
+	Price float64
+}
+
+// Renderer renders the title and body of notifications from text/template
+// templates. Every template defines a "title" and a "body" template, and can
+// use the ones defined in the common file of its locale.
+type Renderer struct {
+	dir           string
+	defaultLocale string
+	utils.Logger
+}
+
+// Option is a function to apply settings to Renderer structure
+type Option func(r *Renderer) Option
+
+// NewRenderer returns a new Renderer which uses the built-in templates, in
+// English and Spanish
+func NewRenderer(opts ...Option) *Renderer {
+	r := &Renderer{
+		defaultLocale: DefaultLocale,
+		Logger:        &utils.DefaultLogger{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// SetDirectory Sets the directory with the templates overriding the built-in
+// ones, laid out as <dir>/<locale>/<event>.tmpl
+func SetDirectory(dir string) Option {
+	return func(r *Renderer) Option {
+		prev := r.dir
+		r.dir = dir
+		return SetDirectory(prev)
+	}
+}
+
+// SetDefaultLocale Sets the locale used when there are no templates for the
+// locale of a customer
+func SetDefaultLocale(locale string) Option {
+	return func(r *Renderer) Option {
+		prev := r.defaultLocale
+		r.defaultLocale = locale
+		return SetDefaultLocale(prev)
+	}
+}
+
+// SetLogger Sets the Logger for Renderer
+func SetLogger(logger utils.Logger) Option {
+	return func(r *Renderer) Option {
+		prev := r.Logger
+		r.Logger = logger
+		return SetLogger(prev)
+	}
+}
+
+// Render renders the title and body of the notification of an event in the
+// given locale. Locales like "es-ES" fall back to their language, and then
+// to the default locale of the Renderer.
+func (r *Renderer) Render(event, locale string, data *Data) (string, string, error) {
+	for _, candidate := range r.candidates(locale) {
+		text, found, err := r.load(candidate, event)
+		if err != nil {
+			return "", "", err
+		}
+		if !found {
+			continue
+		}
+		common, _, err := r.load(candidate, commonTemplate)
+		if err != nil {
+			return "", "", err
+		}
+		r.Debugw("rendering notification", "event", event, "locale", candidate)
+		return render(fmt.Sprintf("%s/%s", candidate, event), candidate, common+text, data)
+	}
+	return "", "", fmt.Errorf("no templates for event %s in locale %s", event, locale)
+}
+
+// candidates returns the locales whose templates are looked up, in order,
+// for a locale
+func (r *Renderer) candidates(locale string) []string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	candidates := []string{}
+	if locale != "" {
+		candidates = append(candidates, locale)
+		if i := strings.Index(locale, "-"); i > 0 {
+			candidates = append(candidates, locale[:i])
+		}
+	}
+	return append(candidates, strings.ToLower(r.defaultLocale))
+}
+
+// load returns the text of a template of a locale, from the directory of the
+// Renderer if it's there, or from the built-in templates otherwise
+func (r *Renderer) load(locale, name string) (string, bool, error) {
+	if r.dir != "" {
+		content, err := ioutil.ReadFile(filepath.Join(r.dir, locale, name+extension))
+		if err == nil {
+			return string(content), true, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", false, err
+		}
+	}
+	text, found := defaultTemplates[locale][name]
+	return text, found, nil
+}
+
+// render executes the title and body templates of a template text
+func render(name, locale, text string, data *Data) (string, string, error) {
+	tmpl, err := template.New(name).Funcs(funcs(locale)).Parse(text)
+	if err != nil {
+		return "", "", err
+	}
+	results := []string{}
+	for _, part := range []string{"title", "body"} {
+		var buf bytes.Buffer
+		if err = tmpl.ExecuteTemplate(&buf, part, data); err != nil {
+			return "", "", err
+		}
+		results = append(results, strings.TrimSpace(buf.String()))
+	}
+	return results[0], results[1], nil
+}
+
+// funcs returns the functions available to the templates of a locale
+func funcs(locale string) template.FuncMap {
+	return template.FuncMap{
+		// amount formats an amount with two decimals and its currency,
+		// using the decimal separator of the locale
+		"amount": func(amount float64, currency string) string {
+			text := fmt.Sprintf("%.2f", amount)
+			if decimalCommas[strings.SplitN(locale, "-", 2)[0]] {
+				text = strings.Replace(text, ".", ",", 1)
+			}
+			return strings.TrimSpace(fmt.Sprintf("%s %s", text, currency))
+		},
+	}
+}
+
+// decimalCommas are the languages using a comma as decimal separator
+var decimalCommas = map[string]bool{
+	"es": true,
+	"de": true,
+	"fr": true,
+	"it": true,
+	"pt": true,
+}
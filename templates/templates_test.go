@@ -0,0 +1,267 @@
+package templates
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	delivery := time.Date(2021, time.February, 8, 0, 0, 0, 0, time.UTC)
+	product := &scraper.Product{
+		Title:        "PlayStation 5",
+		Image:        "https://m.media-amazon.com/images/I/ps5.jpg",
+		Available:    true,
+		Price:        499.99,
+		Currency:     "EUR",
+		Quantity:     3,
+		DeliveryDate: &delivery,
+	}
+
+	testCases := []struct {
+		name, event, locale, title, body string
+		data                             *Data
+		err                              bool
+	}{
+		{
+			name:   "availability in english",
+			event:  EventAvailability,
+			locale: "en",
+			data:   &Data{Product: product, URL: "https://www.amazon.es/dp/B08KKJ37F7"},
+			title:  "Product is available!",
+			body:   "PlayStation 5\nPrice: 499.99 EUR\nUnits left: 3\nDelivery: 2021-02-08\nURL: https://www.amazon.es/dp/B08KKJ37F7\nImage: https://m.media-amazon.com/images/I/ps5.jpg",
+		},
+		{
+			name:   "availability in spanish",
+			event:  EventAvailability,
+			locale: "es",
+			data:   &Data{Product: product, URL: "https://www.amazon.es/dp/B08KKJ37F7"},
+			title:  "¡El producto está disponible!",
+			body:   "PlayStation 5\nPrecio: 499,99 EUR\nUnidades restantes: 3\nEntrega: 08/02/2021\nURL: https://www.amazon.es/dp/B08KKJ37F7\nImagen: https://m.media-amazon.com/images/I/ps5.jpg",
+		},
+		{
+			name:   "price with compared price",
+			event:  EventPrice,
+			locale: "en",
+			data: &Data{
+				Product:       &scraper.Product{Price: 20, Currency: "GBP"},
+				URL:           "https://www.amazon.co.uk/dp/B08KKJ37F7",
+				DesiredPrice:  "25 EUR",
+				ComparedPrice: 23.2,
+				Currency:      "EUR",
+			},
+			title: "Product is below desired price!",
+			body:  "Desired price: 25 EUR\nCompared price: 23.20 EUR\nPrice: 20.00 GBP\nURL: https://www.amazon.co.uk/dp/B08KKJ37F7",
+		},
+		{
+			name:   "price without compared price",
+			event:  EventPrice,
+			locale: "en",
+			data: &Data{
+				Product:       &scraper.Product{Price: 20},
+				URL:           "https://www.amazon.es/dp/B08KKJ37F7",
+				DesiredPrice:  "25",
+				ComparedPrice: 20,
+			},
+			title: "Product is below desired price!",
+			body:  "Desired price: 25\nPrice: 20.00\nURL: https://www.amazon.es/dp/B08KKJ37F7",
+		},
+		{
+			name:   "listing",
+			event:  EventListing,
+			locale: "en",
+			data: &Data{
+				URL: "https://www.amazon.es/s?k=ps5",
+				Items: []scraper.Item{
+					{URL: "https://www.amazon.es/dp/B08KKJ37F7", Title: "PlayStation 5", Price: 499.99},
+					{URL: "https://www.amazon.es/dp/B08H93ZRK9", Title: "Xbox Series X"},
+				},
+			},
+			title: "New products found!",
+			body:  "Listing: https://www.amazon.es/s?k=ps5\n- PlayStation 5 (499.99)\n  https://www.amazon.es/dp/B08KKJ37F7\n- Xbox Series X\n  https://www.amazon.es/dp/B08H93ZRK9",
+		},
+		{
+			name:   "comparison",
+			event:  EventComparison,
+			locale: "en",
+			data: &Data{
+				Name:    "PS5",
+				Product: &scraper.Product{Title: "PlayStation 5", Price: 479},
+				URL:     "https://www.pccomponentes.com/ps5",
+				Store:   "pccomponentes.com",
+				Offers: []Offer{
+					{Store: "amazon.es", Price: 499.99},
+					{Store: "pccomponentes.com", Price: 479},
+				},
+			},
+			title: "Cheapest offer for PS5!",
+			body:  "PlayStation 5\nStore: pccomponentes.com\nPrice: 479.00\nURL: https://www.pccomponentes.com/ps5\n\nOffers:\n- amazon.es: 499.99\n- pccomponentes.com: 479.00",
+		},
+		{
+			name:   "digest",
+			event:  EventDigest,
+			locale: "en",
+			data: &Data{
+				Period: "daily",
+				Changes: []Change{
+					{Kind: ChangePrice, Title: "PlayStation 5", URL: "https://www.amazon.es/dp/B08KKJ37F7", OldPrice: 499.99, NewPrice: 479, Currency: "EUR"},
+					{Kind: ChangeNewLow, Title: "PlayStation 5", URL: "https://www.amazon.es/dp/B08KKJ37F7", NewPrice: 479, Currency: "EUR"},
+					{Kind: ChangeSoldOut, Title: "Xbox Series X", URL: "https://www.amazon.es/dp/B08H93ZRK9"},
+					{Kind: EventPrice, Title: "Nintendo Switch", URL: "https://www.amazon.es/dp/B07W4DGC27", NewPrice: 269.9, Currency: "EUR"},
+					{Kind: EventListing, Title: "New products found!", URL: "https://www.amazon.es/s?k=ps5"},
+				},
+			},
+			title: "Your daily digest",
+			body: "- PlayStation 5: 499.99 EUR -> 479.00 EUR\n  https://www.amazon.es/dp/B08KKJ37F7\n" +
+				"- PlayStation 5: lowest price ever, 479.00 EUR\n  https://www.amazon.es/dp/B08KKJ37F7\n" +
+				"- Xbox Series X is sold out\n  https://www.amazon.es/dp/B08H93ZRK9\n" +
+				"- Nintendo Switch: below the desired price, 269.90 EUR\n  https://www.amazon.es/dp/B07W4DGC27\n" +
+				"- New products found!\n  https://www.amazon.es/s?k=ps5",
+		},
+		{
+			name:   "weekly digest in spanish",
+			event:  EventDigest,
+			locale: "es",
+			data: &Data{
+				Period:  "weekly",
+				Changes: []Change{{Kind: EventAvailability, Title: "PlayStation 5", URL: "https://www.amazon.es/dp/B08KKJ37F7"}},
+			},
+			title: "Tu resumen semanal",
+			body:  "- PlayStation 5 está disponible\n  https://www.amazon.es/dp/B08KKJ37F7",
+		},
+		{
+			name:   "verification",
+			event:  EventVerification,
+			locale: "en",
+			data:   &Data{Code: "042137"},
+			title:  "Your verification code",
+			body:   "Your Hermezon verification code is 042137. If you didn't ask for it, you can ignore this message.",
+		},
+		{
+			name:   "verification in spanish",
+			event:  EventVerification,
+			locale: "es",
+			data:   &Data{Code: "042137"},
+			title:  "Tu código de verificación",
+			body:   "Tu código de verificación de Hermezon es 042137. Si no lo has pedido, puedes ignorar este mensaje.",
+		},
+		{
+			name:   "regional locale falls back to its language",
+			event:  EventAvailability,
+			locale: "es_ES",
+			data:   &Data{Product: &scraper.Product{}, URL: "https://www.amazon.es/dp/B08KKJ37F7"},
+			title:  "¡El producto está disponible!",
+			body:   "URL: https://www.amazon.es/dp/B08KKJ37F7",
+		},
+		{
+			name:   "unknown locale falls back to the default one",
+			event:  EventAvailability,
+			locale: "ja",
+			data:   &Data{Product: &scraper.Product{}, URL: "https://www.amazon.es/dp/B08KKJ37F7"},
+			title:  "Product is available!",
+			body:   "URL: https://www.amazon.es/dp/B08KKJ37F7",
+		},
+		{
+			name:   "unknown event",
+			event:  "unknown",
+			locale: "en",
+			data:   &Data{},
+			err:    true,
+		},
+	}
+
+	r := NewRenderer()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			title, body, err := r.Render(tc.event, tc.locale, tc.data)
+			if tc.err {
+				assert.Error(tt, err)
+				return
+			}
+			assert.NoError(tt, err)
+			assert.Equal(tt, tc.title, title)
+			assert.Equal(tt, tc.body, body)
+		})
+	}
+}
+
+func TestRenderOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		filepath.Join("en", "availability.tmpl"): `{{define "title"}}In stock{{end}}{{define "body"}}{{template "header" .}}{{.URL}}{{end}}`,
+		filepath.Join("fr", "common.tmpl"):       `{{define "link"}}Lien : {{.URL}}{{end}}`,
+		filepath.Join("fr", "availability.tmpl"): `{{define "title"}}Produit disponible !{{end}}{{define "body"}}{{template "link" .}}{{end}}`,
+		filepath.Join("it", "availability.tmpl"): `{{define "title"}}{{.Missing}}{{end}}{{define "body"}}{{end}}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name, event, locale, title, body string
+		err                              bool
+	}{
+		{
+			name:   "overridden template with built-in common templates",
+			event:  EventAvailability,
+			locale: "en",
+			title:  "In stock",
+			body:   "PlayStation 5\nhttps://www.amazon.fr/dp/B08KKJ37F7",
+		},
+		{
+			name:   "new locale",
+			event:  EventAvailability,
+			locale: "fr-FR",
+			title:  "Produit disponible !",
+			body:   "Lien : https://www.amazon.fr/dp/B08KKJ37F7",
+		},
+		{
+			name:   "template not overridden",
+			event:  EventPrice,
+			locale: "fr",
+			title:  "Product is below desired price!",
+			body:   "PlayStation 5\nDesired price: 500\nURL: https://www.amazon.fr/dp/B08KKJ37F7",
+		},
+		{
+			name:   "invalid template",
+			event:  EventAvailability,
+			locale: "it",
+			err:    true,
+		},
+	}
+
+	r := NewRenderer(SetDirectory(dir))
+	data := &Data{
+		Product:      &scraper.Product{Title: "PlayStation 5"},
+		URL:          "https://www.amazon.fr/dp/B08KKJ37F7",
+		DesiredPrice: "500",
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			title, body, err := r.Render(tc.event, tc.locale, data)
+			if tc.err {
+				assert.Error(tt, err)
+				return
+			}
+			assert.NoError(tt, err)
+			assert.Equal(tt, tc.title, title)
+			assert.Equal(tt, tc.body, body)
+		})
+	}
+}
@@ -53,3 +53,35 @@ func (mr *MockNotifierMockRecorder) SendSMS(arg0, arg1, arg2, arg3, arg4 interfa
 	varargs := append([]interface{}{arg0, arg1, arg2, arg3, arg4}, arg5...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendSMS", reflect.TypeOf((*MockNotifier)(nil).SendSMS), varargs...)
 }
+
+// SendWhatsApp mocks base method
+func (m *MockNotifier) SendWhatsApp(arg0, arg1, arg2, arg3, arg4 string) (*gotwilio.SmsResponse, *gotwilio.Exception, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendWhatsApp", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*gotwilio.SmsResponse)
+	ret1, _ := ret[1].(*gotwilio.Exception)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SendWhatsApp indicates an expected call of SendWhatsApp
+func (mr *MockNotifierMockRecorder) SendWhatsApp(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendWhatsApp", reflect.TypeOf((*MockNotifier)(nil).SendWhatsApp), arg0, arg1, arg2, arg3, arg4)
+}
+
+// SendWhatsAppMedia mocks base method
+func (m *MockNotifier) SendWhatsAppMedia(arg0, arg1, arg2 string, arg3 []string, arg4, arg5 string) (*gotwilio.SmsResponse, *gotwilio.Exception, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendWhatsAppMedia", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].(*gotwilio.SmsResponse)
+	ret1, _ := ret[1].(*gotwilio.Exception)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SendWhatsAppMedia indicates an expected call of SendWhatsAppMedia
+func (mr *MockNotifierMockRecorder) SendWhatsAppMedia(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendWhatsAppMedia", reflect.TypeOf((*MockNotifier)(nil).SendWhatsAppMedia), arg0, arg1, arg2, arg3, arg4, arg5)
+}
@@ -2,14 +2,18 @@ package twilio
 
 import (
 	"fmt"
+	"net/url"
 
+	"github.com/igvaquero18/hermezon/notification"
 	"github.com/igvaquero18/hermezon/utils"
 	"github.com/sfreiberg/gotwilio"
 )
 
-// Notifier is an interface for sending SMS Messages
+// Notifier is an interface for sending SMS and WhatsApp Messages
 type Notifier interface {
 	SendSMS(from, to, body, statusCallback, applicationSid string, opts ...*gotwilio.Option) (smsResponse *gotwilio.SmsResponse, exception *gotwilio.Exception, err error)
+	SendWhatsApp(from, to, body, statusCallback, applicationSid string) (smsResponse *gotwilio.SmsResponse, exception *gotwilio.Exception, err error)
+	SendWhatsAppMedia(from, to, body string, mediaURL []string, statusCallback, applicationSid string) (smsResponse *gotwilio.SmsResponse, exception *gotwilio.Exception, err error)
 }
 
 // Client is a struct that implicitly implements the Messenger interface
@@ -17,6 +21,8 @@ type Notifier interface {
 type Client struct {
 	Notifier
 	utils.Logger
+	phone          string
+	statusCallback string
 }
 
 // Option is a function to apply settings to Client structure
@@ -45,11 +51,52 @@ func SetLogger(logger utils.Logger) Option {
 	}
 }
 
-// SendMessage sends a message throught Twilio API. It is a wrapper for
-// implementing the Messenger interface
-func (c *Client) SendMessage(title, body, from, dest string) error {
+// SetPhone Sets the phone SMS messages are sent from
+func SetPhone(phone string) Option {
+	return func(c *Client) Option {
+		prev := c.phone
+		c.phone = phone
+		return SetPhone(prev)
+	}
+}
+
+// SetStatusCallback Sets the URL Twilio posts the delivery status of the
+// messages to. The ID of the event of every message is added to it as the id
+// query parameter.
+func SetStatusCallback(statusCallback string) Option {
+	return func(c *Client) Option {
+		prev := c.statusCallback
+		c.statusCallback = statusCallback
+		return SetStatusCallback(prev)
+	}
+}
+
+// Send sends a notification by SMS throught Twilio API, from the phone of
+// the Client, asking Twilio to report the delivery status of the message
+func (c *Client) Send(n *notification.Notification) error {
+	return c.send(c.phone, n.Recipient, fmt.Sprintf("%s\n\n%s", n.Title, n.Message), c.callback(n.ID))
+}
+
+// callback returns the status callback URL for the message of an event
+func (c *Client) callback(id string) string {
+	if c.statusCallback == "" || id == "" {
+		return ""
+	}
+	u, err := url.Parse(c.statusCallback)
+	if err != nil {
+		c.Errorw("invalid status callback", "url", c.statusCallback, "msg", err.Error())
+		return ""
+	}
+	query := u.Query()
+	query.Set("id", id)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// send sends an SMS message throught Twilio API
+func (c *Client) send(from, dest, body, statusCallback string) error {
 	c.Debug("sending SMS message through Twilio API")
-	resp, exception, err := c.SendSMS(from, dest, fmt.Sprintf("%s\n\n%s", title, body), "", "")
+	resp, exception, err := c.SendSMS(from, dest, body, statusCallback, "")
 	if err != nil {
 		return err
 	}
@@ -5,18 +5,24 @@ import (
 	"testing"
 
 	"github.com/golang/mock/gomock"
+	"github.com/igvaquero18/hermezon/notification"
 	mock_twilio "github.com/igvaquero18/hermezon/twilio/mock_twilio"
 	"github.com/igvaquero18/hermezon/utils"
 	"github.com/sfreiberg/gotwilio"
 	"github.com/stretchr/testify/assert"
-	_ "github.com/stretchr/testify/assert"
 )
 
-func TestSendMessage(t *testing.T) {
+func TestSend(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	tw := mock_twilio.NewMockNotifier(ctrl)
+	resp := &gotwilio.SmsResponse{
+		DateCreated: "2021-02-01",
+		DateSent:    "2021-02-01",
+		Status:      "Created",
+		Body:        "Created",
+	}
 	gomock.InOrder(
 		tw.EXPECT().SendSMS(
 			"+34612345678",
@@ -24,32 +30,21 @@ func TestSendMessage(t *testing.T) {
 			fmt.Sprintf("%s\n\n%s", "Title", "Body"),
 			"",
 			"",
-		).Return(
-			&gotwilio.SmsResponse{
-				DateCreated: "2021-02-01",
-				DateSent:    "2021-02-01",
-				Status:      "Created",
-				Body:        "Created",
-			},
-			nil,
-			nil,
-		),
+		).Return(resp, nil, nil),
+		tw.EXPECT().SendSMS(
+			"+34612345678",
+			"+34698765432",
+			fmt.Sprintf("%s\n\n%s", "Title", "Body"),
+			"https://hermezon.example.com/twilio/status?id=0001-abcd",
+			"",
+		).Return(resp, nil, nil),
 		tw.EXPECT().SendSMS(
 			"+34612345678",
 			"",
 			fmt.Sprintf("%s\n\n%s", "Title", "Body"),
 			"",
 			"",
-		).Return(
-			&gotwilio.SmsResponse{
-				DateCreated: "2021-02-01",
-				DateSent:    "2021-02-01",
-				Status:      "Created",
-				Body:        "Created",
-			},
-			nil,
-			fmt.Errorf("An error ocurred"),
-		),
+		).Return(resp, nil, fmt.Errorf("An error ocurred")),
 		tw.EXPECT().SendSMS(
 			"+34612345678",
 			"+3469876543",
@@ -57,12 +52,7 @@ func TestSendMessage(t *testing.T) {
 			"",
 			"",
 		).Return(
-			&gotwilio.SmsResponse{
-				DateCreated: "2021-02-01",
-				DateSent:    "2021-02-01",
-				Status:      "Created",
-				Body:        "Created",
-			},
+			resp,
 			&gotwilio.Exception{
 				Code:    gotwilio.ExceptionCode(1000),
 				Message: "Something went wrong",
@@ -72,8 +62,15 @@ func TestSendMessage(t *testing.T) {
 	)
 
 	cl := &Client{
-		tw,
-		&utils.DefaultLogger{},
+		Notifier: tw,
+		Logger:   &utils.DefaultLogger{},
+		phone:    "+34612345678",
+	}
+	withCallback := &Client{
+		Notifier:       tw,
+		Logger:         &utils.DefaultLogger{},
+		phone:          "+34612345678",
+		statusCallback: "https://hermezon.example.com/twilio/status",
 	}
 
 	testCases := []struct {
@@ -88,6 +85,12 @@ func TestSendMessage(t *testing.T) {
 			err:    nil,
 			client: cl,
 		},
+		{
+			name:   "Correct SMS sent with status callback",
+			to:     "+34698765432",
+			err:    nil,
+			client: withCallback,
+		},
 		{
 			name:   "Error when sending SMS",
 			to:     "",
@@ -95,7 +98,7 @@ func TestSendMessage(t *testing.T) {
 			client: cl,
 		},
 		{
-			name:   "Correct SMS sent",
+			name:   "Twilio API error",
 			to:     "+3469876543",
 			err:    fmt.Errorf("Twilio API error"),
 			client: cl,
@@ -104,7 +107,12 @@ func TestSendMessage(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(tt *testing.T) {
-			err := tc.client.SendMessage("Title", "Body", "+34612345678", tc.to)
+			err := tc.client.Send(&notification.Notification{
+				ID:        "0001-abcd",
+				Recipient: tc.to,
+				Title:     "Title",
+				Message:   "Body",
+			})
 			if tc.err != nil {
 				assert.Error(tt, err)
 			} else {
@@ -113,3 +121,14 @@ func TestSendMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestOptions(t *testing.T) {
+	c := NewClient("sid", "token", SetPhone("+34612345678"), SetStatusCallback("https://hermezon.example.com/twilio/status"))
+	assert.Equal(t, "+34612345678", c.phone)
+	assert.Equal(t, "https://hermezon.example.com/twilio/status", c.statusCallback)
+
+	prev := SetPhone("+34600000000")(c)
+	assert.Equal(t, "+34600000000", c.phone)
+	prev(c)
+	assert.Equal(t, "+34612345678", c.phone)
+}
@@ -0,0 +1,149 @@
+package twilio
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/sfreiberg/gotwilio"
+)
+
+// SessionWindow is the time after the last message of a customer during which
+// WhatsApp allows sending them free-form messages. Outside of it, only
+// approved templates can be sent.
+const SessionWindow = 24 * time.Hour
+
+// Sessions is an interface for knowing when customers last wrote to us
+// through WhatsApp
+type Sessions interface {
+	// LastInbound returns when the phone last sent us a message, or the zero
+	// time if it never did
+	LastInbound(phone string) (time.Time, error)
+}
+
+// WhatsApp is a struct that implicitly implements the Messenger interface
+// for sending WhatsApp messages through Twilio
+type WhatsApp struct {
+	*Client
+	phone    string
+	sessions Sessions
+	template string
+}
+
+// WhatsAppOption is a function to apply settings to WhatsApp structure
+type WhatsAppOption func(w *WhatsApp) WhatsAppOption
+
+// WhatsApp returns a WhatsApp messenger which sends messages from the given
+// phone through the Client. The session window of every customer is checked
+// in sessions.
+func (c *Client) WhatsApp(phone string, sessions Sessions, opts ...WhatsAppOption) *WhatsApp {
+	w := &WhatsApp{
+		Client:   c,
+		phone:    phone,
+		sessions: sessions,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// SetTemplate Sets the approved template sent outside of the session window.
+// Its placeholders are filled with the title of the notification ({{1}}), the
+// title of the product ({{2}}), its price ({{3}}) and its URL ({{4}}).
+func SetTemplate(template string) WhatsAppOption {
+	return func(w *WhatsApp) WhatsAppOption {
+		prev := w.template
+		w.template = template
+		return SetTemplate(prev)
+	}
+}
+
+// Send sends a notification by WhatsApp through Twilio API, from the phone
+// of the WhatsApp messenger. Inside of the session window of the customer,
+// the message is sent as is, with the image of the product. Otherwise, the
+// approved template is sent instead.
+func (w *WhatsApp) Send(n *notification.Notification) error {
+	dest := n.Recipient
+	open, err := w.inSession(dest)
+	if err != nil {
+		return err
+	}
+
+	var resp *gotwilio.SmsResponse
+	var exception *gotwilio.Exception
+	switch {
+	case open && n.Image != "":
+		w.Debug("sending WhatsApp media message through Twilio API")
+		resp, exception, err = w.SendWhatsAppMedia(w.phone, dest, freeForm(n), []string{n.Image}, w.callback(n.ID), "")
+	case open:
+		w.Debug("sending WhatsApp message through Twilio API")
+		resp, exception, err = w.SendWhatsApp(w.phone, dest, freeForm(n), w.callback(n.ID), "")
+	case w.template != "":
+		w.Debug("sending WhatsApp template message through Twilio API")
+		resp, exception, err = w.SendWhatsApp(w.phone, dest, w.fill(n), w.callback(n.ID), "")
+	default:
+		return fmt.Errorf("%s is outside of the WhatsApp session window and there is no template", dest)
+	}
+	if err != nil {
+		return err
+	}
+	if exception != nil {
+		return fmt.Errorf("Twilio API error. code: %d, message: %s", exception.Code, exception.Message)
+	}
+	w.Debugw("response from Twilio API",
+		"date_created", resp.DateCreated,
+		"date_sent", resp.DateSent,
+		"status", resp.Status,
+		"body", resp.Body,
+	)
+	return nil
+}
+
+// inSession returns true if the customer wrote to us during the session
+// window
+func (w *WhatsApp) inSession(phone string) (bool, error) {
+	if w.sessions == nil {
+		return false, nil
+	}
+	last, err := w.sessions.LastInbound(phone)
+	if err != nil {
+		return false, err
+	}
+	return !last.IsZero() && time.Since(last) < SessionWindow, nil
+}
+
+// fill fills the placeholders of the template with the data of a
+// notification
+func (w *WhatsApp) fill(n *notification.Notification) string {
+	product := n.Title
+	if n.Product != nil && n.Product.Title != "" {
+		product = n.Product.Title
+	}
+	return strings.NewReplacer(
+		"{{1}}", n.Title,
+		"{{2}}", product,
+		"{{3}}", n.Price(),
+		"{{4}}", n.URL,
+	).Replace(w.template)
+}
+
+// freeForm returns the text of a free-form message, with the title in bold
+func freeForm(n *notification.Notification) string {
+	return fmt.Sprintf("*%s*\n\n%s", n.Title, n.Message)
+}
+
+// Phone returns the phone of an incoming WhatsApp message, without the
+// "whatsapp:" prefix
+func Phone(from string) string {
+	return strings.TrimPrefix(from, "whatsapp:")
+}
+
+// CheckSignature checks that a request was sent by Twilio, through its
+// X-Twilio-Signature header. baseURL is the scheme and host Twilio sends the
+// request to.
+func CheckSignature(authToken, baseURL string, r *http.Request) (bool, error) {
+	return gotwilio.NewTwilioClient("", authToken).CheckRequestSignature(r, baseURL)
+}
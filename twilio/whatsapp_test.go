@@ -0,0 +1,164 @@
+package twilio
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/scraper"
+	mock_twilio "github.com/igvaquero18/hermezon/twilio/mock_twilio"
+	"github.com/igvaquero18/hermezon/utils"
+	"github.com/sfreiberg/gotwilio"
+	"github.com/stretchr/testify/assert"
+)
+
+// sessions is a Sessions stand-in with fixed inbound times
+type sessions map[string]time.Time
+
+func (s sessions) LastInbound(phone string) (time.Time, error) {
+	if phone == "+34600000000" {
+		return time.Time{}, fmt.Errorf("database error")
+	}
+	return s[phone], nil
+}
+
+func TestWhatsAppSend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tw := mock_twilio.NewMockNotifier(ctrl)
+	resp := &gotwilio.SmsResponse{Status: "queued"}
+	gomock.InOrder(
+		tw.EXPECT().SendWhatsAppMedia(
+			"+14155238886",
+			"+34698765432",
+			"*Product is available!*\n\nPlayStation 5",
+			[]string{"https://m.media-amazon.com/images/I/ps5.jpg"},
+			"",
+			"",
+		).Return(resp, nil, nil),
+		tw.EXPECT().SendWhatsApp(
+			"+14155238886",
+			"+34698765431",
+			"*Product is available!*\n\nPlayStation 5",
+			"",
+			"",
+		).Return(resp, nil, nil),
+		tw.EXPECT().SendWhatsApp(
+			"+14155238886",
+			"+34698765430",
+			"Product is available! PlayStation 5 at 449.99 EUR: https://www.amazon.es/dp/B08KKJ37F7",
+			"",
+			"",
+		).Return(resp, &gotwilio.Exception{Code: 63016, Message: "Outside of allowed window"}, nil),
+	)
+
+	s := sessions{
+		"+34698765432": time.Now().Add(-time.Hour),
+		"+34698765431": time.Now().Add(-time.Hour),
+		"+34698765430": time.Now().Add(-2 * SessionWindow),
+	}
+	cl := &Client{Notifier: tw, Logger: &utils.DefaultLogger{}}
+	withTemplate := cl.WhatsApp("+14155238886", s, SetTemplate("{{1}} {{2}} at {{3}}: {{4}}"))
+	withoutTemplate := cl.WhatsApp("+14155238886", s)
+
+	product := &scraper.Product{Title: "PlayStation 5"}
+	image := "https://m.media-amazon.com/images/I/ps5.jpg"
+	testCases := []struct {
+		name, dest string
+		whatsapp   *WhatsApp
+		n          *notification.Notification
+		err        bool
+	}{
+		{
+			name:     "inside of the session window with image",
+			dest:     "+34698765432",
+			whatsapp: withTemplate,
+			n:        &notification.Notification{Title: "Product is available!", Message: "PlayStation 5", Product: product, Image: image},
+		},
+		{
+			name:     "inside of the session window without image",
+			dest:     "+34698765431",
+			whatsapp: withTemplate,
+			n:        &notification.Notification{Title: "Product is available!", Message: "PlayStation 5"},
+		},
+		{
+			name:     "outside of the session window with template",
+			dest:     "+34698765430",
+			whatsapp: withTemplate,
+			n: &notification.Notification{
+				Title:    "Product is available!",
+				Message:  "PlayStation 5",
+				Product:  product,
+				Image:    image,
+				URL:      "https://www.amazon.es/dp/B08KKJ37F7",
+				NewPrice: 449.99,
+				Currency: "EUR",
+			},
+			err: true,
+		},
+		{
+			name:     "outside of the session window without template",
+			dest:     "+34698765430",
+			whatsapp: withoutTemplate,
+			n:        &notification.Notification{Title: "Product is available!", Message: "PlayStation 5"},
+			err:      true,
+		},
+		{
+			name:     "error when reading the sessions",
+			dest:     "+34600000000",
+			whatsapp: withTemplate,
+			n:        &notification.Notification{Title: "Product is available!", Message: "PlayStation 5"},
+			err:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			tc.n.Recipient = tc.dest
+			err := tc.whatsapp.Send(tc.n)
+			if tc.err {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+			}
+		})
+	}
+}
+
+func TestCheckSignature(t *testing.T) {
+	form := url.Values{"From": {"whatsapp:+34698765432"}, "Body": {"Hi"}}
+	signature, err := gotwilio.NewTwilioClient("", "token").GenerateSignature("https://hermezon.example.com/twilio/whatsapp", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name, signature string
+		valid           bool
+	}{
+		{name: "valid signature", signature: string(signature), valid: true},
+		{name: "invalid signature", signature: "invalid", valid: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/twilio/whatsapp", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("X-Twilio-Signature", tc.signature)
+			valid, err := CheckSignature("token", "https://hermezon.example.com", r)
+			assert.NoError(tt, err)
+			assert.Equal(tt, tc.valid, valid)
+		})
+	}
+}
+
+func TestPhone(t *testing.T) {
+	assert.Equal(t, "+34698765432", Phone("whatsapp:+34698765432"))
+	assert.Equal(t, "+34698765432", Phone("+34698765432"))
+}
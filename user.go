@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// usersBucket is the bucket where the users are stored, under their ID
+	usersBucket = "users"
+	// contactsBucket is the bucket where the ID of the user owning every
+	// destination is stored, under its channel and destination
+	contactsBucket = "contacts"
+
+	// defaultUserMaxActions is the default number of actions every user can
+	// have
+	defaultUserMaxActions = 50
+	// defaultUserMaxGroups is the default number of product groups every user
+	// can have
+	defaultUserMaxGroups = 10
+)
+
+// userMutex prevents concurrent requests of a user from exceeding its limits
+// or claiming the same destination twice
+var userMutex sync.Mutex
+
+// User is the owner of actions and groups, identified by the subject of the
+// JWT tokens it authenticates with, or by its API keys
+type User struct {
+	ID        string    `json:"id"`
+	Contacts  []Contact `json:"contacts"`
+	Locale    string    `json:"locale,omitempty"`
+	Limits    Limits    `json:"limits"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Contact is a destination a user gets notifications at, through a channel.
+// Only verified destinations can be the destination of actions and groups.
+type Contact struct {
+	Channel     string     `json:"channel"`
+	Destination string     `json:"destination"`
+	Verified    bool       `json:"verified"`
+	VerifiedAt  *time.Time `json:"verified_at,omitempty"`
+}
+
+// Limits are the maximum number of actions and groups a user can have
+type Limits struct {
+	Actions int `json:"actions"`
+	Groups  int `json:"groups"`
+}
+
+// contactKey returns the key under which the owner of a destination is
+// stored in the database
+func contactKey(channel, dest string) string {
+	if channel == "" {
+		channel = defaultChannel
+	}
+	return fmt.Sprintf("%s|%s", channel, dest)
+}
+
+// isVerified returns true if the destination is a verified contact of the
+// user through the channel
+func (u *User) isVerified(channel, dest string) bool {
+	if channel == "" {
+		channel = defaultChannel
+	}
+	for _, contact := range u.Contacts {
+		if contact.Channel == channel && contact.Destination == dest && contact.Verified {
+			return true
+		}
+	}
+	return false
+}
+
+// subject returns the ID of the user making a request: the owner of its API
+// key, or the claim of its JWT token users are mapped from, which is its
+// subject by default, prefixed by the issuer for identity provider tokens
+func subject(c echo.Context) string {
+	if k, ok := c.Get(apiKeyContextKey).(*APIKey); ok {
+		return k.UserID
+	}
+	return tokenUser(c)
+}
+
+// loadUser returns a user stored in the database, or nil if it doesn't exist
+func loadUser(id string) (*User, error) {
+	value, err := db.Get(id, usersBucket)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	user := &User{}
+	if err = json.Unmarshal([]byte(value), user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// saveUser stores a user in the database
+func saveUser(user *User) error {
+	value, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return db.Save(user.ID, string(value), usersBucket)
+}
+
+// currentUser returns the user making a request, creating it with the default
+// limits and the locale claim of its token the first time it's seen. Requests
+// whose token has no subject are rejected.
+func currentUser(c echo.Context) (*User, error) {
+	id := subject(c)
+	if id == "" {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "the token has no subject")
+	}
+	user, err := loadUser(id)
+	if err != nil || user != nil {
+		return user, err
+	}
+	user = &User{
+		ID:        id,
+		Contacts:  []Contact{},
+		Limits:    Limits{Actions: userMaxActions, Groups: userMaxGroups},
+		CreatedAt: time.Now().UTC(),
+	}
+	if locale, _ := tokenClaims(c)["locale"].(string); localeRegexp.MatchString(locale) {
+		user.Locale = locale
+	}
+	sugar.Infow("creating user", "id", id)
+	return user, saveUser(user)
+}
+
+// contactOwner returns the ID of the user a destination belongs to, if any
+func contactOwner(channel, dest string) (string, error) {
+	return db.Get(contactKey(channel, dest), contactsBucket)
+}
+
+// verifyContact adds a destination to the verified contacts of a user,
+// unless it belongs to another user, in which case it returns false
+func verifyContact(user *User, channel, dest string) (bool, error) {
+	owner, err := contactOwner(channel, dest)
+	if err != nil {
+		return false, err
+	}
+	if owner != "" && owner != user.ID {
+		return false, nil
+	}
+	if channel == "" {
+		channel = defaultChannel
+	}
+	now := time.Now().UTC()
+	contacts := []Contact{{Channel: channel, Destination: dest, Verified: true, VerifiedAt: &now}}
+	for _, contact := range user.Contacts {
+		if contact.Channel != channel || contact.Destination != dest {
+			contacts = append(contacts, contact)
+		}
+	}
+	sugar.Infow("verified contact of user", "id", user.ID, "channel", channel, "destination", dest)
+	user.Contacts = contacts
+	if err = saveUser(user); err != nil {
+		return false, err
+	}
+	if err = db.Save(contactKey(channel, dest), user.ID, contactsBucket); err != nil {
+		return false, err
+	}
+	return true, assignOwners()
+}
+
+// assignOwners assigns the actions and groups stored before they had owners
+// to the users who verified their destination through their channel. The
+// ones whose destination isn't verified by anyone stay unowned, and can't be
+// changed or deleted by any user, until it's verified.
+func assignOwners() error {
+	for _, at := range []ActionType{priceAction, availabilityAction, listingAction} {
+		actions, err := loadActions(at)
+		if err != nil {
+			return err
+		}
+		for key, action := range actions {
+			if action.Owner != "" {
+				continue
+			}
+			owner, err := contactOwner(action.Channel, action.From)
+			if err != nil {
+				return err
+			}
+			if owner == "" {
+				continue
+			}
+			sugar.Infow("assigning action to the owner of its destination", "owner", owner, "action", at, "key", key)
+			action.Owner = owner
+			value, err := json.Marshal(action)
+			if err != nil {
+				return err
+			}
+			if err = db.Save(key, string(value), string(at)); err != nil {
+				return err
+			}
+		}
+	}
+	groups, err := loadGroups()
+	if err != nil {
+		return err
+	}
+	for key, group := range groups {
+		if group.Owner != "" {
+			continue
+		}
+		owner, err := contactOwner(group.Channel, group.From)
+		if err != nil {
+			return err
+		}
+		if owner == "" {
+			continue
+		}
+		sugar.Infow("assigning group to the owner of its destination", "owner", owner, "key", key)
+		group.Owner = owner
+		if err = saveGroup(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userActions returns the actions of all types owned by a user
+func userActions(user *User) ([]*Action, error) {
+	owned := []*Action{}
+	for _, at := range []ActionType{priceAction, availabilityAction, listingAction} {
+		actions, err := loadActions(at)
+		if err != nil {
+			return nil, err
+		}
+		for _, action := range actions {
+			if action.Owner == user.ID {
+				owned = append(owned, action)
+			}
+		}
+	}
+	return owned, nil
+}
+
+// userGroups returns the product groups owned by a user
+func userGroups(user *User) ([]*Group, error) {
+	groups, err := loadGroups()
+	if err != nil {
+		return nil, err
+	}
+	owned := []*Group{}
+	for _, group := range groups {
+		if group.Owner == user.ID {
+			owned = append(owned, group)
+		}
+	}
+	return owned, nil
+}
+
+// getUser returns the user making the request
+func getUser(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+// putUser will allow users to change their default locale
+func putUser(c echo.Context) error {
+	userMutex.Lock()
+	defer userMutex.Unlock()
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	update := &User{}
+	if err = c.Bind(update); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid user: %s", err.Error())})
+	}
+	if update.Locale != "" && !localeRegexp.MatchString(update.Locale) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid locale: %s", update.Locale)})
+	}
+	sugar.Debugw("updating user", "id", user.ID, "locale", update.Locale)
+	user.Locale = update.Locale
+	if err = saveUser(user); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnership(t *testing.T) {
+	setUp(t)
+	e := newServer()
+	verify(t, "alice", "alice-phone")
+	verify(t, "bob", "bob-phone")
+	action := map[string]interface{}{"type": availabilityAction, "from": "alice-phone", "url": "https://www.amazon.es/dp/B01"}
+	group := map[string]interface{}{"name": "kindle", "from": "alice-phone", "urls": []string{"https://www.amazon.es/dp/B01"}}
+	query := "?type=availability&from=alice-phone&url=https://www.amazon.es/dp/B01"
+
+	testCases := []struct {
+		name     string
+		user     string
+		method   string
+		path     string
+		body     interface{}
+		expected int
+	}{
+		{name: "own action", user: "alice", method: http.MethodPost, path: "/v1/actions", body: action, expected: http.StatusOK},
+		{name: "action of another user", user: "bob", method: http.MethodPost, path: "/v1/actions", body: action, expected: http.StatusForbidden},
+		{name: "deleting an action of another user", user: "bob", method: http.MethodDelete, path: "/v1/actions" + query, expected: http.StatusNotFound},
+		{name: "own group", user: "alice", method: http.MethodPost, path: "/v1/groups", body: group, expected: http.StatusOK},
+		{name: "group of another user", user: "bob", method: http.MethodPost, path: "/v1/groups", body: group, expected: http.StatusForbidden},
+		{name: "deleting a group of another user", user: "bob", method: http.MethodDelete, path: "/v1/groups?from=alice-phone&name=kindle", expected: http.StatusNotFound},
+		{name: "history of another user", user: "bob", method: http.MethodGet, path: "/v1/notifications?from=alice-phone", expected: http.StatusForbidden},
+		{name: "own history", user: "alice", method: http.MethodGet, path: "/v1/notifications?from=alice-phone", expected: http.StatusOK},
+		{name: "quiet hours of another user", user: "bob", method: http.MethodPost, path: "/v1/quiet_hours", body: &QuietHours{From: "alice-phone", TimeZone: "UTC", Start: "22:00", End: "08:00"}, expected: http.StatusForbidden},
+		{name: "deleting quiet hours of another user", user: "bob", method: http.MethodDelete, path: "/v1/quiet_hours?from=alice-phone", expected: http.StatusForbidden},
+		{name: "destination of another user", user: "bob", method: http.MethodPost, path: "/v1/contacts", body: &ContactRequest{Destination: "alice-phone"}, expected: http.StatusForbidden},
+		{name: "unverified destination", user: "bob", method: http.MethodPost, path: "/v1/actions", body: map[string]interface{}{"type": availabilityAction, "from": "carol-phone", "url": "https://www.amazon.es/dp/B01"}, expected: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			rec := request(e, tc.method, tc.path, token(tc.user), tc.body)
+			assert.Equal(tt, tc.expected, rec.Code, rec.Body.String())
+		})
+	}
+
+	rec := request(e, http.MethodGet, "/v1/actions", token("bob"), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+	rec = request(e, http.MethodDelete, "/v1/actions"+query, token("alice"), nil)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func TestAssignOwners(t *testing.T) {
+	setUp(t)
+	e := newServer()
+	verify(t, "bob", "bob-phone")
+
+	// Actions stored before they had owners can't be changed by anyone
+	legacy := &Action{Type: priceAction, From: "alice-phone", URL: "https://www.amazon.es/dp/B01", Price: "10"}
+	value, err := json.Marshal(legacy)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Save(legacy.key(), string(value), string(priceAction)))
+	body := map[string]interface{}{"type": priceAction, "from": "alice-phone", "url": legacy.URL, "price": "20"}
+	rec := request(e, http.MethodPost, "/v1/actions", token("alice"), body)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	// Until their destination is verified by its owner
+	verify(t, "alice", "alice-phone")
+	stored, err := loadAction(priceAction, legacy.key())
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", stored.Owner)
+	rec = request(e, http.MethodPost, "/v1/actions", token("bob"), body)
+	assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+	rec = request(e, http.MethodPost, "/v1/actions", token("alice"), body)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
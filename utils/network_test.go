@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	testCases := []struct {
+		ip       string
+		expected bool
+	}{
+		{ip: "93.184.216.34", expected: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", expected: true},
+		{ip: "127.0.0.1"},
+		{ip: "10.1.2.3"},
+		{ip: "172.20.0.1"},
+		{ip: "192.168.1.1"},
+		{ip: "169.254.169.254"},
+		{ip: "100.100.100.200"},
+		{ip: "0.0.0.0"},
+		{ip: "::1"},
+		{ip: "::ffff:127.0.0.1"},
+		{ip: "fd00::1"},
+		{ip: "fe80::1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ip, func(tt *testing.T) {
+			assert.Equal(tt, tc.expected, IsPublicIP(net.ParseIP(tc.ip)))
+		})
+	}
+}
+
+func TestCheckPublicHost(t *testing.T) {
+	assert.NoError(t, CheckPublicHost("93.184.216.34"))
+	assert.Error(t, CheckPublicHost("localhost"))
+	assert.Error(t, CheckPublicHost("api.localhost."))
+	assert.Error(t, CheckPublicHost("127.0.0.1"))
+	assert.Error(t, CheckPublicHost("::1"))
+	assert.Error(t, CheckPublicHost("169.254.169.254"))
+}
+
+func TestNewPublicHTTPClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	_, err := NewPublicHTTPClient(time.Second).Get(ts.URL)
+	assert.Error(t, err)
+}
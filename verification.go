@@ -0,0 +1,339 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/templates"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// verificationsBucket is the bucket where the pending verifications of
+	// the destinations are stored, under the user, channel and destination
+	verificationsBucket = "verifications"
+	// secretsBucket is the bucket where the secrets the payloads posted to
+	// the destinations are signed with are stored, under their channel and
+	// destination
+	secretsBucket = "secrets"
+
+	// verificationCodeTTL is the time a verification code can be used for
+	verificationCodeTTL = 10 * time.Minute
+	// maxVerificationAttempts is the number of wrong codes, counted across
+	// all the codes sent to a destination, after which it can't be verified
+	// until the lockout ends
+	maxVerificationAttempts = 5
+	// verificationLockout is the time a user can't verify a destination for
+	// after the last of too many wrong codes
+	verificationLockout = 24 * time.Hour
+	// maxVerificationStarts is the number of verifications a user can start
+	// per window
+	maxVerificationStarts = 5
+	// verificationStartWindow is the window of the verifications a user can
+	// start
+	verificationStartWindow = time.Hour
+	// maxPendingVerifications is the number of verifications of a user whose
+	// code can be used at the same time
+	maxPendingVerifications = 3
+)
+
+// ContactRequest is the request for verifying a destination of a user, with
+// the code sent to it once it's received
+type ContactRequest struct {
+	Channel     string `json:"channel"`
+	Destination string `json:"destination"`
+	Code        string `json:"code,omitempty"`
+}
+
+// ContactResponse is the response of a started verification, with the
+// secret the payloads posted to the destination are signed with, for the
+// channels which sign them. The secret is only returned once.
+type ContactResponse struct {
+	Message string `json:"message"`
+	Secret  string `json:"secret,omitempty"`
+}
+
+// verification is a pending verification of a destination. Only the hash of
+// its code is stored, together with the secret of the destination, which is
+// kept once it's verified.
+type verification struct {
+	Code          string     `json:"code"`
+	Secret        string     `json:"secret,omitempty"`
+	Attempts      int        `json:"attempts"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+}
+
+// isLocked returns true if there were too many wrong codes and the lockout
+// hasn't ended yet
+func (v *verification) isLocked(now time.Time) bool {
+	return v.Attempts >= maxVerificationAttempts && v.LastAttemptAt != nil && now.Before(v.LastAttemptAt.Add(verificationLockout))
+}
+
+// signingMessenger is a Messenger which signs the payloads with a secret of
+// their destination, like webhooks
+type signingMessenger interface {
+	Messenger
+	SendWithSecret(n *notification.Notification, secret string) error
+}
+
+// verificationKey returns the key under which the pending verification of a
+// destination by a user is stored in the database
+func verificationKey(user *User, channel, dest string) string {
+	return fmt.Sprintf("%s|%s", user.ID, contactKey(channel, dest))
+}
+
+// hashSecret returns the hash of a verification code or an API key
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newCode returns a random six digit verification code
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// loadVerification returns the pending verification stored under a key, or
+// nil if there isn't any
+func loadVerification(key string) (*verification, error) {
+	value, err := db.Get(key, verificationsBucket)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	v := &verification{}
+	if err = json.Unmarshal([]byte(value), v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// webhookSecret returns the secret the payloads posted to a verified webhook
+// are signed with
+func webhookSecret(dest string) (string, error) {
+	secret, err := db.Get(contactKey(webhookChannel, dest), secretsBucket)
+	if err == nil && secret == "" {
+		err = fmt.Errorf("the webhook %s has no secret", dest)
+	}
+	return secret, err
+}
+
+// saveVerification stores a pending verification in the database
+func saveVerification(key string, v *verification) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return db.Save(key, string(value), verificationsBucket)
+}
+
+// startVerification stores a new pending verification of the destination of
+// a notification by a user, keeping the wrong attempts of the previous codes.
+// Otherwise, it returns the reason why it can't be started: the destination
+// is locked, the user has too many pending verifications or started too many
+// of them lately, or the code would exceed the rate limits of the
+// destination.
+func startVerification(user *User, channel string, n *notification.Notification, v *verification) (string, error) {
+	userMutex.Lock()
+	defer userMutex.Unlock()
+
+	key := verificationKey(user, channel, n.Recipient)
+	results, err := db.GetAll(verificationsBucket)
+	if err != nil {
+		return "", err
+	}
+	pending := 0
+	prefix := user.ID + "|"
+	for k, value := range results {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		previous := &verification{}
+		if err = json.Unmarshal([]byte(value), previous); err != nil {
+			return "", err
+		}
+		switch {
+		case k == key:
+			if previous.isLocked(n.Timestamp) {
+				return "too many wrong codes", nil
+			}
+			if previous.Attempts < maxVerificationAttempts {
+				v.Attempts, v.LastAttemptAt = previous.Attempts, previous.LastAttemptAt
+			}
+		case n.Timestamp.Before(previous.ExpiresAt):
+			pending++
+		case !previous.isLocked(n.Timestamp):
+			// Expired verifications are forgotten, unless they are locked
+			if err = db.Delete(k, verificationsBucket); err != nil {
+				return "", err
+			}
+		}
+	}
+	if pending >= maxPendingVerifications {
+		return "too many pending verifications", nil
+	}
+
+	rateLimitMutex.Lock()
+	reason, err := checkLimits([]limit{{
+		key:    "verification|" + user.ID,
+		max:    maxVerificationStarts,
+		window: verificationStartWindow,
+		reason: "too many verifications started",
+	}})
+	rateLimitMutex.Unlock()
+	if err != nil || reason != "" {
+		return reason, err
+	}
+	if reason, err = allowNotification(channel, n); err != nil || reason != "" {
+		return reason, err
+	}
+	return "", saveVerification(key, v)
+}
+
+// postContacts will allow users to start the verification of a destination,
+// sending a one-time code to it through the channel. The code is sent right
+// away, but it counts towards the rate limits of the destination. Channels
+// signing their payloads get a new secret, returned in the response.
+func postContacts(c echo.Context) error {
+	req := &ContactRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid contact: %s", err.Error())})
+	}
+	if req.Destination == "" {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid contact: destination is required"})
+	}
+	if req.Channel == "" {
+		req.Channel = defaultChannel
+	}
+	m, err := messengerFor(req.Channel)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid channel: %s", err.Error())})
+	}
+	if err := checkDestination(req.Channel, req.Destination); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid destination: %s", err.Error())})
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	owner, err := contactOwner(req.Channel, req.Destination)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != user.ID {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"invalid destination: the destination belongs to another user"})
+	}
+
+	code, err := newCode()
+	if err != nil {
+		return err
+	}
+	title, body, err := renderer.Render(templates.EventVerification, user.Locale, &templates.Data{Code: code})
+	if err != nil {
+		return err
+	}
+	n := &notification.Notification{
+		Event:     templates.EventVerification,
+		Recipient: req.Destination,
+		Title:     title,
+		Message:   body,
+		Priority:  notification.PriorityHigh,
+		Timestamp: time.Now().UTC(),
+	}
+	v := &verification{Code: hashSecret(code), ExpiresAt: n.Timestamp.Add(verificationCodeTTL)}
+	signer, signs := m.(signingMessenger)
+	if signs {
+		if v.Secret, err = randomHex(32); err != nil {
+			return err
+		}
+	}
+	reason, err := startVerification(user, req.Channel, n, v)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return c.JSON(http.StatusTooManyRequests, &ResponseMessage{fmt.Sprintf("verification code not sent: %s", reason)})
+	}
+	sugar.Debugw("sending verification code", "id", user.ID, "channel", req.Channel, "destination", req.Destination)
+	if signs {
+		err = signer.SendWithSecret(n, v.Secret)
+	} else {
+		err = m.Send(n)
+	}
+	if err != nil {
+		sugar.Errorw("error when sending verification code", "channel", req.Channel, "destination", req.Destination, "msg", err.Error())
+		return c.JSON(http.StatusBadGateway, &ResponseMessage{fmt.Sprintf("error when sending verification code: %s", err.Error())})
+	}
+	return c.JSON(http.StatusAccepted, &ContactResponse{Message: "verification code sent", Secret: v.Secret})
+}
+
+// postContactsVerify will allow users to verify a destination with the code
+// sent to it
+func postContactsVerify(c echo.Context) error {
+	req := &ContactRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{fmt.Sprintf("invalid contact: %s", err.Error())})
+	}
+	if req.Destination == "" || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid contact: destination and code are required"})
+	}
+
+	userMutex.Lock()
+	defer userMutex.Unlock()
+
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	key := verificationKey(user, req.Channel, req.Destination)
+	v, err := loadVerification(key)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if v != nil && v.isLocked(now) {
+		return c.JSON(http.StatusTooManyRequests, &ResponseMessage{"invalid code: too many wrong codes"})
+	}
+	if v == nil || now.After(v.ExpiresAt) {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid code: there is no pending verification of the destination"})
+	}
+	if subtle.ConstantTimeCompare([]byte(v.Code), []byte(hashSecret(req.Code))) != 1 {
+		v.Attempts++
+		v.LastAttemptAt = &now
+		if err = saveVerification(key, v); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid code"})
+	}
+
+	if err = db.Delete(key, verificationsBucket); err != nil {
+		return err
+	}
+	verified, err := verifyContact(user, req.Channel, req.Destination)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"invalid destination: the destination belongs to another user"})
+	}
+	if v.Secret != "" {
+		if err = db.Save(contactKey(req.Channel, req.Destination), v.Secret, secretsBucket); err != nil {
+			return err
+		}
+	}
+	return c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// wrongCode is a code which never matches the ones sent
+const wrongCode = "wrong"
+
+var codeRegexp = regexp.MustCompile(`\d{6}`)
+
+// fakeSigner is a fake messenger which signs its payloads, like webhooks
+type fakeSigner struct {
+	fakeMessenger
+	secrets []string
+}
+
+func (s *fakeSigner) SendWithSecret(n *notification.Notification, secret string) error {
+	s.secrets = append(s.secrets, secret)
+	return s.Send(n)
+}
+
+// startContact starts the verification of a destination of a user, returning
+// the response
+func startContact(e *echo.Echo, user, channel, dest string) *ContactResponse {
+	rec := request(e, http.MethodPost, "/v1/contacts", token(user), &ContactRequest{Channel: channel, Destination: dest})
+	if rec.Code != http.StatusAccepted {
+		return nil
+	}
+	resp := &ContactResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+		panic(err)
+	}
+	return resp
+}
+
+// lastCode returns the code of the last verification sent by a messenger
+func lastCode(m *fakeMessenger) string {
+	messages := m.messages()
+	if len(messages) == 0 {
+		return ""
+	}
+	return codeRegexp.FindString(messages[len(messages)-1])
+}
+
+// verifyCode verifies a destination of a user with a code, returning the
+// status code of the response
+func verifyCode(e *echo.Echo, user, dest, code string) int {
+	return request(e, http.MethodPost, "/v1/contacts/verify", token(user), &ContactRequest{Destination: dest, Code: code}).Code
+}
+
+func TestVerification(t *testing.T) {
+	fake := setUp(t)
+	e := newServer()
+
+	assert.NotNil(t, startContact(e, "alice", "", "alice-phone"))
+	assert.Equal(t, http.StatusBadRequest, verifyCode(e, "alice", "alice-phone", wrongCode))
+	// Codes are only valid for the user who asked for them
+	assert.Equal(t, http.StatusBadRequest, verifyCode(e, "bob", "alice-phone", lastCode(fake)))
+	assert.Equal(t, http.StatusOK, verifyCode(e, "alice", "alice-phone", lastCode(fake)))
+	user, err := loadUser("alice")
+	assert.NoError(t, err)
+	assert.True(t, user.isVerified(testChannel, "alice-phone"))
+
+	// Codes can only be used once
+	assert.Equal(t, http.StatusBadRequest, verifyCode(e, "alice", "alice-phone", lastCode(fake)))
+}
+
+func TestVerificationExpiry(t *testing.T) {
+	fake := setUp(t)
+	e := newServer()
+
+	assert.NotNil(t, startContact(e, "alice", "", "alice-phone"))
+	key := verificationKey(&User{ID: "alice"}, testChannel, "alice-phone")
+	v, err := loadVerification(key)
+	assert.NoError(t, err)
+	v.ExpiresAt = time.Now().UTC().Add(-time.Second)
+	assert.NoError(t, saveVerification(key, v))
+	assert.Equal(t, http.StatusBadRequest, verifyCode(e, "alice", "alice-phone", lastCode(fake)))
+}
+
+func TestVerificationAttempts(t *testing.T) {
+	fake := setUp(t)
+	e := newServer()
+
+	assert.NotNil(t, startContact(e, "alice", "", "alice-phone"))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusBadRequest, verifyCode(e, "alice", "alice-phone", wrongCode))
+	}
+	// Wrong codes are counted across the codes sent to a destination
+	assert.NotNil(t, startContact(e, "alice", "", "alice-phone"))
+	for i := 3; i < maxVerificationAttempts; i++ {
+		assert.Equal(t, http.StatusBadRequest, verifyCode(e, "alice", "alice-phone", wrongCode))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, verifyCode(e, "alice", "alice-phone", lastCode(fake)))
+
+	// No more codes are sent until the lockout ends
+	sent := len(fake.messages())
+	rec := request(e, http.MethodPost, "/v1/contacts", token("alice"), &ContactRequest{Destination: "alice-phone"})
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, rec.Body.String())
+	assert.Len(t, fake.messages(), sent)
+
+	key := verificationKey(&User{ID: "alice"}, testChannel, "alice-phone")
+	v, err := loadVerification(key)
+	assert.NoError(t, err)
+	lastAttempt := time.Now().UTC().Add(-verificationLockout)
+	v.LastAttemptAt = &lastAttempt
+	assert.NoError(t, saveVerification(key, v))
+	assert.NotNil(t, startContact(e, "alice", "", "alice-phone"))
+	assert.Equal(t, http.StatusOK, verifyCode(e, "alice", "alice-phone", lastCode(fake)))
+}
+
+func TestVerificationLockoutEnd(t *testing.T) {
+	fake := setUp(t)
+	e := newServer()
+
+	assert.NotNil(t, startContact(e, "alice", "", "alice-phone"))
+	for i := 0; i < maxVerificationAttempts; i++ {
+		assert.Equal(t, http.StatusBadRequest, verifyCode(e, "alice", "alice-phone", wrongCode))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, verifyCode(e, "alice", "alice-phone", lastCode(fake)))
+
+	// Codes still valid can be used once the lockout ends
+	key := verificationKey(&User{ID: "alice"}, testChannel, "alice-phone")
+	v, err := loadVerification(key)
+	assert.NoError(t, err)
+	lastAttempt := time.Now().UTC().Add(-verificationLockout)
+	v.LastAttemptAt = &lastAttempt
+	v.ExpiresAt = time.Now().UTC().Add(verificationCodeTTL)
+	assert.NoError(t, saveVerification(key, v))
+	assert.Equal(t, http.StatusOK, verifyCode(e, "alice", "alice-phone", lastCode(fake)))
+}
+
+func TestVerificationLimits(t *testing.T) {
+	setUp(t)
+	e := newServer()
+
+	for _, dest := range []string{"phone-1", "phone-2", "phone-3"} {
+		assert.NotNil(t, startContact(e, "alice", "", dest))
+	}
+	rec := request(e, http.MethodPost, "/v1/contacts", token("alice"), &ContactRequest{Destination: "phone-4"})
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), "too many pending verifications")
+
+	// New codes for a pending verification count towards the verifications
+	// started, but not towards the pending ones
+	for i := 3; i < maxVerificationStarts; i++ {
+		assert.NotNil(t, startContact(e, "alice", "", "phone-1"))
+	}
+	rec = request(e, http.MethodPost, "/v1/contacts", token("alice"), &ContactRequest{Destination: "phone-1"})
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), "too many verifications started")
+
+	// Other users have their own limits
+	assert.NotNil(t, startContact(e, "bob", "", "phone-4"))
+}
+
+func TestVerificationSecret(t *testing.T) {
+	setUp(t)
+	signer := &fakeSigner{}
+	messengers[webhookChannel] = signer
+	e := newServer()
+	dest := "https://93.184.216.34/hermezon"
+
+	resp := startContact(e, "alice", webhookChannel, dest)
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	assert.Len(t, resp.Secret, 64)
+	assert.Equal(t, []string{resp.Secret}, signer.secrets)
+	_, err := webhookSecret(dest)
+	assert.Error(t, err)
+
+	rec := request(e, http.MethodPost, "/v1/contacts/verify", token("alice"), &ContactRequest{Channel: webhookChannel, Destination: dest, Code: lastCode(&signer.fakeMessenger)})
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	secret, err := webhookSecret(dest)
+	assert.NoError(t, err)
+	assert.Equal(t, resp.Secret, secret)
+}
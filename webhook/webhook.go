@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/utils"
+)
+
+const (
+	// SignatureHeader is the header with the HMAC-SHA256 signature of the
+	// payload, as "sha256=<hex digest>"
+	SignatureHeader = "X-Hermezon-Signature"
+	// EventHeader is the header with the kind of event of the payload
+	EventHeader = "X-Hermezon-Event"
+)
+
+// SecretFunc returns the secret the payloads posted to a webhook are signed
+// with
+type SecretFunc func(dest string) (string, error)
+
+// Client is a struct that implicitly implements the Messenger interface
+// for posting messages to webhooks, whose URL is the destination. Failed
+// deliveries aren't retried by the client, but by the outbox of the service.
+type Client struct {
+	secrets SecretFunc
+	client  *http.Client
+	utils.Logger
+}
+
+// Option is a function to apply settings to Client structure
+type Option func(c *Client) Option
+
+// NewClient returns a new Client which signs the payloads with the secret of
+// every webhook
+func NewClient(secrets SecretFunc, opts ...Option) *Client {
+	c := &Client{
+		secrets: secrets,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		Logger:  &utils.DefaultLogger{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetHTTPClient Sets the HTTP client for Client
+func SetHTTPClient(client *http.Client) Option {
+	return func(c *Client) Option {
+		prev := c.client
+		c.client = client
+		return SetHTTPClient(prev)
+	}
+}
+
+// SetLogger Sets the Logger for Client
+func SetLogger(logger utils.Logger) Option {
+	return func(c *Client) Option {
+		prev := c.Logger
+		c.Logger = logger
+		return SetLogger(prev)
+	}
+}
+
+// Sign returns the signature of a payload with a secret, as sent in the
+// SignatureHeader
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return fmt.Sprintf("sha256=%s", hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Send posts a notification as JSON to the webhook at its recipient,
+// returning an error if it doesn't answer with a 2xx status code
+func (c *Client) Send(n *notification.Notification) error {
+	secret, err := c.secrets(n.Recipient)
+	if err != nil {
+		return err
+	}
+	return c.SendWithSecret(n, secret)
+}
+
+// SendWithSecret posts a notification like Send, signed with the given
+// secret instead of the one of the webhook, which may not be known yet
+func (c *Client) SendWithSecret(n *notification.Notification, secret string) error {
+	dest := n.Recipient
+	if n.Timestamp.IsZero() {
+		n.Timestamp = time.Now().UTC()
+	}
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return c.post(dest, n.Event, secret, payload)
+}
+
+// post posts a payload signed with the secret to the webhook at dest
+func (c *Client) post(dest, event, secret string, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, dest, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(SignatureHeader, Sign(secret, payload))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook response status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+	c.Debugw("posted event to webhook", "url", dest, "event", event, "status_code", resp.StatusCode)
+	return nil
+}
@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/igvaquero18/hermezon/notification"
+	"github.com/igvaquero18/hermezon/scraper"
+	"github.com/stretchr/testify/assert"
+)
+
+// secrets returns the secret of every webhook in the map
+func secrets(m map[string]string) SecretFunc {
+	return func(dest string) (string, error) {
+		secret, ok := m[dest]
+		if !ok {
+			return "", fmt.Errorf("the webhook %s has no secret", dest)
+		}
+		return secret, nil
+	}
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t,
+		"sha256=b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad",
+		Sign("", []byte("")),
+	)
+	assert.NotEqual(t, Sign("secret", []byte("payload")), Sign("other", []byte("payload")))
+}
+
+func TestSend(t *testing.T) {
+	testCases := []struct {
+		name     string
+		failures int32
+		status   int
+		attempts int32
+		err      bool
+	}{
+		{
+			name:     "delivered at the first attempt",
+			attempts: 1,
+		},
+		{
+			name:     "error status code",
+			failures: 1,
+			status:   http.StatusServiceUnavailable,
+			attempts: 1,
+			err:      true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(tt *testing.T) {
+			var attempts int32
+			var received *notification.Notification
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&attempts, 1)
+				if n <= tc.failures {
+					w.WriteHeader(tc.status)
+					return
+				}
+				body, _ := ioutil.ReadAll(r.Body)
+				assert.Equal(tt, Sign("secret", body), r.Header.Get(SignatureHeader))
+				assert.Equal(tt, "price", r.Header.Get(EventHeader))
+				assert.Equal(tt, "application/json", r.Header.Get("Content-Type"))
+				received = &notification.Notification{}
+				assert.NoError(tt, json.Unmarshal(body, received))
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer ts.Close()
+
+			c := NewClient(secrets(map[string]string{ts.URL: "secret"}), SetHTTPClient(ts.Client()))
+			err := c.Send(&notification.Notification{
+				Event:     "price",
+				Recipient: ts.URL,
+				Title:     "Product is below desired price!",
+				Product:   &scraper.Product{Title: "PlayStation 5", Price: 449.99},
+				URL:       "https://www.amazon.es/dp/B08KKJ37F7",
+				OldPrice:  499.99,
+				NewPrice:  449.99,
+			})
+			assert.Equal(tt, tc.attempts, atomic.LoadInt32(&attempts))
+			if tc.err {
+				assert.Error(tt, err)
+				return
+			}
+			assert.NoError(tt, err)
+			if assert.NotNil(tt, received) {
+				assert.Equal(tt, "PlayStation 5", received.Product.Title)
+				assert.Equal(tt, 499.99, received.OldPrice)
+				assert.Equal(tt, 449.99, received.NewPrice)
+				assert.False(tt, received.Timestamp.IsZero())
+			}
+		})
+	}
+}
+
+func TestSendLinks(t *testing.T) {
+	var received *notification.Notification
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = &notification.Notification{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(received))
+	}))
+	defer ts.Close()
+
+	c := NewClient(secrets(map[string]string{ts.URL: "secret", "http://127.0.0.1:0": "secret"}))
+	assert.NoError(t, c.Send(&notification.Notification{
+		Event:     "listing",
+		Recipient: ts.URL,
+		Title:     "New products found!",
+		Links:     []notification.Link{{Label: "PlayStation 5", URL: "https://www.amazon.es/dp/B08KKJ37F7"}},
+	}))
+	if assert.NotNil(t, received) {
+		assert.Equal(t, "listing", received.Event)
+		assert.Equal(t, ts.URL, received.Recipient)
+		assert.Equal(t, []notification.Link{{Label: "PlayStation 5", URL: "https://www.amazon.es/dp/B08KKJ37F7"}}, received.Links)
+	}
+	assert.Error(t, c.Send(&notification.Notification{Recipient: "http://127.0.0.1:0"}))
+}
+
+func TestSendWithSecret(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, Sign("other", body), r.Header.Get(SignatureHeader))
+	}))
+	defer ts.Close()
+
+	c := NewClient(secrets(map[string]string{}))
+	assert.Error(t, c.Send(&notification.Notification{Event: "verification", Recipient: ts.URL}))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&attempts))
+	assert.NoError(t, c.SendWithSecret(&notification.Notification{Event: "verification", Recipient: ts.URL}, "other"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
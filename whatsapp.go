@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/igvaquero18/hermezon/twilio"
+	"github.com/labstack/echo/v4"
+)
+
+// whatsAppSessionsBucket is the bucket where the time of the last message
+// sent to us by every WhatsApp customer is stored, under their phone
+const whatsAppSessionsBucket = "whatsapp_sessions"
+
+// whatsAppSessions implements twilio.Sessions on top of the database
+type whatsAppSessions struct{}
+
+// LastInbound returns when the phone last sent us a WhatsApp message
+func (s whatsAppSessions) LastInbound(phone string) (time.Time, error) {
+	value, err := db.Get(phone, whatsAppSessionsBucket)
+	if err != nil || value == "" {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// postWhatsApp receives the WhatsApp messages sent to us by customers from
+// Twilio, opening their session window
+func postWhatsApp(c echo.Context) error {
+	baseURL := publicURL
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("%s://%s", c.Scheme(), c.Request().Host)
+	}
+	valid, err := twilio.CheckSignature(twilioToken, baseURL, c.Request())
+	if err != nil || !valid {
+		return c.JSON(http.StatusForbidden, &ResponseMessage{"invalid twilio signature"})
+	}
+
+	phone := twilio.Phone(c.FormValue("From"))
+	if phone == "" {
+		return c.JSON(http.StatusBadRequest, &ResponseMessage{"invalid message: from is required"})
+	}
+	sugar.Debugw("received whatsapp message", "from", phone)
+	if err = db.Save(phone, time.Now().UTC().Format(time.RFC3339), whatsAppSessionsBucket); err != nil {
+		return err
+	}
+	return c.XMLBlob(http.StatusOK, []byte("<Response></Response>"))
+}